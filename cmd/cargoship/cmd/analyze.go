@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// NewAnalyzeCmd creates the analyze command for reporting on an inventory
+func NewAnalyzeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "analyze INVENTORY_FILE",
+		Short: "Report on what makes up an inventory",
+		Long: `Report on the files in an inventory.
+
+This includes the bytes and counts per extension, file size and modification
+age histograms, the largest directories and how full each suitcase is compared
+to the max suitcase size.
+
+Examples:
+  # Show the report as tables
+  cargoship analyze /path/to/inventory.yaml
+
+  # Only show the 5 largest directories, as markdown
+  cargoship analyze inventory.yaml --top 5 --format markdown
+
+  # Output the report in JSON format
+  cargoship analyze inventory.yaml --format json`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runAnalyze,
+	}
+
+	cmd.Flags().String("format", "table", "Output format (table, json, markdown)")
+	cmd.Flags().Int("top", 10, "Number of directories to include, ordered by size. 0 includes every directory")
+
+	return cmd
+}
+
+func runAnalyze(cmd *cobra.Command, args []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	top, err := cmd.Flags().GetInt("top")
+	if err != nil {
+		return err
+	}
+
+	inv, err := inventory.NewInventoryWithFilename(args[0])
+	if err != nil {
+		return err
+	}
+	stats, err := inv.Stats(top)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats)
+	case "markdown":
+		return stats.WriteMarkdown(os.Stdout)
+	case "table":
+		return outputAnalyzeTables(stats)
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func outputAnalyzeTables(stats *inventory.Stats) error {
+	for idx, t := range stats.Tables() {
+		if idx > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("📊 %v\n", t.Title)
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header(t.Header)
+		for _, row := range t.Rows {
+			if err := table.Append(row); err != nil {
+				return err
+			}
+		}
+		if err := table.Render(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
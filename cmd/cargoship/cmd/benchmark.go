@@ -29,7 +29,7 @@ func NewBenchmarkCmd() *cobra.Command {
 		Short: "Benchmark compression algorithms",
 		Long: `Benchmark different compression algorithms to find the optimal one for your data.
 
-This command tests various compression algorithms (gzip, zlib, zstd, lz4, s2) 
+This command tests various compression algorithms (gzip, zlib, zstd, lz4, s2, xz) 
 with different compression levels to help you choose the best algorithm based
 on your performance and size requirements.
 
@@ -201,20 +201,29 @@ func outputBenchmarkTable(results []compression.CompressionResult, originalSize
 
 	// Show recommendations
 	fmt.Printf("\n🎯 Recommendations:\n")
-	fmt.Printf("   Best Overall: %s (level %d) - %.2fx compression in %dms\n", 
-		best.Algorithm, best.Level, best.CompressionRatio, best.CompressionTime)
+	fmt.Printf("   Best Overall: %s (level %d) - %.2fx compression in %dms%s\n", 
+		best.Algorithm, best.Level, best.CompressionRatio, best.CompressionTime, suitcaseFormatHint(best))
 
 	fastest := findFastestAlgorithm(results)
-	fmt.Printf("   Fastest: %s (level %d) - %.1f MB/s\n", 
-		fastest.Algorithm, fastest.Level, fastest.Throughput)
+	fmt.Printf("   Fastest: %s (level %d) - %.1f MB/s%s\n", 
+		fastest.Algorithm, fastest.Level, fastest.Throughput, suitcaseFormatHint(fastest))
 
 	bestRatio := findBestRatioAlgorithm(results) 
-	fmt.Printf("   Best Compression: %s (level %d) - %.2fx ratio\n", 
-		bestRatio.Algorithm, bestRatio.Level, bestRatio.CompressionRatio)
+	fmt.Printf("   Best Compression: %s (level %d) - %.2fx ratio%s\n", 
+		bestRatio.Algorithm, bestRatio.Level, bestRatio.CompressionRatio, suitcaseFormatHint(bestRatio))
 
 	return nil
 }
 
+// suitcaseFormatHint tells how to use an algorithm for suitcases, when there
+// is a suitcase format for it
+func suitcaseFormatHint(result compression.CompressionResult) string {
+	if result.SuitcaseFormat == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (--suitcase-format %s)", result.SuitcaseFormat)
+}
+
 func outputBenchmarkJSON(results []compression.CompressionResult) error {
 	output := map[string]interface{}{
 		"timestamp": time.Now().Format(time.RFC3339),
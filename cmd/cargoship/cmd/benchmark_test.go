@@ -318,6 +318,11 @@ func TestFindBestRatioAlgorithm(t *testing.T) {
 	}
 }
 
+func TestSuitcaseFormatHint(t *testing.T) {
+	assert.Equal(t, " (--suitcase-format tar.lz4)", suitcaseFormatHint(compression.CompressionResult{Algorithm: "lz4", SuitcaseFormat: "tar.lz4"}))
+	assert.Equal(t, "", suitcaseFormatHint(compression.CompressionResult{Algorithm: "zlib"}))
+}
+
 func TestOutputBenchmarkJSON(t *testing.T) {
 	// Capture stdout
 	originalStdout := os.Stdout
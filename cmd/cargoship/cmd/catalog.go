@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/catalog"
+)
+
+// NewCatalogCmd creates the catalog command for finding files across many inventories
+func NewCatalogCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "catalog",
+		Short: "Find files across every inventory you have shipped",
+		Long: `Keep a local catalog of inventories, and search it to find out which
+inventory, suitcase and remote destination hold a file.
+
+Examples:
+  # Add every inventory underneath a directory
+  cargoship catalog add /archive/inventories --remote s3:bucket/lab
+
+  # Where is my file?
+  cargoship catalog search --name run-42.h5
+
+  # Everything from a project, modified during 2021
+  cargoship catalog search --project genomics --after 2021-01-01 --before 2022-01-01`,
+	}
+	cmd.PersistentFlags().String("db", "", "Catalog database file. Defaults to ~/.config/cargoship/catalog.db")
+
+	add := &cobra.Command{
+		Use:   "add INVENTORY_FILE_OR_DIR...",
+		Short: "Add inventories to the catalog",
+		Long: `Add inventory files to the catalog. Directories are walked, adding every
+inventory found inside. Inventories that haven't changed since they were last
+added are skipped.`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: runCatalogAdd,
+	}
+	add.Flags().String("remote", "", "Where the suitcases were sent. Defaults to the directory holding each inventory")
+	add.Flags().String("project", "", "Project to record for the inventories, instead of the one in the metadata or the suitcase prefix")
+	add.Flags().Bool("force", false, "Re-add inventories even if they haven't changed")
+
+	search := &cobra.Command{
+		Use:   "search",
+		Short: "Search the catalog for files",
+		Long: `Search the catalog for files. Every option given must match. Paths and
+names may be globs.`,
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runCatalogSearch,
+	}
+	search.Flags().String("path", "", "Path or destination of the file. Matches anywhere in the path, unless it is a glob")
+	search.Flags().String("name", "", "Name of the file")
+	search.Flags().String("hash", "", "Hash of the file content")
+	search.Flags().String("after", "", "Only files modified on or after this date (YYYY-MM-DD or RFC3339)")
+	search.Flags().String("before", "", "Only files modified before this date (YYYY-MM-DD or RFC3339)")
+	search.Flags().String("project", "", "Project of the inventory")
+	search.Flags().String("format", "table", "Output format (table, json)")
+
+	list := &cobra.Command{
+		Use:               "list",
+		Short:             "List the inventories in the catalog",
+		Args:              cobra.NoArgs,
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runCatalogList,
+	}
+	list.Flags().String("format", "table", "Output format (table, json)")
+
+	remove := &cobra.Command{
+		Use:   "remove INVENTORY_FILE...",
+		Short: "Remove inventories from the catalog",
+		Args:  cobra.MinimumNArgs(1),
+		RunE:  runCatalogRemove,
+	}
+
+	cmd.AddCommand(add, search, list, remove)
+	return cmd
+}
+
+func openCatalog(cmd *cobra.Command) (*catalog.Catalog, error) {
+	fn, err := cmd.Flags().GetString("db")
+	if err != nil {
+		return nil, err
+	}
+	if fn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		fn = filepath.Join(home, ".config", "cargoship", "catalog.db")
+	}
+	return catalog.Open(fn)
+}
+
+func closeCatalog(c *catalog.Catalog) {
+	if err := c.Close(); err != nil {
+		slog.Warn("error closing catalog", "error", err)
+	}
+}
+
+func runCatalogAdd(cmd *cobra.Command, args []string) error {
+	remote, err := cmd.Flags().GetString("remote")
+	if err != nil {
+		return err
+	}
+	project, err := cmd.Flags().GetString("project")
+	if err != nil {
+		return err
+	}
+	force, err := cmd.Flags().GetBool("force")
+	if err != nil {
+		return err
+	}
+	opts := []func(*catalog.AddOptions){catalog.WithRemote(remote), catalog.WithProject(project)}
+	if force {
+		opts = append(opts, catalog.WithForce())
+	}
+
+	c, err := openCatalog(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeCatalog(c)
+
+	var added int
+	for _, arg := range args {
+		st, err := os.Stat(arg)
+		if err != nil {
+			return err
+		}
+		if st.IsDir() {
+			n, err := c.AddDirs([]string{arg}, opts...)
+			if err != nil {
+				return err
+			}
+			added += n
+			continue
+		}
+		rec, err := c.Add(arg, opts...)
+		if err != nil {
+			return err
+		}
+		if rec != nil {
+			added++
+		}
+	}
+	fmt.Printf("📚 Added %v inventories to the catalog\n", added)
+	return nil
+}
+
+func runCatalogSearch(cmd *cobra.Command, _ []string) error {
+	var q catalog.Query
+	var err error
+	for k, v := range map[string]*string{
+		"path":    &q.Path,
+		"name":    &q.Name,
+		"hash":    &q.Hash,
+		"project": &q.Project,
+	} {
+		if *v, err = cmd.Flags().GetString(k); err != nil {
+			return err
+		}
+	}
+	for k, v := range map[string]*time.Time{
+		"after":  &q.ModifiedAfter,
+		"before": &q.ModifiedBefore,
+	} {
+		s, err := cmd.Flags().GetString(k)
+		if err != nil {
+			return err
+		}
+		if s == "" {
+			continue
+		}
+		if *v, err = parseCatalogDate(s); err != nil {
+			return fmt.Errorf("invalid --%v: %w", k, err)
+		}
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+
+	c, err := openCatalog(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeCatalog(c)
+
+	hits, err := c.Search(q)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		return outputJSON(hits)
+	case "table":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("Destination", "Size", "Modified", "Suitcases", "Remote", "Inventory")
+		for _, h := range hits {
+			if err := table.Append(
+				h.Destination,
+				humanize.Bytes(uint64(max(h.Size, 0))),
+				h.ModTime.Format(time.DateOnly),
+				strings.Join(h.Suitcases, ", "),
+				h.Remote,
+				h.Inventory,
+			); err != nil {
+				return err
+			}
+		}
+		return table.Render()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func runCatalogList(cmd *cobra.Command, _ []string) error {
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+	c, err := openCatalog(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeCatalog(c)
+
+	recs, err := c.Inventories()
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "json":
+		return outputJSON(recs)
+	case "table":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("Inventory", "Project", "Files", "Size", "Remote")
+		for _, r := range recs {
+			if err := table.Append(
+				r.Path,
+				r.Project,
+				fmt.Sprint(r.FileCount),
+				humanize.Bytes(uint64(max(r.TotalSize, 0))),
+				r.Remote,
+			); err != nil {
+				return err
+			}
+		}
+		return table.Render()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+func runCatalogRemove(cmd *cobra.Command, args []string) error {
+	c, err := openCatalog(cmd)
+	if err != nil {
+		return err
+	}
+	defer closeCatalog(c)
+	for _, arg := range args {
+		if err := c.Remove(arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseCatalogDate parses either a plain date or a full RFC3339 timestamp
+func parseCatalogDate(s string) (time.Time, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func outputJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
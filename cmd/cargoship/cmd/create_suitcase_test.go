@@ -237,7 +237,7 @@ func TestSuitcaseFormatComplete(t *testing.T) {
 	cmd.SetArgs([]string{"__complete", "create", "suitcase", "--suitcase-format", ""})
 	err := cmd.ExecuteContext(context.Background())
 	require.NoError(t, err)
-	require.Equal(t, "tar\ntar.gpg\ntar.gz\ntar.gz.gpg\ntar.zst\ntar.zst.gpg\n:4\n", b.String())
+	require.Equal(t, "aes.zip\ntar\ntar.bz2\ntar.gpg\ntar.gz\ntar.gz.gpg\ntar.lz4\ntar.lz4.gpg\ntar.s2\ntar.s2.gpg\ntar.xz\ntar.xz.gpg\ntar.zst\ntar.zst.gpg\nzip\n:4\n", b.String())
 }
 
 func BenchmarkSuitcaseCreate(b *testing.B) {
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// NewFindCmd creates the find command for querying inventories
+func NewFindCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "find QUERY...",
+		Short: "Find files in inventories using a query",
+		Long: `Find the files in one or more inventories that match a query.
+
+A query is made up of terms, all of which must match:
+
+  ext:.h5           file extension
+  name:run-*.h5     file name, exact or a glob
+  path:~/raw/       source path or destination, containing the value, or a glob
+  size>1G           file size, compared with >, >=, <, <= or =
+  mtime<2022-01-01  modification time, compared with >, >=, <, <= or =. A plain
+                    date covers the whole day
+  suitcase:3        suitcase index, or part of the suitcase name
+  hash:abc123       file hash
+  type:symlink      entry type
+
+Any other words match the file name, or the table of contents of archives.
+Quote the query, so the shell leaves characters like > and * alone.
+
+Examples:
+  # Large HDF5 files in the third suitcase, from before 2022
+  cargoship find 'ext:.h5 size>1G suitcase:3 path:~/raw/ mtime<2022-01-01' -i inventory.yaml
+
+  # Search every inventory underneath a directory, for a spreadsheet
+  cargoship find 'name:*.csv' -i /archive/inventories --format csv > audit.csv`,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runFind,
+	}
+
+	cmd.Flags().StringArrayP("inventory", "i", []string{"."}, "Inventory file, or directory containing inventories, to search. May be given more than once")
+	cmd.Flags().String("format", "table", "Output format (table, json, csv)")
+
+	return cmd
+}
+
+func runFind(cmd *cobra.Command, args []string) error {
+	invs, err := cmd.Flags().GetStringArray("inventory")
+	if err != nil {
+		return err
+	}
+	format, err := cmd.Flags().GetString("format")
+	if err != nil {
+		return err
+	}
+
+	q, err := inventory.ParseQuery(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	c, err := findCollection(invs)
+	if err != nil {
+		return err
+	}
+	matches, err := c.Find(q)
+	if err != nil {
+		return err
+	}
+
+	switch format {
+	case "json":
+		return outputJSON(matches)
+	case "csv":
+		return matches.WriteCSV(os.Stdout)
+	case "table":
+		table := tablewriter.NewWriter(os.Stdout)
+		table.Header("Destination", "Size", "Modified", "Suitcase", "Inventory")
+		for _, m := range matches {
+			var mtime string
+			if !m.File.ModTime.IsZero() {
+				mtime = m.File.ModTime.Format(time.DateOnly)
+			}
+			if err := table.Append(
+				m.File.Destination,
+				humanize.Bytes(uint64(max(m.File.Size, 0))),
+				mtime,
+				m.Suitcase,
+				m.Inventory,
+			); err != nil {
+				return err
+			}
+		}
+		return table.Render()
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// findCollection loads up inventory files, along with every inventory inside
+// of any directories given
+func findCollection(paths []string) (inventory.Collection, error) {
+	ret := inventory.Collection{}
+	for _, p := range paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		if !st.IsDir() {
+			inv, err := inventory.NewInventoryWithFilename(p)
+			if err != nil {
+				return nil, err
+			}
+			ret[p] = *inv
+			continue
+		}
+		c, err := inventory.CollectionWithDirs([]string{p})
+		if err != nil {
+			return nil, err
+		}
+		for fn, inv := range *c {
+			ret[fn] = inv
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// NewMigrateCmd creates the migrate command for rewriting inventories to the current schema
+func NewMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate INVENTORY_FILE",
+		Short: "Rewrite an inventory using the current schema version",
+		Long: fmt.Sprintf(`Rewrite an older inventory using the current schema version (%v).
+
+Inventories are always upgraded in memory when they are read, so this is only
+needed to bring the file on disk up to date. The upgraded inventory is
+validated, and the rewritten file is read back and compared before it replaces
+anything. When rewriting in place, the original is kept with a .bak extension.
+
+Examples:
+  # Rewrite an inventory in place
+  cargoship migrate /path/to/inventory.yaml
+
+  # Write the upgraded inventory somewhere else, as json
+  cargoship migrate inventory.yaml --output inventory-new.json
+
+  # Only check that an inventory can be upgraded
+  cargoship migrate inventory.yaml --check`, inventory.SchemaVersion),
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runMigrate,
+	}
+
+	cmd.Flags().StringP("output", "o", "", "File to write the upgraded inventory to. The format comes from the extension. Defaults to rewriting the inventory in place")
+	cmd.Flags().Bool("check", false, "Only validate the upgraded inventory, without writing anything")
+
+	return cmd
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	output, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return err
+	}
+	check, err := cmd.Flags().GetBool("check")
+	if err != nil {
+		return err
+	}
+
+	if check {
+		inv, err := inventory.NewInventoryWithFilename(args[0])
+		if err != nil {
+			return err
+		}
+		if err := inv.Validate(); err != nil {
+			return err
+		}
+		fmt.Printf("✅ %v is valid for schema version %v\n", args[0], inventory.SchemaVersion)
+		return nil
+	}
+
+	if output == "" {
+		output = args[0]
+	}
+	from, err := inventory.RewriteInventory(args[0], output)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("✅ Rewrote %v from schema version %v to %v in %v\n", args[0], from, inventory.SchemaVersion, output)
+	return nil
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	porter "github.com/scttfrdmn/cargoship/pkg"
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// NewRestoreCmd creates the restore command for unpacking suitcases
+func NewRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore INVENTORY_FILE",
+		Short: "Restore files from a set of suitcases",
+		Long: `Restore all of the files listed in an inventory from its suitcases.
+
+Suitcases are decrypted (outer or inner per-file gpg) with the given private
+keys, decompressed and unpacked to their inventory destination, underneath the
+restore directory.
+
+Examples:
+  # Restore suitcases sitting next to the inventory
+  cargoship restore /path/to/inventory.yaml --destination /path/to/restore
+
+  # Restore encrypted suitcases from a different directory
+  cargoship restore inventory.yaml --suitcase-dir /mnt/suitcases \
+    --destination /path/to/restore --private-key ~/.gnupg/private.key`,
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runRestore,
+	}
+
+	cmd.Flags().String("suitcase-dir", "", "Directory containing the suitcases. Defaults to the directory of the inventory file")
+	cmd.Flags().StringP("destination", "d", "", "Directory to restore files in to")
+	cmd.Flags().StringArray("private-key", []string{}, "Private gpg key used to decrypt suitcases. May be specified multiple times")
+	cmd.Flags().String("passphrase-file", "", "File containing the passphrase for the private key(s)")
+	cmd.Flags().String("password-file", "", "File containing the password for aes.zip suitcases. Defaults to the CARGOSHIP_SUITCASE_PASSWORD environment variable")
+	cmd.Flags().Int("concurrency", 10, "Number of suitcases to restore at once")
+	if err := cmd.MarkFlagDirname("suitcase-dir"); err != nil {
+		panic(err)
+	}
+	if err := cmd.MarkFlagDirname("destination"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	dest, err := cmd.Flags().GetString("destination")
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		return errors.New("must set a --destination to restore in to")
+	}
+	suitcaseDir, err := cmd.Flags().GetString("suitcase-dir")
+	if err != nil {
+		return err
+	}
+	if suitcaseDir == "" {
+		suitcaseDir = filepath.Dir(args[0])
+	}
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+
+	inv, err := inventory.NewInventoryWithFilename(args[0])
+	if err != nil {
+		return err
+	}
+
+	p := porter.New(porter.WithInventory(inv))
+	p.SetConcurrency(concurrency)
+	p.SuitcaseOpts = &config.SuitCaseOpts{
+		Format:       inv.Options.SuitcaseFormat,
+		EncryptInner: inv.Options.EncryptInner,
+	}
+	if err := p.SuitcaseOpts.DecryptWithCobra(cmd); err != nil {
+		return err
+	}
+	if err := p.SuitcaseOpts.PasswordCobra(cmd); err != nil {
+		return err
+	}
+
+	return p.Restore(suitcaseDir, dest)
+}
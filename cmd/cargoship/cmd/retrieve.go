@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+
+	porter "github.com/scttfrdmn/cargoship/pkg"
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// NewRetrieveCmd creates the retrieve command for pulling individual files out of suitcases
+func NewRetrieveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retrieve INVENTORY_FILE GLOB",
+		Short: "Retrieve matching files from a set of suitcases",
+		Long: `Retrieve only the files matching a glob from the suitcases listed in an inventory.
+
+The glob is matched against each file's destination and name. Only the
+suitcases holding matching files are fetched, either from a local directory or
+from a transporter (rclone) destination, and only the matching entries are
+written out.
+
+Examples:
+  # Retrieve a single file from suitcases sitting next to the inventory
+  cargoship retrieve inventory.yaml 'raw/run-42/*.h5' --destination /path/to/restore
+
+  # Retrieve from a cloud destination
+  cargoship retrieve inventory.yaml 'calibration.dat' --source s3:bucket/project \
+    --destination /path/to/restore --private-key ~/.gnupg/private.key`,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: cobra.NoFileCompletions,
+		RunE:              runRetrieve,
+	}
+
+	cmd.Flags().String("source", "", "Local directory or rclone destination containing the suitcases. Defaults to the directory of the inventory file")
+	cmd.Flags().StringP("destination", "d", "", "Directory to restore files in to")
+	cmd.Flags().StringArray("private-key", []string{}, "Private gpg key used to decrypt suitcases. May be specified multiple times")
+	cmd.Flags().String("passphrase-file", "", "File containing the passphrase for the private key(s)")
+	cmd.Flags().String("password-file", "", "File containing the password for aes.zip suitcases. Defaults to the CARGOSHIP_SUITCASE_PASSWORD environment variable")
+	cmd.Flags().Int("concurrency", 10, "Number of suitcases to retrieve from at once")
+	if err := cmd.MarkFlagDirname("destination"); err != nil {
+		panic(err)
+	}
+
+	return cmd
+}
+
+func runRetrieve(cmd *cobra.Command, args []string) error {
+	dest, err := cmd.Flags().GetString("destination")
+	if err != nil {
+		return err
+	}
+	if dest == "" {
+		return errors.New("must set a --destination to retrieve in to")
+	}
+	source, err := cmd.Flags().GetString("source")
+	if err != nil {
+		return err
+	}
+	if source == "" {
+		source = filepath.Dir(args[0])
+	}
+	concurrency, err := cmd.Flags().GetInt("concurrency")
+	if err != nil {
+		return err
+	}
+
+	inv, err := inventory.NewInventoryWithFilename(args[0])
+	if err != nil {
+		return err
+	}
+
+	p := porter.New(porter.WithInventory(inv))
+	p.SetConcurrency(concurrency)
+	p.SuitcaseOpts = &config.SuitCaseOpts{
+		Format:       inv.Options.SuitcaseFormat,
+		EncryptInner: inv.Options.EncryptInner,
+	}
+	if err := p.SuitcaseOpts.DecryptWithCobra(cmd); err != nil {
+		return err
+	}
+	if err := p.SuitcaseOpts.PasswordCobra(cmd); err != nil {
+		return err
+	}
+
+	got, err := p.Retrieve(source, args[1], dest)
+	if err != nil {
+		return err
+	}
+	for _, item := range got {
+		fmt.Fprintln(cmd.OutOrStdout(), filepath.Join(dest, item))
+	}
+	return nil
+}
@@ -87,6 +87,10 @@ func NewRootCmdWithVersion(lo io.Writer, versionInfo string) *cobra.Command {
 		NewMetricsCmd(),
 		NewConfigCmd(),
 		NewBenchmarkCmd(),
+		NewRestoreCmd(),
+		NewRetrieveCmd(),
+		NewMigrateCmd(),
+		NewCatalogCmd(),
 	)
 	cmd.AddCommand(NewWizardCmd())
 	cmd.AddCommand(NewAnalyzeCmd())
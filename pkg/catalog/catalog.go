@@ -0,0 +1,650 @@
+/*
+Package catalog keeps a persistent index of many inventories, so files can be
+found across years of shipments without loading every inventory in to memory.
+
+The catalog is a bbolt database. Each inventory gets a record, and a bucket of
+its files keyed by destination. Names, hashes and modification times are also
+indexed, so the common lookups don't need to look at every file.
+*/
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+var (
+	inventoriesBucket = []byte("inventories")
+	filesBucket       = []byte("files")
+	namesBucket       = []byte("names")
+	hashesBucket      = []byte("hashes")
+	mtimesBucket      = []byte("mtimes")
+)
+
+// sep separates the parts of index keys. It can't show up in a path
+const sep = "\x00"
+
+// timeKeyFormat sorts the same as the times it formats
+const timeKeyFormat = "20060102T150405.000000000Z"
+
+// Catalog is a persistent index of inventories
+type Catalog struct {
+	db *bolt.DB
+}
+
+// InventoryRecord describes an inventory in the catalog
+type InventoryRecord struct {
+	// Path is the absolute path to the inventory file
+	Path string `json:"path"`
+	// Remote is where the suitcases for the inventory were sent
+	Remote string `json:"remote"`
+	// Project is the project field of the external metadata, or the suitcase
+	// prefix when there isn't one
+	Project   string `json:"project"`
+	User      string `json:"user"`
+	FileCount int    `json:"file_count"`
+	TotalSize int64  `json:"total_size"`
+	// ModTime and Size of the inventory file when it was added, used to skip
+	// inventories that haven't changed
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+	Added   time.Time `json:"added"`
+}
+
+// fileRecord is a file, as stored in the catalog
+type fileRecord struct {
+	Path        string    `json:"path"`
+	Destination string    `json:"destination"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Hash        string    `json:"hash,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+	Suitcases   []string  `json:"suitcases"`
+}
+
+// Hit is a file found by Search, along with where to get it back from
+type Hit struct {
+	Inventory   string    `json:"inventory"`
+	Project     string    `json:"project"`
+	Remote      string    `json:"remote"`
+	Suitcases   []string  `json:"suitcases"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination"`
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	Hash        string    `json:"hash,omitempty"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Open opens up the catalog in the file fn, creating it if needed. Close the
+// catalog when finished with it
+func Open(fn string) (*Catalog, error) {
+	if err := os.MkdirAll(filepath.Dir(fn), 0o750); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(fn, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("could not open catalog %v: %w", fn, err)
+	}
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, b := range [][]byte{inventoriesBucket, filesBucket, namesBucket, hashesBucket, mtimesBucket} {
+			if _, err := tx.CreateBucketIfNotExists(b); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &Catalog{db: db}, nil
+}
+
+// Close closes the underlying database
+func (c *Catalog) Close() error {
+	return c.db.Close()
+}
+
+// AddOptions changes how inventories are added to the catalog
+type AddOptions struct {
+	// Remote is where the suitcases were sent. Defaults to the directory
+	// holding the inventory
+	Remote string
+	// Project overrides the project found in the inventory
+	Project string
+	// Force re-adds inventories, even if they haven't changed
+	Force bool
+}
+
+// WithRemote records r as where the suitcases were sent
+func WithRemote(r string) func(*AddOptions) {
+	return func(o *AddOptions) {
+		o.Remote = r
+	}
+}
+
+// WithProject records p as the project of the inventory
+func WithProject(p string) func(*AddOptions) {
+	return func(o *AddOptions) {
+		o.Project = p
+	}
+}
+
+// WithForce re-adds inventories that are already up to date in the catalog
+func WithForce() func(*AddOptions) {
+	return func(o *AddOptions) {
+		o.Force = true
+	}
+}
+
+// Add ingests the inventory in fn, replacing anything already in the catalog
+// for it. The returned record is nil if the inventory was already up to date
+func (c *Catalog) Add(fn string, opts ...func(*AddOptions)) (*InventoryRecord, error) {
+	o := &AddOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	st, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !o.Force {
+		existing, err := c.Inventory(abs)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil && existing.Size == st.Size() && existing.ModTime.Equal(st.ModTime().UTC()) {
+			return nil, nil
+		}
+	}
+
+	var inv *inventory.Inventory
+	if inventory.IsNDJSONFilename(abs) {
+		inv, err = inventory.NewStreamingInventoryWithFilename(abs)
+	} else {
+		inv, err = inventory.NewInventoryWithFilename(abs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read inventory %v: %w", abs, err)
+	}
+	// Plenty of other YAML and JSON files read in without an error
+	if inv.Options == nil || inv.Options.SuitcaseFormat == "" {
+		return nil, fmt.Errorf("does not look like an inventory: %v", abs)
+	}
+
+	rec := &InventoryRecord{
+		Path:    abs,
+		Remote:  o.Remote,
+		Project: o.Project,
+		User:    inv.Options.User,
+		ModTime: st.ModTime().UTC(),
+		Size:    st.Size(),
+		Added:   time.Now().UTC(),
+	}
+	if rec.Remote == "" {
+		rec.Remote = filepath.Dir(abs)
+	}
+	if rec.Project == "" {
+		rec.Project = projectOf(inv)
+	}
+
+	if err := c.db.Update(func(tx *bolt.Tx) error {
+		if err := removeInventory(tx, abs); err != nil {
+			return err
+		}
+		_, err := tx.Bucket(filesBucket).CreateBucket([]byte(abs))
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if err := c.addFiles(inv, rec); err != nil {
+		// Don't leave the files from a partial add lying around
+		if rerr := c.db.Update(func(tx *bolt.Tx) error {
+			return removeInventory(tx, abs)
+		}); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	return rec, nil
+}
+
+// addBatchSize is the most files added to the catalog in a single
+// transaction, so huge inventories don't build up one enormous write
+var addBatchSize = 10000
+
+// addFiles adds the files of inv to the catalog, committing every
+// addBatchSize files. rec goes in with the last batch, so the inventory only
+// shows up in searches once all of its files are there
+func (c *Catalog) addFiles(inv *inventory.Inventory, rec *InventoryRecord) error {
+	var tx *bolt.Tx
+	defer func() {
+		if tx != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	begin := func() error {
+		var err error
+		tx, err = c.db.Begin(true)
+		return err
+	}
+	commit := func() error {
+		err := tx.Commit()
+		tx = nil
+		return err
+	}
+	if err := begin(); err != nil {
+		return err
+	}
+	var pending int
+	if err := inv.EachFile(func(f *inventory.File) error {
+		if pending == addBatchSize {
+			if err := commit(); err != nil {
+				return err
+			}
+			if err := begin(); err != nil {
+				return err
+			}
+			pending = 0
+		}
+		pending++
+		files := tx.Bucket(filesBucket).Bucket([]byte(rec.Path))
+		return addFile(tx, files, rec, f, inv.SuitcaseNameForFile(f))
+	}); err != nil {
+		return err
+	}
+	if err := putJSON(tx.Bucket(inventoriesBucket), []byte(rec.Path), rec); err != nil {
+		return err
+	}
+	return commit()
+}
+
+// AddDirs walks through dirs, adding every inventory found. Files that don't
+// load as inventories are skipped over, as are inventories that haven't
+// changed since they were last added. The number of inventories added is
+// returned
+func (c *Catalog) AddDirs(dirs []string, opts ...func(*AddOptions)) (int, error) {
+	var added int
+	for _, d := range dirs {
+		if err := filepath.WalkDir(d, func(path string, de fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if de.IsDir() || !isInventoryFilename(path) {
+				return nil
+			}
+			rec, err := c.Add(path, opts...)
+			if err != nil {
+				slog.Debug("ignoring file as it did not load as an inventory", "file", path, "error", err)
+				return nil
+			}
+			if rec != nil {
+				added++
+			}
+			return nil
+		}); err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
+
+func isInventoryFilename(s string) bool {
+	switch strings.ToLower(filepath.Ext(s)) {
+	case ".yaml", ".yml", ".json", ".ndjson", ".jsonl":
+		return true
+	default:
+		return false
+	}
+}
+
+// projectOf returns the project field from the external metadata, falling
+// back on the suitcase prefix
+func projectOf(inv *inventory.Inventory) string {
+	if p, ok := inv.MetadataFields["project"].(string); ok && p != "" {
+		return p
+	}
+	if inv.Options != nil {
+		return inv.Options.Prefix
+	}
+	return ""
+}
+
+func addFile(tx *bolt.Tx, files *bolt.Bucket, rec *InventoryRecord, f *inventory.File, suitcase string) error {
+	if f.Destination == "" {
+		return fmt.Errorf("file has no destination: %v", f.Path)
+	}
+	// Keyed on the source path, since the same destination can come from more
+	// than one top directory. Split files show up once per segment, in
+	// different suitcases, with the same path
+	key := []byte(f.Path)
+	if b := files.Get(key); b != nil {
+		var existing fileRecord
+		if err := json.Unmarshal(b, &existing); err != nil {
+			return err
+		}
+		existing.Suitcases = append(existing.Suitcases, suitcase)
+		return putJSON(files, key, existing)
+	}
+	fr := fileRecord{
+		Path:        f.Path,
+		Destination: f.Destination,
+		Name:        f.Name,
+		Size:        f.Size,
+		Hash:        f.Hash,
+		ModTime:     f.ModTime.UTC(),
+		Suitcases:   []string{suitcase},
+	}
+	if f.Segment != nil {
+		fr.Size = f.Segment.TotalSize
+	}
+	rec.FileCount++
+	rec.TotalSize += fr.Size
+	if err := putJSON(files, key, fr); err != nil {
+		return err
+	}
+	for bucket, k := range indexKeys(rec.Path, fr) {
+		if err := tx.Bucket([]byte(bucket)).Put([]byte(k), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// indexKeys returns the index keys of a file, keyed by the index bucket name
+func indexKeys(inv string, fr fileRecord) map[string]string {
+	suffix := sep + inv + sep + fr.Path
+	ret := map[string]string{
+		string(namesBucket):  strings.ToLower(fr.Name) + suffix,
+		string(mtimesBucket): fr.ModTime.UTC().Format(timeKeyFormat) + suffix,
+	}
+	if fr.Hash != "" {
+		ret[string(hashesBucket)] = strings.ToLower(fr.Hash) + suffix
+	}
+	return ret
+}
+
+// Remove takes the inventory at fn out of the catalog
+func (c *Catalog) Remove(fn string) error {
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return err
+	}
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(inventoriesBucket).Get([]byte(abs)) == nil {
+			return fmt.Errorf("inventory is not in the catalog: %v", abs)
+		}
+		return removeInventory(tx, abs)
+	})
+}
+
+func removeInventory(tx *bolt.Tx, abs string) error {
+	files := tx.Bucket(filesBucket).Bucket([]byte(abs))
+	if files != nil {
+		if err := files.ForEach(func(_, v []byte) error {
+			var fr fileRecord
+			if err := json.Unmarshal(v, &fr); err != nil {
+				return err
+			}
+			for bucket, k := range indexKeys(abs, fr) {
+				if err := tx.Bucket([]byte(bucket)).Delete([]byte(k)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := tx.Bucket(filesBucket).DeleteBucket([]byte(abs)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(inventoriesBucket).Delete([]byte(abs))
+}
+
+// Inventory returns the record for the inventory at fn, or nil if it isn't in
+// the catalog
+func (c *Catalog) Inventory(fn string) (*InventoryRecord, error) {
+	abs, err := filepath.Abs(fn)
+	if err != nil {
+		return nil, err
+	}
+	var ret *InventoryRecord
+	err = c.db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(inventoriesBucket).Get([]byte(abs))
+		if b == nil {
+			return nil
+		}
+		ret = &InventoryRecord{}
+		return json.Unmarshal(b, ret)
+	})
+	return ret, err
+}
+
+// Inventories returns every inventory in the catalog, ordered by path
+func (c *Catalog) Inventories() ([]*InventoryRecord, error) {
+	ret := []*InventoryRecord{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(inventoriesBucket).ForEach(func(_, v []byte) error {
+			var rec InventoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			ret = append(ret, &rec)
+			return nil
+		})
+	})
+	return ret, err
+}
+
+// Query describes the files to search for. Every field that is set must match
+type Query struct {
+	// Path is a glob matched against the original path and the destination of
+	// each file. Without any glob characters, it matches anywhere in either
+	Path string
+	// Name is the base name of the file, which may be a glob. Matching is case
+	// insensitive
+	Name string
+	// Hash is the hash of the file content
+	Hash string
+	// ModifiedAfter and ModifiedBefore limit the modification time of the files
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// Project is the project of the inventory
+	Project string
+}
+
+// IsEmpty returns true if nothing at all is set in the query
+func (q Query) IsEmpty() bool {
+	return q == Query{}
+}
+
+func (q Query) matches(fr fileRecord) bool {
+	if q.Path != "" && !matchesPath(q.Path, fr.Path) && !matchesPath(q.Path, fr.Destination) {
+		return false
+	}
+	if q.Name != "" {
+		if ok, _ := filepath.Match(strings.ToLower(q.Name), strings.ToLower(fr.Name)); !ok {
+			return false
+		}
+	}
+	if q.Hash != "" && !strings.EqualFold(q.Hash, fr.Hash) {
+		return false
+	}
+	if !q.ModifiedAfter.IsZero() && fr.ModTime.Before(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !fr.ModTime.Before(q.ModifiedBefore) {
+		return false
+	}
+	return true
+}
+
+func matchesPath(pattern, s string) bool {
+	if !hasGlob(pattern) {
+		return strings.Contains(s, pattern)
+	}
+	ok, _ := filepath.Match(pattern, s)
+	return ok
+}
+
+func hasGlob(s string) bool {
+	return strings.ContainsAny(s, `*?[\`)
+}
+
+// Search returns every file in the catalog matching q, ordered by inventory
+// and destination
+func (c *Catalog) Search(q Query) ([]*Hit, error) {
+	if q.IsEmpty() {
+		return nil, errors.New("must set something to search for")
+	}
+	ret := []*Hit{}
+	err := c.db.View(func(tx *bolt.Tx) error {
+		invs := map[string]*InventoryRecord{}
+		if err := tx.Bucket(inventoriesBucket).ForEach(func(k, v []byte) error {
+			var rec InventoryRecord
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return err
+			}
+			if q.Project == "" || strings.EqualFold(q.Project, rec.Project) {
+				invs[string(k)] = &rec
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		return eachCandidate(tx, q, invs, func(inv *InventoryRecord, fr fileRecord) error {
+			if !q.matches(fr) {
+				return nil
+			}
+			ret = append(ret, &Hit{
+				Inventory:   inv.Path,
+				Project:     inv.Project,
+				Remote:      inv.Remote,
+				Suitcases:   fr.Suitcases,
+				Path:        fr.Path,
+				Destination: fr.Destination,
+				Name:        fr.Name,
+				Size:        fr.Size,
+				Hash:        fr.Hash,
+				ModTime:     fr.ModTime,
+			})
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		if ret[i].Inventory != ret[j].Inventory {
+			return ret[i].Inventory < ret[j].Inventory
+		}
+		if ret[i].Destination != ret[j].Destination {
+			return ret[i].Destination < ret[j].Destination
+		}
+		return ret[i].Path < ret[j].Path
+	})
+	return ret, nil
+}
+
+// eachCandidate calls fn with every file that could match q, using an index
+// where one fits the query, and looking through every file where not
+func eachCandidate(tx *bolt.Tx, q Query, invs map[string]*InventoryRecord, fn func(*InventoryRecord, fileRecord) error) error {
+	fromIndex := func(bucket []byte, min, max string) error {
+		cur := tx.Bucket(bucket).Cursor()
+		for k, _ := cur.Seek([]byte(min)); k != nil && string(k) < max; k, _ = cur.Next() {
+			parts := strings.SplitN(string(k), sep, 3)
+			if len(parts) != 3 {
+				continue
+			}
+			inv, ok := invs[parts[1]]
+			if !ok {
+				continue
+			}
+			fr, err := getFile(tx, parts[1], parts[2])
+			if err != nil {
+				return err
+			}
+			if err := fn(inv, fr); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	switch {
+	case q.Hash != "":
+		h := strings.ToLower(q.Hash)
+		return fromIndex(hashesBucket, h+sep, h+sep+"\xff")
+	case q.Name != "" && !hasGlob(q.Name):
+		n := strings.ToLower(q.Name)
+		return fromIndex(namesBucket, n+sep, n+sep+"\xff")
+	case !q.ModifiedAfter.IsZero() || !q.ModifiedBefore.IsZero():
+		min, max := "", "\xff"
+		if !q.ModifiedAfter.IsZero() {
+			min = q.ModifiedAfter.UTC().Format(timeKeyFormat)
+		}
+		if !q.ModifiedBefore.IsZero() {
+			max = q.ModifiedBefore.UTC().Format(timeKeyFormat)
+		}
+		return fromIndex(mtimesBucket, min, max)
+	}
+	paths := make([]string, 0, len(invs))
+	for k := range invs {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		files := tx.Bucket(filesBucket).Bucket([]byte(p))
+		if files == nil {
+			continue
+		}
+		if err := files.ForEach(func(_, v []byte) error {
+			var fr fileRecord
+			if err := json.Unmarshal(v, &fr); err != nil {
+				return err
+			}
+			return fn(invs[p], fr)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getFile(tx *bolt.Tx, inv, fn string) (fileRecord, error) {
+	var fr fileRecord
+	files := tx.Bucket(filesBucket).Bucket([]byte(inv))
+	if files == nil {
+		return fr, fmt.Errorf("catalog is missing the files for %v", inv)
+	}
+	b := files.Get([]byte(fn))
+	if b == nil {
+		return fr, fmt.Errorf("catalog is missing %v from %v", fn, inv)
+	}
+	err := json.Unmarshal(b, &fr)
+	return fr, err
+}
+
+func putJSON(b *bolt.Bucket, k []byte, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, data)
+}
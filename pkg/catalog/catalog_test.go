@@ -0,0 +1,263 @@
+package catalog
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// writeInventory inventories a small tree of files, writing the inventory to
+// fn in the format matching the extension
+func writeInventory(t *testing.T, fn string, files map[string]string, opts ...func(*inventory.Options)) {
+	top := t.TempDir()
+	old := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	for name, content := range files {
+		p := path.Join(top, name)
+		require.NoError(t, os.MkdirAll(path.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o644))
+		require.NoError(t, os.Chtimes(p, old, old))
+	}
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(append([]func(*inventory.Options){
+		inventory.WithDirectories([]string{top}),
+		inventory.WithHashAlgorithms(inventory.MD5Hash),
+		inventory.WithHashFiles(),
+	}, opts...)...))
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(path.Dir(fn), 0o755))
+	out, err := os.Create(fn)
+	require.NoError(t, err)
+	ir, err := inventory.NewInventoryerWithFilename(fn)
+	require.NoError(t, err)
+	require.NoError(t, ir.Write(out, i))
+	require.NoError(t, out.Close())
+}
+
+func newTestCatalog(t *testing.T) (*Catalog, string) {
+	c, err := Open(path.Join(t.TempDir(), "catalog.db"))
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, c.Close()) })
+
+	invs := t.TempDir()
+	writeInventory(t, path.Join(invs, "2021", "inventory.yaml"), map[string]string{
+		"raw/run1.h5":   "run one",
+		"raw/run2.h5":   "run two",
+		"docs/README":   "readme",
+		"calibrate.dat": "calibration",
+	}, inventory.WithPrefix("genomics"))
+	writeInventory(t, path.Join(invs, "2022", "inventory.ndjson"), map[string]string{
+		"raw/run1.h5": "run one, again",
+		"notes.txt":   "readme",
+	}, inventory.WithPrefix("imaging"))
+	// Not inventories at all
+	require.NoError(t, os.WriteFile(path.Join(invs, "config.yaml"), []byte("foo: bar\n"), 0o600))
+	require.NoError(t, os.WriteFile(path.Join(invs, "notes.txt"), []byte("hi\n"), 0o600))
+	return c, invs
+}
+
+func destinations(hits []*Hit) []string {
+	ret := make([]string, len(hits))
+	for idx, h := range hits {
+		ret[idx] = path.Base(path.Dir(h.Inventory)) + ":" + h.Destination
+	}
+	return ret
+}
+
+func TestCatalogSearch(t *testing.T) {
+	c, invs := newTestCatalog(t)
+	added, err := c.AddDirs([]string{invs}, WithRemote("s3:archive/lab"))
+	require.NoError(t, err)
+	require.Equal(t, 2, added)
+
+	recs, err := c.Inventories()
+	require.NoError(t, err)
+	require.Equal(t, 2, len(recs))
+	require.Equal(t, "genomics", recs[0].Project)
+	require.Equal(t, 4, recs[0].FileCount)
+	require.Equal(t, "s3:archive/lab", recs[0].Remote)
+
+	tests := map[string]struct {
+		query  Query
+		expect []string
+	}{
+		"name": {
+			query:  Query{Name: "RUN1.h5"},
+			expect: []string{"2021:raw/run1.h5", "2022:raw/run1.h5"},
+		},
+		"name-glob": {
+			query:  Query{Name: "*.h5"},
+			expect: []string{"2021:raw/run1.h5", "2021:raw/run2.h5", "2022:raw/run1.h5"},
+		},
+		"path": {
+			query:  Query{Path: "docs/"},
+			expect: []string{"2021:docs/README"},
+		},
+		"path-glob": {
+			query:  Query{Path: "raw/run?.h5"},
+			expect: []string{"2021:raw/run1.h5", "2021:raw/run2.h5", "2022:raw/run1.h5"},
+		},
+		"hash-unknown": {
+			query:  Query{Hash: "00000000000000000000000000000000"},
+			expect: []string{},
+		},
+		"project": {
+			query:  Query{Project: "imaging"},
+			expect: []string{"2022:notes.txt", "2022:raw/run1.h5"},
+		},
+		"project-and-name": {
+			query:  Query{Project: "Genomics", Name: "run1.h5"},
+			expect: []string{"2021:raw/run1.h5"},
+		},
+		"date": {
+			query:  Query{ModifiedAfter: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), ModifiedBefore: time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), Name: "*.dat"},
+			expect: []string{"2021:calibrate.dat"},
+		},
+		"date-none": {
+			query:  Query{ModifiedAfter: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+			expect: []string{},
+		},
+	}
+	for desc, tt := range tests {
+		got, err := c.Search(tt.query)
+		require.NoError(t, err, desc)
+		require.Equal(t, tt.expect, destinations(got), desc)
+	}
+
+	got, err := c.Search(Query{Name: "run2.h5"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(got))
+	require.Equal(t, "s3:archive/lab", got[0].Remote)
+	require.Equal(t, 1, len(got[0].Suitcases))
+	require.Regexp(t, `^genomics-.*-01-of-01\.tar\.zst$`, got[0].Suitcases[0])
+
+	// Same content, found by hash in both inventories
+	got, err = c.Search(Query{Name: "README"})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(got))
+	got, err = c.Search(Query{Hash: got[0].Hash})
+	require.NoError(t, err)
+	require.Equal(t, []string{"2021:docs/README", "2022:notes.txt"}, destinations(got))
+
+	_, err = c.Search(Query{})
+	require.EqualError(t, err, "must set something to search for")
+}
+
+func TestCatalogReAdd(t *testing.T) {
+	c, invs := newTestCatalog(t)
+	fn := path.Join(invs, "2021", "inventory.yaml")
+	rec, err := c.Add(fn)
+	require.NoError(t, err)
+	require.NotNil(t, rec)
+	require.Equal(t, path.Join(invs, "2021"), rec.Remote)
+
+	// Unchanged inventories are skipped
+	rec, err = c.Add(fn)
+	require.NoError(t, err)
+	require.Nil(t, rec)
+
+	// Changed inventories replace what was there before
+	writeInventory(t, fn, map[string]string{"only.txt": "only"})
+	rec, err = c.Add(fn, WithForce(), WithProject("replaced"))
+	require.NoError(t, err)
+	require.Equal(t, "replaced", rec.Project)
+	got, err := c.Search(Query{Name: "run1.h5"})
+	require.NoError(t, err)
+	require.Empty(t, got)
+	got, err = c.Search(Query{Path: "only"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"2021:only.txt"}, destinations(got))
+
+	require.NoError(t, c.Remove(fn))
+	got, err = c.Search(Query{Path: "only"})
+	require.NoError(t, err)
+	require.Empty(t, got)
+	require.EqualError(t, c.Remove(fn), "inventory is not in the catalog: "+fn)
+
+	_, err = c.Add(path.Join(invs, "config.yaml"))
+	require.EqualError(t, err, "does not look like an inventory: "+path.Join(invs, "config.yaml"))
+}
+
+func TestCatalogAddBatches(t *testing.T) {
+	orig := addBatchSize
+	defer func() { addBatchSize = orig }()
+	addBatchSize = 2
+
+	c, invs := newTestCatalog(t)
+	fn := path.Join(invs, "2021", "inventory.yaml")
+	rec, err := c.Add(fn)
+	require.NoError(t, err)
+	require.Equal(t, 4, rec.FileCount)
+	got, err := c.Search(Query{Project: "genomics"})
+	require.NoError(t, err)
+	require.Equal(t, 4, len(got))
+
+	// A file that can't be added takes the earlier batches out with it
+	bad := path.Join(invs, "bad.json")
+	out, err := os.Create(bad)
+	require.NoError(t, err)
+	require.NoError(t, (&inventory.JSONer{}).Write(out, &inventory.Inventory{
+		SchemaVersion: inventory.SchemaVersion,
+		Options:       &inventory.Options{SuitcaseFormat: "tar"},
+		TotalIndexes:  1,
+		Files: []*inventory.File{
+			{Path: "/a", Destination: "a", Name: "a", SuitcaseIndex: 1},
+			{Path: "/b", Destination: "b", Name: "b", SuitcaseIndex: 1},
+			{Path: "/c", Destination: "c", Name: "c", SuitcaseIndex: 1},
+			{Path: "/d", Name: "d", SuitcaseIndex: 1},
+		},
+	}))
+	require.NoError(t, out.Close())
+	_, err = c.Add(bad)
+	require.Error(t, err)
+	missing, err := c.Inventory(bad)
+	require.NoError(t, err)
+	require.Nil(t, missing)
+	require.NoError(t, c.db.View(func(tx *bolt.Tx) error {
+		require.Nil(t, tx.Bucket(filesBucket).Bucket([]byte(bad)))
+		require.Nil(t, tx.Bucket(namesBucket).Get([]byte("a"+sep+bad+sep+"/a")))
+		return nil
+	}))
+}
+
+func TestCatalogSameDestination(t *testing.T) {
+	c, err := Open(path.Join(t.TempDir(), "catalog.db"))
+	require.NoError(t, err)
+	defer func() { require.NoError(t, c.Close()) }()
+
+	// The same relative path under two top directories
+	tops := []string{t.TempDir(), t.TempDir()}
+	for idx, top := range tops {
+		require.NoError(t, os.WriteFile(path.Join(top, "same.txt"), []byte(top), 0o644))
+		require.NoError(t, os.WriteFile(path.Join(top, "other.txt"), []byte{byte(idx)}, 0o644))
+	}
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories(tops),
+		inventory.WithHashAlgorithms(inventory.MD5Hash),
+		inventory.WithHashFiles(),
+	))
+	require.NoError(t, err)
+	fn := path.Join(t.TempDir(), "inventory.yaml")
+	out, err := os.Create(fn)
+	require.NoError(t, err)
+	ir, err := inventory.NewInventoryerWithFilename(fn)
+	require.NoError(t, err)
+	require.NoError(t, ir.Write(out, i))
+	require.NoError(t, out.Close())
+
+	rec, err := c.Add(fn)
+	require.NoError(t, err)
+	require.Equal(t, 4, rec.FileCount)
+
+	for _, q := range []Query{{Name: "same.txt"}, {Path: "same.txt"}} {
+		got, err := c.Search(q)
+		require.NoError(t, err)
+		require.Equal(t, 2, len(got))
+		paths := []string{got[0].Path, got[1].Path}
+		require.ElementsMatch(t, []string{path.Join(tops[0], "same.txt"), path.Join(tops[1], "same.txt")}, paths)
+	}
+}
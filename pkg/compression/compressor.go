@@ -25,6 +25,7 @@ const (
 	AlgorithmZstd Algorithm = "zstd"
 	AlgorithmLZ4  Algorithm = "lz4"
 	AlgorithmS2   Algorithm = "s2"
+	AlgorithmXZ   Algorithm = "xz"
 )
 
 // Level represents compression level
@@ -40,9 +41,11 @@ const (
 
 // Compressor provides compression and decompression functionality
 type Compressor struct {
-	algorithm Algorithm
-	level     Level
-	blockSize int64
+	algorithm   Algorithm
+	level       Level
+	blockSize   int64
+	concurrency int
+	windowSize  int64
 
 	// Reusable pools for better performance
 	gzipWriterPool *sync.Pool
@@ -66,15 +69,19 @@ type CompressionResult struct {
 	CompressionRatio float64  `json:"compression_ratio"`
 	CompressionTime  int64    `json:"compression_time_ms"`
 	Throughput      float64   `json:"throughput_mbps"`
+	SuitcaseFormat   string    `json:"suitcase_format,omitempty"`
 }
 
 // NewCompressor creates a new compressor with the specified algorithm and level
-func NewCompressor(algorithm Algorithm, level Level) (*Compressor, error) {
+func NewCompressor(algorithm Algorithm, level Level, opts ...Option) (*Compressor, error) {
 	c := &Compressor{
 		algorithm: algorithm,
 		level:     level,
 		blockSize: 64 * 1024, // 64KB default block size
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
 
 	// Initialize pools based on algorithm
 	switch algorithm {
@@ -90,7 +97,7 @@ func NewCompressor(algorithm Algorithm, level Level) (*Compressor, error) {
 		c.initS2Pools()
 	case AlgorithmLZ4:
 		c.initLZ4Pools()
-	case AlgorithmNone:
+	case AlgorithmNone, AlgorithmXZ:
 		// No initialization needed
 	default:
 		return nil, fmt.Errorf("unsupported compression algorithm: %s", algorithm)
@@ -123,6 +130,8 @@ func (c *Compressor) Compress(data io.Reader) (io.Reader, *CompressionResult, er
 		originalSize, err = c.compressS2(data, &buf)
 	case AlgorithmLZ4:
 		originalSize, err = c.compressLZ4(data, &buf)
+	case AlgorithmXZ:
+		originalSize, err = c.compressXZ(data, &buf)
 	default:
 		return nil, nil, fmt.Errorf("unsupported compression algorithm: %s", c.algorithm)
 	}
@@ -142,6 +151,7 @@ func (c *Compressor) Compress(data io.Reader) (io.Reader, *CompressionResult, er
 		CompressionRatio: float64(originalSize) / float64(compressedSize),
 		CompressionTime:  compressionTime.Milliseconds(),
 		Throughput:      float64(originalSize) / (1024 * 1024) / compressionTime.Seconds(),
+		SuitcaseFormat:   c.algorithm.SuitcaseFormat(),
 	}
 
 	return bytes.NewReader(buf.Bytes()), result, nil
@@ -165,6 +175,8 @@ func (c *Compressor) Decompress(data io.Reader) (io.Reader, error) {
 		err = c.decompressS2(data, &buf)
 	case AlgorithmLZ4:
 		err = c.decompressLZ4(data, &buf)
+	case AlgorithmXZ:
+		err = c.decompressXZ(data, &buf)
 	default:
 		return nil, fmt.Errorf("unsupported compression algorithm: %s", c.algorithm)
 	}
@@ -185,6 +197,7 @@ func GetSupportedAlgorithms() []Algorithm {
 		AlgorithmZstd,
 		AlgorithmLZ4,
 		AlgorithmS2,
+		AlgorithmXZ,
 	}
 }
 
@@ -196,7 +209,7 @@ func BenchmarkCompression(data io.Reader, dataSize int64) ([]CompressionResult,
 		return nil, fmt.Errorf("failed to read data: %w", err)
 	}
 
-	algorithms := []Algorithm{AlgorithmGzip, AlgorithmZlib, AlgorithmZstd, AlgorithmLZ4, AlgorithmS2}
+	algorithms := []Algorithm{AlgorithmGzip, AlgorithmZlib, AlgorithmZstd, AlgorithmLZ4, AlgorithmS2, AlgorithmXZ}
 	levels := []Level{LevelFast, LevelDefault, LevelBest}
 	
 	var results []CompressionResult
@@ -280,24 +293,7 @@ func (c *Compressor) initZlibPools() {
 
 // initZstdCodec initializes zstd encoder and decoder
 func (c *Compressor) initZstdCodec() error {
-	// Convert our level to zstd level
-	var zstdLevel zstd.EncoderLevel
-	switch c.level {
-	case LevelFastest:
-		zstdLevel = zstd.SpeedFastest
-	case LevelFast:
-		zstdLevel = zstd.SpeedDefault
-	case LevelDefault:
-		zstdLevel = zstd.SpeedDefault
-	case LevelBetter:
-		zstdLevel = zstd.SpeedBetterCompression
-	case LevelBest:
-		zstdLevel = zstd.SpeedBestCompression
-	default:
-		zstdLevel = zstd.SpeedDefault
-	}
-
-	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstdLevel))
+	encoder, err := zstd.NewWriter(nil, c.zstdOptions()...)
 	if err != nil {
 		return fmt.Errorf("failed to create zstd encoder: %w", err)
 	}
@@ -316,7 +312,7 @@ func (c *Compressor) initZstdCodec() error {
 func (c *Compressor) initS2Pools() {
 	c.s2WriterPool = &sync.Pool{
 		New: func() interface{} {
-			return s2.NewWriter(nil)
+			return s2.NewWriter(nil, c.s2Options()...)
 		},
 	}
 
@@ -331,7 +327,10 @@ func (c *Compressor) initS2Pools() {
 func (c *Compressor) initLZ4Pools() {
 	c.lz4WriterPool = &sync.Pool{
 		New: func() interface{} {
-			return lz4.NewWriter(nil)
+			w := lz4.NewWriter(nil)
+			// The options are checked before they get here
+			_ = w.Apply(c.lz4Options()...)
+			return w
 		},
 	}
 
@@ -299,6 +299,7 @@ func TestGetSupportedAlgorithms(t *testing.T) {
 		AlgorithmZstd,
 		AlgorithmLZ4,
 		AlgorithmS2,
+		AlgorithmXZ,
 	}
 
 	if len(algorithms) != len(expected) {
@@ -520,6 +521,9 @@ func TestAlgorithmConstants(t *testing.T) {
 	if AlgorithmS2 != "s2" {
 		t.Errorf("AlgorithmS2 = %v, want 's2'", AlgorithmS2)
 	}
+	if AlgorithmXZ != "xz" {
+		t.Errorf("AlgorithmXZ = %v, want 'xz'", AlgorithmXZ)
+	}
 }
 
 func TestLevelConstants(t *testing.T) {
@@ -0,0 +1,166 @@
+package compression
+
+import (
+	"math/bits"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Option configures a Compressor
+type Option func(*Compressor)
+
+// WithConcurrency sets how many goroutines the gzip, lz4, s2 and zstd encoders
+// may use at once. xz only ever uses one. 0 leaves each at its own default
+func WithConcurrency(n int) Option {
+	return func(c *Compressor) {
+		c.concurrency = max(n, 0)
+	}
+}
+
+// WithWindowSize sets the window, or block, size in bytes for the algorithms
+// that have one. Sizes an algorithm can't use are moved to the closest one it
+// can. 0 leaves each at its own default
+func WithWindowSize(n int64) Option {
+	return func(c *Compressor) {
+		c.windowSize = max(n, 0)
+	}
+}
+
+// DefaultWindowSize returns the window, or block, size an algorithm uses when
+// none is given
+func DefaultWindowSize(a Algorithm) int64 {
+	switch a {
+	case AlgorithmGzip, AlgorithmS2:
+		return 1 << 20
+	case AlgorithmLZ4:
+		return 4 << 20
+	case AlgorithmZstd, AlgorithmXZ:
+		return 8 << 20
+	default:
+		return 0
+	}
+}
+
+// EncoderMemory estimates how much memory each concurrent encoder for an
+// algorithm holds on to, using the given window size, or the default for 0.
+// Each encoder keeps roughly a window of input and one of output around
+func EncoderMemory(a Algorithm, window int64) int64 {
+	if window <= 0 {
+		window = DefaultWindowSize(a)
+	}
+	switch a {
+	case AlgorithmNone:
+		return 0
+	case AlgorithmGzip, AlgorithmZlib:
+		// Deflate has its own state on top of the blocks
+		return 2*window + 1<<20
+	case AlgorithmXZ:
+		// The match finder needs several times the dictionary
+		return 4 * window
+	default:
+		return 2 * window
+	}
+}
+
+// ZstdLevel converts a Level to the closest zstd encoder level
+func ZstdLevel(l Level) zstd.EncoderLevel {
+	switch {
+	case l <= 0:
+		return zstd.SpeedDefault
+	case l <= LevelFastest:
+		return zstd.SpeedFastest
+	case l <= LevelDefault:
+		return zstd.SpeedDefault
+	case l <= LevelBetter:
+		return zstd.SpeedBetterCompression
+	default:
+		return zstd.SpeedBestCompression
+	}
+}
+
+// ZstdWindowSize moves n to the closest window size zstd can use, which is a
+// power of two between zstd.MinWindowSize and zstd.MaxWindowSize
+func ZstdWindowSize(n int64) int {
+	switch {
+	case n <= zstd.MinWindowSize:
+		return zstd.MinWindowSize
+	case n >= zstd.MaxWindowSize:
+		return zstd.MaxWindowSize
+	}
+	// Round up to the next power of two
+	return 1 << bits.Len64(uint64(n-1)) // nolint:gosec
+}
+
+func (c *Compressor) zstdOptions() []zstd.EOption {
+	opts := []zstd.EOption{zstd.WithEncoderLevel(ZstdLevel(c.level))}
+	if c.concurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(c.concurrency))
+	}
+	if c.windowSize > 0 {
+		opts = append(opts, zstd.WithWindowSize(ZstdWindowSize(c.windowSize)))
+	}
+	return opts
+}
+
+func (c *Compressor) s2Options() []s2.WriterOption {
+	var opts []s2.WriterOption
+	switch {
+	case c.level >= LevelBest:
+		opts = append(opts, s2.WriterBestCompression())
+	case c.level >= LevelBetter:
+		opts = append(opts, s2.WriterBetterCompression())
+	}
+	if c.concurrency > 0 {
+		opts = append(opts, s2.WriterConcurrency(c.concurrency))
+	}
+	if c.windowSize > 0 {
+		// s2 blocks go from 4KiB to 4MiB
+		opts = append(opts, s2.WriterBlockSize(int(min(max(c.windowSize, 4<<10), 4<<20))))
+	}
+	return opts
+}
+
+func (c *Compressor) lz4Options() []lz4.Option {
+	var opts []lz4.Option
+	// lz4 is all about speed, so the slower high compression mode is only
+	// used above the default level
+	if c.level > LevelDefault {
+		opts = append(opts, lz4.CompressionLevelOption(lz4.Level1<<(min(c.level, LevelBest)-1)))
+	}
+	if c.concurrency > 0 {
+		opts = append(opts, lz4.ConcurrencyOption(c.concurrency))
+	}
+	if c.windowSize > 0 {
+		// The largest block size that fits in the window
+		size := lz4.Block64Kb
+		for _, s := range []lz4.BlockSize{lz4.Block256Kb, lz4.Block1Mb, lz4.Block4Mb} {
+			if int64(s) <= c.windowSize {
+				size = s
+			}
+		}
+		opts = append(opts, lz4.BlockSizeOption(size))
+	}
+	return opts
+}
+
+// xzDictCaps are the dictionary sizes the xz command line tool uses for each
+// of its preset levels, from 1 to 9
+var xzDictCaps = [...]int{1 << 20, 2 << 20, 4 << 20, 4 << 20, 8 << 20, 8 << 20, 16 << 20, 32 << 20, 64 << 20}
+
+// xzConfig only has a dictionary size to set, so the level picks one the same
+// way the xz presets do, unless a window size was given. The encoder is single
+// threaded, so there's nothing for the concurrency to do
+func (c *Compressor) xzConfig() xz.WriterConfig {
+	var conf xz.WriterConfig
+	switch {
+	case c.windowSize > 0:
+		// xz needs a dictionary of at least 4KiB, and can't go past 4GiB
+		conf.DictCap = int(min(max(c.windowSize, 4<<10), 1<<32-1))
+	case c.level > 0:
+		conf.DictCap = xzDictCaps[min(c.level, LevelBest)-1]
+	}
+	return conf
+}
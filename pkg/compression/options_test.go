@@ -0,0 +1,106 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestZstdWindowSize(t *testing.T) {
+	tests := []struct {
+		in   int64
+		want int
+	}{
+		{0, zstd.MinWindowSize},
+		{1, zstd.MinWindowSize},
+		{1 << 20, 1 << 20},
+		{1<<20 + 1, 2 << 20},
+		{3 << 20, 4 << 20},
+		{1 << 40, zstd.MaxWindowSize},
+	}
+	for _, tt := range tests {
+		if got := ZstdWindowSize(tt.in); got != tt.want {
+			t.Errorf("ZstdWindowSize(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestEncoderMemory(t *testing.T) {
+	if got := EncoderMemory(AlgorithmNone, 1<<20); got != 0 {
+		t.Errorf("EncoderMemory(none) = %v, want 0", got)
+	}
+	if got := EncoderMemory(AlgorithmZstd, 0); got != 2*DefaultWindowSize(AlgorithmZstd) {
+		t.Errorf("EncoderMemory(zstd) = %v, want twice the default window", got)
+	}
+	for _, alg := range GetSupportedAlgorithms() {
+		if alg == AlgorithmNone {
+			continue
+		}
+		if EncoderMemory(alg, 16<<20) <= EncoderMemory(alg, 1<<20) {
+			t.Errorf("EncoderMemory(%v) should grow with the window", alg)
+		}
+	}
+}
+
+func TestXZConfig(t *testing.T) {
+	tests := []struct {
+		level  Level
+		window int64
+		want   int
+	}{
+		{0, 0, 0},
+		{LevelFastest, 0, 1 << 20},
+		{LevelDefault, 0, 8 << 20},
+		{LevelBest, 0, 64 << 20},
+		{LevelBest, 1 << 20, 1 << 20},
+		{LevelFastest, 1, 4 << 10},
+	}
+	for _, tt := range tests {
+		c, err := NewCompressor(AlgorithmXZ, tt.level, WithWindowSize(tt.window))
+		if err != nil {
+			t.Fatalf("NewCompressor() error = %v", err)
+		}
+		if got := c.xzConfig().DictCap; got != tt.want {
+			t.Errorf("xzConfig(%v, %v).DictCap = %v, want %v", tt.level, tt.window, got, tt.want)
+		}
+	}
+}
+
+func TestCompressor_Options(t *testing.T) {
+	testData := strings.Repeat("Options change how, not what, gets compressed. ", 20000)
+	for _, alg := range GetSupportedAlgorithms() {
+		for _, level := range []Level{LevelFastest, LevelBest} {
+			comp, err := NewCompressor(alg, level, WithConcurrency(4), WithWindowSize(64<<10))
+			if err != nil {
+				t.Fatalf("NewCompressor(%v) error = %v", alg, err)
+			}
+			var buf bytes.Buffer
+			w, err := comp.NewWriter(&buf)
+			if err != nil {
+				t.Fatalf("NewWriter(%v, %v) error = %v", alg, level, err)
+			}
+			if _, err := io.Copy(w, strings.NewReader(testData)); err != nil {
+				t.Fatalf("Write(%v, %v) error = %v", alg, level, err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close(%v, %v) error = %v", alg, level, err)
+			}
+
+			r, err := comp.NewReader(&buf)
+			if err != nil {
+				t.Fatalf("NewReader(%v, %v) error = %v", alg, level, err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("Read(%v, %v) error = %v", alg, level, err)
+			}
+			_ = r.Close()
+			if string(got) != testData {
+				t.Errorf("Round trip through %v at level %v does not match", alg, level)
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package compression
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/klauspost/compress/s2"
+	"github.com/klauspost/compress/zstd"
+	"github.com/klauspost/pgzip"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// suitcaseFormats maps algorithms to the suitcase format that uses them
+var suitcaseFormats = map[Algorithm]string{
+	AlgorithmNone: "tar",
+	AlgorithmGzip: "tar.gz",
+	AlgorithmZstd: "tar.zst",
+	AlgorithmLZ4:  "tar.lz4",
+	AlgorithmS2:   "tar.s2",
+	AlgorithmXZ:   "tar.xz",
+}
+
+// SuitcaseFormat returns the suitcase format compressed with this algorithm,
+// or an empty string if there isn't one
+func (a Algorithm) SuitcaseFormat() string {
+	return suitcaseFormats[a]
+}
+
+// NewWriter returns a writer that streams compressed data in to dst. Closing
+// it flushes everything out, but does not close dst. Unlike Compress, nothing
+// is held in memory, so it is safe to use on entire suitcases
+func (c *Compressor) NewWriter(dst io.Writer) (io.WriteCloser, error) {
+	switch c.algorithm {
+	case AlgorithmNone:
+		return nopWriteCloser{dst}, nil
+	case AlgorithmGzip:
+		// pgzip writes regular gzip, using every core to do it
+		return c.newPgzipWriter(dst)
+	case AlgorithmZlib:
+		w := c.zlibWriterPool.Get().(*zlib.Writer)
+		w.Reset(dst)
+		return &pooledWriter{WriteCloser: w, pool: c.zlibWriterPool}, nil
+	case AlgorithmZstd:
+		// The shared encoder can only do one thing at a time
+		w, err := zstd.NewWriter(dst, c.zstdOptions()...)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	case AlgorithmS2:
+		w := c.s2WriterPool.Get().(*s2.Writer)
+		w.Reset(dst)
+		return &pooledWriter{WriteCloser: w, pool: c.s2WriterPool}, nil
+	case AlgorithmLZ4:
+		w := c.lz4WriterPool.Get().(*lz4.Writer)
+		w.Reset(dst)
+		return &pooledWriter{WriteCloser: w, pool: c.lz4WriterPool}, nil
+	case AlgorithmXZ:
+		w, err := c.xzConfig().NewWriter(dst)
+		if err != nil {
+			return nil, err
+		}
+		return w, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", c.algorithm)
+	}
+}
+
+func (c *Compressor) newPgzipWriter(dst io.Writer) (io.WriteCloser, error) {
+	w, err := pgzip.NewWriterLevel(dst, int(c.level))
+	if err != nil {
+		return nil, err
+	}
+	if c.concurrency == 0 && c.windowSize == 0 {
+		return w, nil
+	}
+	blocks := c.concurrency
+	if blocks == 0 {
+		blocks = runtime.GOMAXPROCS(0)
+	}
+	window := c.windowSize
+	if window == 0 {
+		window = DefaultWindowSize(AlgorithmGzip)
+	}
+	// pgzip needs blocks bigger than the 16KiB it carries over between them
+	if err := w.SetConcurrency(int(min(max(window, 64<<10), 1<<30)), blocks); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// NewReader returns a reader that streams decompressed data out of src
+func (c *Compressor) NewReader(src io.Reader) (io.ReadCloser, error) {
+	switch c.algorithm {
+	case AlgorithmNone:
+		return io.NopCloser(src), nil
+	case AlgorithmGzip:
+		r, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case AlgorithmZlib:
+		return zlib.NewReader(src)
+	case AlgorithmZstd:
+		r, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return r.IOReadCloser(), nil
+	case AlgorithmS2:
+		r := c.s2ReaderPool.Get().(*s2.Reader)
+		r.Reset(src)
+		return &pooledReader{Reader: r, put: func() {
+			r.Reset(nil)
+			c.s2ReaderPool.Put(r)
+		}}, nil
+	case AlgorithmLZ4:
+		r := c.lz4ReaderPool.Get().(*lz4.Reader)
+		r.Reset(src)
+		return &pooledReader{Reader: r, put: func() {
+			r.Reset(nil)
+			c.lz4ReaderPool.Put(r)
+		}}, nil
+	case AlgorithmXZ:
+		r, err := xz.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression algorithm: %s", c.algorithm)
+	}
+}
+
+// compressXZ and decompressXZ go through the streaming versions, since xz has
+// nothing worth pooling
+func (c *Compressor) compressXZ(src io.Reader, dst io.Writer) (int64, error) {
+	w, err := c.NewWriter(dst)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(w, src)
+	if err != nil {
+		return 0, err
+	}
+	return written, w.Close()
+}
+
+func (c *Compressor) decompressXZ(src io.Reader, dst io.Writer) error {
+	r, err := c.NewReader(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = r.Close() }()
+	_, err = io.Copy(dst, r)
+	return err
+}
+
+// pooledWriter hands the writer back to its pool once it is closed
+type pooledWriter struct {
+	io.WriteCloser
+	pool *sync.Pool
+	once sync.Once
+}
+
+func (p *pooledWriter) Close() error {
+	err := p.WriteCloser.Close()
+	p.once.Do(func() { p.pool.Put(p.WriteCloser) })
+	return err
+}
+
+// pooledReader hands the reader back to its pool once it is closed
+type pooledReader struct {
+	io.Reader
+	put  func()
+	once sync.Once
+}
+
+func (p *pooledReader) Close() error {
+	p.once.Do(p.put)
+	return nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,98 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestCompressor_Stream(t *testing.T) {
+	testData := strings.Repeat("Streaming data through a suitcase, one block at a time. ", 2000)
+	for _, alg := range GetSupportedAlgorithms() {
+		t.Run(string(alg), func(t *testing.T) {
+			comp, err := NewCompressor(alg, LevelDefault)
+			if err != nil {
+				t.Fatalf("NewCompressor() error = %v", err)
+			}
+
+			// Twice, so pooled writers and readers get reused
+			for i := 0; i < 2; i++ {
+				var buf bytes.Buffer
+				w, err := comp.NewWriter(&buf)
+				if err != nil {
+					t.Fatalf("NewWriter() error = %v", err)
+				}
+				if _, err := io.Copy(w, strings.NewReader(testData)); err != nil {
+					t.Fatalf("Write error = %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+				if alg != AlgorithmNone && buf.Len() >= len(testData) {
+					t.Errorf("Compressed size %v is not smaller than %v", buf.Len(), len(testData))
+				}
+
+				r, err := comp.NewReader(&buf)
+				if err != nil {
+					t.Fatalf("NewReader() error = %v", err)
+				}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatalf("ReadAll() error = %v", err)
+				}
+				if err := r.Close(); err != nil {
+					t.Errorf("Close() error = %v", err)
+				}
+				if string(got) != testData {
+					t.Errorf("Decompressed data doesn't match original")
+				}
+			}
+		})
+	}
+}
+
+func TestCompressor_Compress_XZ(t *testing.T) {
+	comp, err := NewCompressor(AlgorithmXZ, LevelDefault)
+	if err != nil {
+		t.Fatalf("NewCompressor() error = %v", err)
+	}
+
+	testData := strings.Repeat("1234567890", 1000)
+	compressed, result, err := comp.Compress(strings.NewReader(testData))
+	if err != nil {
+		t.Fatalf("Compress() error = %v", err)
+	}
+	if result.Algorithm != AlgorithmXZ {
+		t.Errorf("Result algorithm = %v, want %v", result.Algorithm, AlgorithmXZ)
+	}
+
+	decompressed, err := comp.Decompress(compressed)
+	if err != nil {
+		t.Fatalf("Decompress() error = %v", err)
+	}
+	got, err := io.ReadAll(decompressed)
+	if err != nil {
+		t.Errorf("ReadAll() error = %v", err)
+	}
+	if string(got) != testData {
+		t.Errorf("Decompressed data doesn't match original")
+	}
+}
+
+func TestAlgorithm_SuitcaseFormat(t *testing.T) {
+	tests := map[Algorithm]string{
+		AlgorithmNone: "tar",
+		AlgorithmGzip: "tar.gz",
+		AlgorithmZlib: "",
+		AlgorithmZstd: "tar.zst",
+		AlgorithmLZ4:  "tar.lz4",
+		AlgorithmS2:   "tar.s2",
+		AlgorithmXZ:   "tar.xz",
+	}
+	for alg, want := range tests {
+		if got := alg.SuitcaseFormat(); got != want {
+			t.Errorf("%v.SuitcaseFormat() = %v, want %v", alg, got, want)
+		}
+	}
+}
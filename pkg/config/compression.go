@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"sync"
+
+	"github.com/dustin/go-humanize"
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/compression"
+)
+
+// MaxCompressionLevel is the highest, and slowest, compression level
+const MaxCompressionLevel = 9
+
+// memoryLimit returns the limit set with --memory-limit, without changing it
+var memoryLimit = func() int64 {
+	return debug.SetMemoryLimit(-1)
+}
+
+// CompressionCobra fills in the compression options from the
+// compression-level, compression-concurrency and compression-window flags,
+// for the ones the command has
+func (s *SuitCaseOpts) CompressionCobra(cmd *cobra.Command) error {
+	if cmd == nil {
+		return nil
+	}
+	if cmd.Flags().Lookup("compression-level") != nil {
+		level, err := cmd.Flags().GetInt("compression-level")
+		if err != nil {
+			return err
+		}
+		s.CompressionLevel = level
+	}
+	if cmd.Flags().Lookup("compression-concurrency") != nil {
+		concurrency, err := cmd.Flags().GetInt("compression-concurrency")
+		if err != nil {
+			return err
+		}
+		s.CompressionConcurrency = concurrency
+	}
+	if cmd.Flags().Lookup("compression-window") != nil {
+		window, err := cmd.Flags().GetString("compression-window")
+		if err != nil {
+			return err
+		}
+		if window != "" {
+			b, err := humanize.ParseBytes(window)
+			if err != nil {
+				return fmt.Errorf("invalid compression window %v: %w", window, err)
+			}
+			if b > math.MaxInt64 {
+				return fmt.Errorf("compression window is too large: %v", window)
+			}
+			s.CompressionWindow = int64(b)
+		}
+	}
+	return s.ValidateCompression()
+}
+
+// ValidateCompression returns an error if any of the compression options are
+// out of range
+func (s *SuitCaseOpts) ValidateCompression() error {
+	if s.CompressionLevel < 0 || s.CompressionLevel > MaxCompressionLevel {
+		return fmt.Errorf("compression level must be between 1 and %v, or 0 for the default", MaxCompressionLevel)
+	}
+	if s.CompressionConcurrency < 0 {
+		return fmt.Errorf("compression concurrency can not be negative")
+	}
+	if s.CompressionWindow < 0 {
+		return fmt.Errorf("compression window can not be negative")
+	}
+	return nil
+}
+
+// CompressionLevelOr returns the compression level, or def when it isn't set
+func (s *SuitCaseOpts) CompressionLevelOr(def int) int {
+	if s.CompressionLevel == 0 {
+		return def
+	}
+	return s.CompressionLevel
+}
+
+// Compressor returns a compressor for algorithm using the compression options,
+// with defaultLevel when no level is set
+func (s *SuitCaseOpts) Compressor(algorithm compression.Algorithm, defaultLevel compression.Level) (*compression.Compressor, error) {
+	if algorithm == compression.AlgorithmXZ {
+		s.WarnUnsupportedCompression("xz", true, false, true)
+	}
+	level := compression.Level(s.CompressionLevelOr(int(defaultLevel)))
+	return compression.NewCompressor(algorithm, level,
+		compression.WithConcurrency(s.EncoderConcurrency(compression.EncoderMemory(algorithm, s.CompressionWindow))),
+		compression.WithWindowSize(s.CompressionWindow),
+	)
+}
+
+// EncoderConcurrency returns how many encoders to run at once, given roughly
+// how many bytes each one holds on to. This is CompressionConcurrency, or one
+// per CPU when that isn't set. When there is a memory limit, encoders are kept
+// to half of it, leaving the rest for everything else, split evenly between
+// the ParallelSuitcases being written. There is always at least one
+func (s *SuitCaseOpts) EncoderConcurrency(perEncoder int64) int {
+	n := s.CompressionConcurrency
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	if limit := memoryLimit(); limit != math.MaxInt64 && perEncoder > 0 {
+		budget := limit / 2 / int64(max(s.ParallelSuitcases, 1))
+		n = int(min(int64(n), budget/perEncoder))
+	}
+	return max(n, 1)
+}
+
+// warnedCompression holds the unsupported compression options already warned
+// about, so there's only one warning per run instead of one per suitcase
+var warnedCompression sync.Map
+
+// WarnUnsupportedCompression logs a warning when CompressionLevel,
+// CompressionConcurrency or CompressionWindow are set for a compressor, named
+// by name, that can't use them
+func (s *SuitCaseOpts) WarnUnsupportedCompression(name string, level, concurrency, window bool) {
+	warn := func(option string, value any) {
+		if _, warned := warnedCompression.LoadOrStore(name+" "+option, true); !warned {
+			slog.Warn("compression option is not supported, ignoring it", "compressor", name, "option", option, "value", value)
+		}
+	}
+	if !level && s.CompressionLevel != 0 {
+		warn("level", s.CompressionLevel)
+	}
+	if !concurrency && s.CompressionConcurrency > 1 {
+		warn("concurrency", s.CompressionConcurrency)
+	}
+	if !window && s.CompressionWindow > 0 {
+		warn("window", s.CompressionWindow)
+	}
+}
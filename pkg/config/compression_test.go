@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"math"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/scttfrdmn/cargoship/pkg/compression"
+)
+
+func TestSuitCaseOpts_CompressionCobra(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Int("compression-level", 0, "")
+	cmd.Flags().Int("compression-concurrency", 0, "")
+	cmd.Flags().String("compression-window", "", "")
+	if err := cmd.Flags().Parse([]string{"--compression-level", "3", "--compression-concurrency", "64", "--compression-window", "16MiB"}); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := &SuitCaseOpts{}
+	if err := opts.CompressionCobra(cmd); err != nil {
+		t.Fatalf("CompressionCobra() error = %v", err)
+	}
+	if opts.CompressionLevel != 3 || opts.CompressionConcurrency != 64 || opts.CompressionWindow != 16<<20 {
+		t.Errorf("CompressionCobra() set %v, %v, %v", opts.CompressionLevel, opts.CompressionConcurrency, opts.CompressionWindow)
+	}
+
+	if err := cmd.Flags().Set("compression-level", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if err := opts.CompressionCobra(cmd); err == nil {
+		t.Errorf("CompressionCobra() should fail with a level over %v", MaxCompressionLevel)
+	}
+
+	// Commands without the flags leave things alone
+	opts = &SuitCaseOpts{CompressionLevel: 2}
+	if err := opts.CompressionCobra(&cobra.Command{}); err != nil || opts.CompressionLevel != 2 {
+		t.Errorf("CompressionCobra() without flags = %v, level %v", err, opts.CompressionLevel)
+	}
+}
+
+func TestSuitCaseOpts_EncoderConcurrency(t *testing.T) {
+	orig := memoryLimit
+	defer func() { memoryLimit = orig }()
+
+	memoryLimit = func() int64 { return math.MaxInt64 }
+	if got := (&SuitCaseOpts{}).EncoderConcurrency(1 << 20); got != runtime.GOMAXPROCS(0) {
+		t.Errorf("EncoderConcurrency() = %v, want one per CPU", got)
+	}
+	if got := (&SuitCaseOpts{CompressionConcurrency: 64}).EncoderConcurrency(1 << 20); got != 64 {
+		t.Errorf("EncoderConcurrency() = %v, want 64", got)
+	}
+
+	// 1GiB limit, half of which fits 32 encoders of 16MiB
+	memoryLimit = func() int64 { return 1 << 30 }
+	if got := (&SuitCaseOpts{CompressionConcurrency: 64}).EncoderConcurrency(16 << 20); got != 32 {
+		t.Errorf("EncoderConcurrency() = %v, want 32", got)
+	}
+	if got := (&SuitCaseOpts{CompressionConcurrency: 64}).EncoderConcurrency(1 << 30); got != 1 {
+		t.Errorf("EncoderConcurrency() = %v, want at least 1", got)
+	}
+
+	// The same limit, shared by 4 suitcases being written at once
+	if got := (&SuitCaseOpts{CompressionConcurrency: 64, ParallelSuitcases: 4}).EncoderConcurrency(16 << 20); got != 8 {
+		t.Errorf("EncoderConcurrency() = %v, want 8", got)
+	}
+}
+
+func TestSuitCaseOpts_Compressor(t *testing.T) {
+	opts := &SuitCaseOpts{CompressionLevel: 1, CompressionConcurrency: 2, CompressionWindow: 1 << 20}
+	for _, alg := range compression.GetSupportedAlgorithms() {
+		if _, err := opts.Compressor(alg, compression.LevelDefault); err != nil {
+			t.Errorf("Compressor(%v) error = %v", alg, err)
+		}
+	}
+	if _, err := opts.Compressor(compression.Algorithm("nope"), compression.LevelDefault); err == nil {
+		t.Errorf("Compressor() should fail with an unknown algorithm")
+	}
+}
+
+func TestSuitCaseOpts_WarnUnsupportedCompression(t *testing.T) {
+	var buf bytes.Buffer
+	orig := slog.Default()
+	defer slog.SetDefault(orig)
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	opts := &SuitCaseOpts{CompressionLevel: 3, CompressionConcurrency: 4, CompressionWindow: 1 << 20}
+	opts.WarnUnsupportedCompression("test-all", true, true, true)
+	if buf.Len() != 0 {
+		t.Errorf("WarnUnsupportedCompression() warned about supported options: %v", buf.String())
+	}
+	for range 3 {
+		opts.WarnUnsupportedCompression("test-none", false, false, false)
+	}
+	if got := strings.Count(buf.String(), "compressor=test-none"); got != 3 {
+		t.Errorf("WarnUnsupportedCompression() warned %v times, want once for each option: %v", got, buf.String())
+	}
+}
@@ -4,6 +4,7 @@ Package config holds configuration options for suitcases
 package config
 
 import (
+	"os"
 	"strings"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
@@ -20,8 +21,18 @@ type SuitCaseOpts struct {
 	HashOuter         bool // Hash the archive itself
 	HashAlgorithm     string
 	EncryptTo         *openpgp.EntityList
+	DecryptWith       *openpgp.EntityList // Private keys used when reading encrypted suitcases back
+	Password          string              // Password for formats that encrypt with one instead of keys, like aes.zip
 	PostProcessScript string
 	PostProcessEnv    map[string]string
+	// CompressionLevel goes from 1 (fastest) to 9 (smallest). 0 uses the default for each format
+	CompressionLevel int
+	// CompressionConcurrency is how many encoders compressed formats may run at once. 0 uses one per CPU
+	CompressionConcurrency int
+	// CompressionWindow is the window, or block, size in bytes for compressed formats. 0 uses the default for each format
+	CompressionWindow int64
+	// ParallelSuitcases is how many suitcases are being written at once, all sharing the memory limit. 0 is the same as 1
+	ParallelSuitcases int
 	// MaxBytes     uint64 // Maximum size per suitecase
 }
 
@@ -38,8 +49,67 @@ func (s *SuitCaseOpts) EncryptToCobra(cmd *cobra.Command) error {
 	return nil
 }
 
+// DecryptWithCobra fills in the DecryptWith option using cobra.Command options
+func (s *SuitCaseOpts) DecryptWithCobra(cmd *cobra.Command) error {
+	// Gather DecryptWith if we need it
+	if strings.HasSuffix(s.Format, ".gpg") || s.EncryptInner {
+		var err error
+		s.DecryptWith, err = gpg.DecryptWithCmd(cmd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PasswordEnv is the environment variable holding the suitcase password, when
+// no password file is given
+const PasswordEnv = "CARGOSHIP_SUITCASE_PASSWORD"
+
+// PasswordCobra fills in the Password option from the password-file flag, or
+// the PasswordEnv environment variable
+func (s *SuitCaseOpts) PasswordCobra(cmd *cobra.Command) error {
+	if cmd != nil && cmd.Flags().Lookup("password-file") != nil {
+		fn, err := cmd.Flags().GetString("password-file")
+		if err != nil {
+			return err
+		}
+		if fn != "" {
+			b, err := os.ReadFile(fn) // nolint:gosec
+			if err != nil {
+				return err
+			}
+			s.Password = strings.TrimSpace(string(b))
+			return nil
+		}
+	}
+	if v := os.Getenv(PasswordEnv); v != "" {
+		s.Password = v
+	}
+	return nil
+}
+
+// HashAlgorithmCobra fills in the HashAlgorithm option from the
+// hash-inner-algorithm flag, when it is set
+func (s *SuitCaseOpts) HashAlgorithmCobra(cmd *cobra.Command) error {
+	if cmd == nil || cmd.Flags().Lookup("hash-inner-algorithm") == nil {
+		return nil
+	}
+	v, err := cmd.Flags().GetString("hash-inner-algorithm")
+	if err != nil {
+		return err
+	}
+	if v != "" {
+		s.HashAlgorithm = v
+	}
+	return nil
+}
+
 // HashSet is a combination Filename and Hash
 type HashSet struct {
 	Filename string
 	Hash     string
+	// Hashes has every hash computed for the file, keyed by algorithm name.
+	// Hash is the first of these
+	Hashes map[string]string
 }
@@ -273,3 +273,26 @@ func TestHashSet_Collection(t *testing.T) {
 	}
 }
 
+
+func TestSuitCaseOpts_DecryptWithCobra(t *testing.T) {
+	opts := &SuitCaseOpts{
+		Format: "tar.gz",
+	}
+	if err := opts.DecryptWithCobra(&cobra.Command{}); err != nil {
+		t.Errorf("DecryptWithCobra() with no encryption should not return error, got %v", err)
+	}
+	if opts.DecryptWith != nil {
+		t.Errorf("DecryptWithCobra() with no encryption should not set DecryptWith")
+	}
+
+	opts.Format = "tar.gz.gpg"
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("private-key", []string{"../testdata/fakey-private.key"}, "")
+	cmd.Flags().String("passphrase-file", "", "")
+	if err := opts.DecryptWithCobra(cmd); err != nil {
+		t.Errorf("DecryptWithCobra() returned unexpected error: %v", err)
+	}
+	if opts.DecryptWith == nil || len(*opts.DecryptWith) != 1 {
+		t.Errorf("DecryptWithCobra() with .gpg format should set DecryptWith")
+	}
+}
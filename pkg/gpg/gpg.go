@@ -100,6 +100,80 @@ func Encrypt(d []byte, encryptionKeys *openpgp.EntityList, useArmor bool) ([]byt
 	return buffer.Bytes(), nil
 }
 
+// DecryptWithCmd uses a cobra.Command to create an EntityList of private keys
+func DecryptWithCmd(cmd *cobra.Command) (*openpgp.EntityList, error) {
+	privKeyFiles, err := cmd.Flags().GetStringArray("private-key")
+	if err != nil {
+		return nil, err
+	}
+	passphraseFile, err := cmd.Flags().GetString("passphrase-file")
+	if err != nil {
+		return nil, err
+	}
+	var passphrase []byte
+	if passphraseFile != "" {
+		passphrase, err = os.ReadFile(passphraseFile) // nolint:gosec
+		if err != nil {
+			return nil, err
+		}
+		passphrase = bytes.TrimSpace(passphrase)
+	}
+	return ReadPrivateKeys(privKeyFiles, passphrase)
+}
+
+// ReadPrivateKeys returns an EntityList from a set of armored private key
+// files. Locked keys are unlocked using the passphrase
+func ReadPrivateKeys(files []string, passphrase []byte) (*openpgp.EntityList, error) {
+	var els openpgp.EntityList
+	for _, privKeyFile := range files {
+		f, err := os.Open(privKeyFile) // nolint:gosec
+		if err != nil {
+			return nil, err
+		}
+		got, err := openpgp.ReadArmoredKeyRing(f)
+		if cerr := f.Close(); cerr != nil {
+			slog.Warn("error closing gpg file", "file", privKeyFile)
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range got {
+			if e.PrivateKey == nil {
+				return nil, fmt.Errorf("%v does not contain a private key", privKeyFile)
+			}
+			if err := e.DecryptPrivateKeys(passphrase); err != nil {
+				return nil, fmt.Errorf("could not unlock private key in %v: %w", privKeyFile, err)
+			}
+		}
+		els = append(els, got...)
+	}
+	if len(els) == 0 {
+		return nil, errors.New("no gpg keys found")
+	}
+	return &els, nil
+}
+
+// NewDecryptReader returns a reader that decrypts the given encrypted stream
+// using the provided private keys. Set useArmor when the stream is ascii
+// armored, as the inner encrypted files are
+func NewDecryptReader(r io.Reader, decryptionKeys *openpgp.EntityList, useArmor bool) (io.Reader, error) {
+	if decryptionKeys == nil {
+		return nil, errors.New("no decryption keys given")
+	}
+	if useArmor {
+		block, err := armor.Decode(r)
+		if err != nil {
+			return nil, err
+		}
+		r = block.Body
+	}
+	md, err := openpgp.ReadMessage(r, *decryptionKeys, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return md.UnverifiedBody, nil
+}
+
 // ReadEntity returns an Entity from a string
 func ReadEntity(name string) (*openpgp.Entity, error) {
 	f, err := os.Open(name) // nolint:gosec
@@ -1,6 +1,8 @@
 package gpg
 
 import (
+	"bytes"
+	"io"
 	"os"
 	"testing"
 
@@ -137,3 +139,44 @@ func TestCollectGPGPubKeys_NoKeysFound(t *testing.T) {
 	require.Error(t, err)
 	require.Equal(t, "no gpg keys found", err.Error())
 }
+
+func TestReadPrivateKeys(t *testing.T) {
+	got, err := ReadPrivateKeys([]string{"../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	require.Len(t, *got, 1)
+
+	_, err = ReadPrivateKeys([]string{"../testdata/fakey-public.key"}, nil)
+	require.EqualError(t, err, "../testdata/fakey-public.key does not contain a private key")
+
+	_, err = ReadPrivateKeys([]string{}, nil)
+	require.EqualError(t, err, "no gpg keys found")
+}
+
+func TestDecryptWithCmd(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringArray("private-key", []string{"../testdata/fakey-private.key"}, "")
+	cmd.Flags().String("passphrase-file", "", "")
+	el, err := DecryptWithCmd(cmd)
+	require.NoError(t, err)
+	require.Len(t, *el, 1)
+}
+
+func TestNewDecryptReader(t *testing.T) {
+	pubKey, err := ReadEntity("../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := ReadPrivateKeys([]string{"../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+
+	for _, armored := range []bool{true, false} {
+		encrypted, err := Encrypt([]byte("hello world"), &openpgp.EntityList{pubKey}, armored)
+		require.NoError(t, err)
+		r, err := NewDecryptReader(bytes.NewReader(encrypted), privKeys, armored)
+		require.NoError(t, err)
+		got, err := io.ReadAll(r)
+		require.NoError(t, err)
+		require.Equal(t, "hello world", string(got))
+	}
+
+	_, err = NewDecryptReader(bytes.NewReader(nil), nil, false)
+	require.EqualError(t, err, "no decryption keys given")
+}
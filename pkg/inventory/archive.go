@@ -0,0 +1,239 @@
+package inventory
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mholt/archiver/v4"
+)
+
+// ArchiveEntry is a single file inside of an archive that is being inventoried
+type ArchiveEntry struct {
+	Name string `yaml:"name" json:"name"`
+	Size int64  `yaml:"size,omitempty" json:"size,omitempty"`
+	// CompressedSize is only known for formats that compress each file on
+	// its own, like zip
+	CompressedSize int64     `yaml:"compressed_size,omitempty" json:"compressed_size,omitempty"`
+	ModTime        time.Time `yaml:"mod_time,omitempty" json:"mod_time,omitempty"`
+	// Contents of the entry, when it is itself an archive and it is within
+	// the ArchiveTOCDepth
+	Contents []ArchiveEntry `yaml:"contents,omitempty" json:"contents,omitempty"`
+}
+
+// archiveEntry has the same fields as ArchiveEntry, without the custom
+// unmarshalers
+type archiveEntry ArchiveEntry
+
+// UnmarshalJSON reads either an entry, or just the name of one as written by
+// older versions of cargoship
+func (e *ArchiveEntry) UnmarshalJSON(b []byte) error {
+	var name string
+	if err := json.Unmarshal(b, &name); err == nil {
+		*e = ArchiveEntry{Name: name}
+		return nil
+	}
+	return json.Unmarshal(b, (*archiveEntry)(e))
+}
+
+// UnmarshalYAML reads either an entry, or just the name of one as written by
+// older versions of cargoship
+func (e *ArchiveEntry) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*e = ArchiveEntry{Name: name}
+		return nil
+	}
+	return unmarshal((*archiveEntry)(e))
+}
+
+// matches returns true if the entry, or anything nested inside of it, has a
+// name containing p. p should already be lower case
+func (e ArchiveEntry) matches(p string) bool {
+	if strings.Contains(strings.ToLower(e.Name), p) {
+		return true
+	}
+	for _, c := range e.Contents {
+		if c.matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// ArchiveTOC is a v4 TOC generator for archiver
+func ArchiveTOC(fn string) ([]string, error) {
+	entries, err := ArchiveContents(fn, 0)
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]string, len(entries))
+	for idx, e := range entries {
+		ret[idx] = e.Name
+	}
+	return ret, nil
+}
+
+// ArchiveContents returns the entries inside of an archive, along with their
+// sizes and modification times. Archives found inside the archive are opened
+// up as well, going down as many as depth levels
+func ArchiveContents(fn string, depth int) ([]ArchiveEntry, error) {
+	fsys, err := archiver.FileSystem(context.Background(), fn)
+	if err != nil {
+		return nil, err
+	}
+	return archiveContents(fsys, fn, depth)
+}
+
+func archiveContents(fsys fs.FS, fn string, depth int) ([]ArchiveEntry, error) {
+	ret := []ArchiveEntry{}
+	log := slog.With("archive", fn)
+
+	// Track visited paths to prevent infinite recursion in self-referential archives
+	visitedPaths := make(map[string]bool)
+	maxDepth := 1000   // Conservative depth limit
+	maxFiles := 100000 // Maximum files to prevent runaway processing
+	fileCount := 0
+
+	err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, walkErr error) error {
+		if walkErr != nil {
+			return walkErr
+		}
+
+		// Check file count limit
+		fileCount++
+		if fileCount > maxFiles {
+			log.Warn("maximum file count exceeded, stopping walk", "path", path, "count", fileCount)
+			return fmt.Errorf("archive contains too many files (>%d)", maxFiles)
+		}
+
+		// Count directory depth
+		dirDepth := strings.Count(path, "/")
+		if dirDepth > maxDepth {
+			log.Warn("maximum depth exceeded, stopping walk", "path", path, "depth", dirDepth)
+			return fs.SkipDir
+		}
+
+		// Track visited paths to detect cycles
+		if visitedPaths[path] {
+			log.Warn("cycle detected, skipping path", "path", path)
+			return fs.SkipDir
+		}
+		visitedPaths[path] = true
+
+		// Handle: https://github.com/mholt/archiver/issues/383
+		// Detect self-referential archives that cause infinite recursion
+		if (path == ".") && d.Name() == "." && strings.Contains(fn, ".tar") {
+			log.Debug("detected potentially problematic self-referential archive", "archive", fn)
+			// Continue with extra safety checks
+		}
+
+		log.Debug("examining path", "path", path, "depth", dirDepth)
+		if d.IsDir() {
+			return nil
+		}
+		e := newArchiveEntry(path, d)
+		if depth > 0 && path != "." && isTOCAble(path) {
+			if e.Size > maxNestedArchiveSize {
+				log.Debug("skipping nested archive too big to copy out", "path", path, "size", e.Size)
+				ret = append(ret, e)
+				return nil
+			}
+			var nerr error
+			if e.Contents, nerr = nestedArchiveContents(fsys, path, depth-1); nerr != nil {
+				log.Debug("could not look inside nested archive", "path", path, "error", nerr)
+			}
+		}
+		ret = append(ret, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Junky way to check this...
+	if (len(ret) == 1) && (ret[0].Name == ".") {
+		return nil, errors.New("could not scan a non archive file")
+	}
+
+	// I think we want to do this...
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
+
+// newArchiveEntry fills in what the archive tells us about a file
+func newArchiveEntry(path string, d fs.DirEntry) ArchiveEntry {
+	e := ArchiveEntry{Name: path}
+	info, err := d.Info()
+	if err != nil {
+		return e
+	}
+	e.Size = info.Size()
+	if !info.ModTime().IsZero() {
+		e.ModTime = info.ModTime().UTC()
+	}
+	if f, ok := info.(archiver.File); ok {
+		if h, ok := f.Header.(zip.FileHeader); ok {
+			e.CompressedSize = uint64ToInt64(h.CompressedSize64)
+		}
+	}
+	return e
+}
+
+// maxNestedArchiveSize is the biggest nested archive that gets copied out of
+// its parent to be looked inside of. Anything bigger is listed, but its
+// contents are left out
+var maxNestedArchiveSize int64 = 1 << 30
+
+// nestedArchiveContents copies an archive out of its parent, so that it can
+// be opened up like any other archive. It gives up on archives bigger than
+// maxNestedArchiveSize, in case the parent got the size wrong
+func nestedArchiveContents(fsys fs.FS, path string, depth int) ([]ArchiveEntry, error) {
+	tmp, err := os.MkdirTemp("", "cargoship-toc")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			slog.Warn("could not remove temporary directory", "dir", tmp, "error", err)
+		}
+	}()
+
+	in, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(in)
+
+	// Keep the name, as the extension is how the format gets picked
+	fn := filepath.Join(tmp, filepath.Base(path))
+	out, err := os.Create(fn) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.CopyN(out, in, maxNestedArchiveSize+1)
+	if err != nil && !errors.Is(err, io.EOF) {
+		dclose(out)
+		return nil, err
+	}
+	if n > maxNestedArchiveSize {
+		dclose(out)
+		return nil, fmt.Errorf("nested archive is bigger than %v bytes", maxNestedArchiveSize)
+	}
+	if err := out.Close(); err != nil {
+		return nil, err
+	}
+	return ArchiveContents(fn, depth)
+}
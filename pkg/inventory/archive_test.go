@@ -0,0 +1,144 @@
+package inventory
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/vjorlikowski/yaml"
+)
+
+func TestArchiveEntryUnmarshal(t *testing.T) {
+	mtime := time.Date(2023, 2, 14, 14, 1, 12, 0, time.UTC)
+	expect := []ArchiveEntry{
+		{Name: "old.txt"},
+		{Name: "new.tar", Size: 10, ModTime: mtime, Contents: []ArchiveEntry{{Name: "inner.txt", Size: 5}}},
+	}
+
+	var got []ArchiveEntry
+	require.NoError(t, json.Unmarshal([]byte(`["old.txt", {"name": "new.tar", "size": 10, "mod_time": "2023-02-14T14:01:12Z", "contents": [{"name": "inner.txt", "size": 5}]}]`), &got))
+	require.Equal(t, expect, got)
+
+	got = nil
+	require.NoError(t, yaml.Unmarshal([]byte(`- old.txt
+- name: new.tar
+  size: 10
+  mod_time: 2023-02-14T14:01:12Z
+  contents:
+    - name: inner.txt
+      size: 5
+`), &got))
+	require.Equal(t, expect, got)
+}
+
+func TestArchiveContentsFS(t *testing.T) {
+	mtime := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	got, err := archiveContents(fstest.MapFS{
+		"b/two.txt": {Data: []byte("two"), ModTime: mtime},
+		"a.txt":     {Data: []byte("one!"), ModTime: mtime},
+		"empty":     {Mode: os.ModeDir},
+	}, "test.tar", 1)
+	require.NoError(t, err)
+	require.Equal(t, []ArchiveEntry{
+		{Name: "a.txt", Size: 4, ModTime: mtime},
+		{Name: "b/two.txt", Size: 3, ModTime: mtime},
+	}, got)
+}
+
+// writeTar writes out a tar of files, gzipped if the name ends with .gz
+func writeTar(t *testing.T, fn string, files map[string][]byte) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for name, content := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{
+			Name:    name,
+			Mode:    0o644,
+			Size:    int64(len(content)),
+			ModTime: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC),
+		}))
+		_, err := tw.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	b := buf.Bytes()
+	if path.Ext(fn) == ".gz" {
+		var gz bytes.Buffer
+		gw := gzip.NewWriter(&gz)
+		_, err := gw.Write(b)
+		require.NoError(t, err)
+		require.NoError(t, gw.Close())
+		b = gz.Bytes()
+	}
+	require.NoError(t, os.WriteFile(fn, b, 0o600))
+}
+
+func TestArchiveContentsNested(t *testing.T) {
+	dir := t.TempDir()
+	writeTar(t, path.Join(dir, "inner.tar"), map[string][]byte{"deep/secret.txt": []byte("found me")})
+	inner, err := os.ReadFile(path.Join(dir, "inner.tar"))
+	require.NoError(t, err)
+	fn := path.Join(dir, "outer.tar.gz")
+	writeTar(t, fn, map[string][]byte{
+		"inner.tar":  inner,
+		"readme.txt": []byte("hi"),
+	})
+
+	got, err := ArchiveContents(fn, 0)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+	require.Nil(t, got[0].Contents)
+
+	got, err = ArchiveContents(fn, 1)
+	require.NoError(t, err)
+	require.Equal(t, "inner.tar", got[0].Name)
+	require.Equal(t, int64(len(inner)), got[0].Size)
+	require.Equal(t, []ArchiveEntry{
+		{Name: "deep/secret.txt", Size: 8, ModTime: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}, got[0].Contents)
+}
+
+func TestInventorySearchArchiveTOC(t *testing.T) {
+	f := &File{
+		Path:        "/foo/outer.tar.gz",
+		Destination: "outer.tar.gz",
+		Name:        "outer.tar.gz",
+		ArchiveTOC: []ArchiveEntry{
+			{Name: "readme.txt"},
+			{Name: "inner.tar", Contents: []ArchiveEntry{{Name: "deep/secret.txt"}}},
+		},
+	}
+	i := Inventory{Files: []*File{f, {Path: "/foo/other.txt", Destination: "other.txt", Name: "other.txt"}}}
+	require.Equal(t, SearchFileMatches{*f}, i.Search("SECRET").Files)
+	require.Equal(t, SearchFileMatches{*f}, i.Search("readme").Files)
+	require.Empty(t, i.Search("nothing").Files)
+}
+
+func TestArchiveContentsNestedTooBig(t *testing.T) {
+	dir := t.TempDir()
+	writeTar(t, path.Join(dir, "inner.tar"), map[string][]byte{"deep/secret.txt": []byte("found me")})
+	inner, err := os.ReadFile(path.Join(dir, "inner.tar"))
+	require.NoError(t, err)
+	fn := path.Join(dir, "outer.tar.gz")
+	writeTar(t, fn, map[string][]byte{"inner.tar": inner})
+
+	orig := maxNestedArchiveSize
+	defer func() { maxNestedArchiveSize = orig }()
+	maxNestedArchiveSize = int64(len(inner)) - 1
+	got, err := ArchiveContents(fn, 1)
+	require.NoError(t, err)
+	require.Equal(t, []ArchiveEntry{
+		{Name: "inner.tar", Size: int64(len(inner)), ModTime: time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)},
+	}, got)
+
+	// Sizes the parent gets wrong are caught while copying
+	_, err = nestedArchiveContents(fstest.MapFS{"inner.tar": {Data: inner}}, "inner.tar", 0)
+	require.EqualError(t, err, fmt.Sprintf("nested archive is bigger than %v bytes", maxNestedArchiveSize))
+}
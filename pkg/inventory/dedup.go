@@ -0,0 +1,151 @@
+package inventory
+
+import (
+	"bytes"
+	"container/list"
+	"io"
+	"os"
+)
+
+// HasContent returns true if the content of f needs to be stored in a
+// suitcase. Links, directories, special files and duplicates are header only
+func (f File) HasContent() bool {
+	return f.Type.HasContent() && f.DuplicateOf == ""
+}
+
+// StoredSize is the number of bytes f takes up in a suitcase
+func (f File) StoredSize() int64 {
+	if !f.HasContent() {
+		return 0
+	}
+	return f.Size
+}
+
+// dedupCandidateLimit is the most unique files a dedup pass holds on to
+var dedupCandidateLimit = 1 << 18
+
+// duplicates finds files with the same content as one seen before. Only the
+// path and destination of the last dedupCandidateLimit unique files are held on
+// to, so memory stays bounded for streaming inventories too. The cost is that a
+// duplicate of a file seen longer ago than that is stored again
+type duplicates struct {
+	seen map[dedupKey][]dedupCandidate
+	// order holds the key of every candidate, oldest first, for eviction
+	order *list.List
+}
+
+// dedupKey picks out the candidates a file might duplicate, by size and the
+// start of the hash
+type dedupKey struct {
+	size int64
+	hash string
+}
+
+// dedupKeyHashLen is how much of the hash goes in to a dedupKey
+const dedupKeyHashLen = 16
+
+// dedupCandidate is a unique file that later ones may turn out to duplicate
+type dedupCandidate struct {
+	path        string
+	destination string
+}
+
+func newDuplicates() *duplicates {
+	return &duplicates{
+		seen:  map[dedupKey][]dedupCandidate{},
+		order: list.New(),
+	}
+}
+
+// wrap returns fn, pointing any file with the same content as an earlier one at
+// that first, canonical, file. Size and hash only pick the candidates, which
+// are then compared byte for byte, since the hash may well be a weak one like
+// MD5. Files must come through in a deterministic order, so the same file
+// always ends up holding the content
+func (d *duplicates) wrap(fn func(*File) error) func(*File) error {
+	return func(f *File) error {
+		if f.Size > 0 && f.Hash != "" && f.HasContent() {
+			key := dedupKey{size: f.Size, hash: f.Hash[:min(len(f.Hash), dedupKeyHashLen)]}
+			canonical, err := d.match(key, f.Path)
+			if err != nil {
+				return err
+			}
+			if canonical != "" {
+				f.DuplicateOf = canonical
+				f.ArchiveTOC = nil
+			} else {
+				d.add(key, dedupCandidate{path: f.Path, destination: f.Destination})
+			}
+		}
+		return fn(f)
+	}
+}
+
+// add holds on to c under key, evicting the oldest candidate when there are
+// too many
+func (d *duplicates) add(key dedupKey, c dedupCandidate) {
+	d.seen[key] = append(d.seen[key], c)
+	d.order.PushBack(key)
+	if d.order.Len() <= dedupCandidateLimit {
+		return
+	}
+	// Candidates under a key are in the order they were added, so the
+	// oldest key's first candidate is the oldest of all
+	oldest := d.order.Remove(d.order.Front()).(dedupKey)
+	if rest := d.seen[oldest][1:]; len(rest) > 0 {
+		d.seen[oldest] = rest
+	} else {
+		delete(d.seen, oldest)
+	}
+}
+
+// match returns the destination of the candidate under key with the same
+// content as the file at fn, or an empty string if there isn't one
+func (d *duplicates) match(key dedupKey, fn string) (string, error) {
+	for _, c := range d.seen[key] {
+		same, err := sameContent(c.path, fn)
+		if err != nil {
+			return "", err
+		}
+		if same {
+			return c.destination, nil
+		}
+	}
+	return "", nil
+}
+
+// sameContent returns true if the files at a and b hold the same bytes
+func sameContent(a, b string) (bool, error) {
+	af, err := os.Open(a) // nolint:gosec
+	if err != nil {
+		return false, err
+	}
+	defer dclose(af)
+	bf, err := os.Open(b) // nolint:gosec
+	if err != nil {
+		return false, err
+	}
+	defer dclose(bf)
+	abuf, bbuf := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		an, aerr := io.ReadFull(af, abuf)
+		if aerr != nil && !isEOF(aerr) {
+			return false, aerr
+		}
+		bn, berr := io.ReadFull(bf, bbuf)
+		if berr != nil && !isEOF(berr) {
+			return false, berr
+		}
+		if !bytes.Equal(abuf[:an], bbuf[:bn]) {
+			return false, nil
+		}
+		if isEOF(aerr) || isEOF(berr) {
+			return isEOF(aerr) && isEOF(berr), nil
+		}
+	}
+}
+
+// isEOF is true for the errors io.ReadFull gives at the end of a file
+func isEOF(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
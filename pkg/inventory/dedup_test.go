@@ -0,0 +1,167 @@
+package inventory
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeDuplicateTree(t *testing.T) string {
+	top := t.TempDir()
+	cal := strings.Repeat("calibration", 10)
+	for fn, content := range map[string]string{
+		"run1/cal.dat":  cal,
+		"run2/cal.dat":  cal,
+		"run3/cal.dat":  cal,
+		"run1/data.dat": "run one data",
+		"run2/data.dat": "run two data",
+		"empty1":        "",
+		"empty2":        "",
+	} {
+		fn = path.Join(top, fn)
+		require.NoError(t, os.MkdirAll(path.Dir(fn), 0o755))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+	}
+	return top
+}
+
+func TestDedup(t *testing.T) {
+	top := writeDuplicateTree(t)
+	for _, workers := range []int{0, 4} {
+		i, err := NewDirectoryInventory(NewOptions(
+			WithDirectories([]string{top}),
+			WithWalkConcurrency(workers),
+			WithDedup(),
+			WithMaxSuitcaseSize(200),
+		))
+		require.NoError(t, err)
+		canonical := ""
+		dups := []*File{}
+		for _, f := range i.Files {
+			require.NotEmpty(t, f.Hash, f.Destination)
+			if f.Name != "cal.dat" {
+				// Empty files are left alone
+				require.Empty(t, f.DuplicateOf, f.Destination)
+				continue
+			}
+			if f.DuplicateOf == "" {
+				require.Empty(t, canonical, "only one canonical file")
+				canonical = f.Destination
+				continue
+			}
+			dups = append(dups, f)
+		}
+		require.Equal(t, 2, len(dups))
+		for _, f := range dups {
+			require.Equal(t, canonical, f.DuplicateOf)
+			require.Equal(t, int64(110), f.Size)
+			require.Equal(t, int64(0), f.StoredSize())
+		}
+
+		a := i.Analyze()
+		require.Equal(t, uint(2), a.DuplicateCount)
+		require.Equal(t, int64(220), a.DedupSavedSize)
+		require.Equal(t, "220 B", a.DedupSavedSizeHR)
+
+		// Only the unique content counts towards the suitcases
+		var stored int64
+		for _, s := range i.IndexSummaries {
+			stored += s.Size
+		}
+		require.Equal(t, int64(110+12+12), stored)
+	}
+}
+
+func TestDedupStream(t *testing.T) {
+	top := writeDuplicateTree(t)
+	out := path.Join(t.TempDir(), "inventory.ndjson")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	_, err = NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{top}),
+		WithDedup(),
+	), f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	got, err := NewInventoryWithFilename(out)
+	require.NoError(t, err)
+	require.Equal(t, uint(2), got.Analyze().DuplicateCount)
+}
+
+func TestDedupOff(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{writeDuplicateTree(t)}),
+		WithHashFiles(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, uint(0), i.Analyze().DuplicateCount)
+}
+
+func TestDedupHashCollision(t *testing.T) {
+	// Files that only look the same by size and hash must both keep their content
+	top := t.TempDir()
+	files := []*File{}
+	for _, content := range []string{"aaaa", "bbbb", "aaaa", "bbbb"} {
+		fn := path.Join(top, strings.Repeat("x", len(files)+1))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+		files = append(files, &File{Path: fn, Destination: path.Base(fn), Size: 4, Hash: "collides"})
+	}
+	d := newDuplicates()
+	fn := d.wrap(func(*File) error { return nil })
+	for _, f := range files {
+		require.NoError(t, fn(f))
+	}
+	require.Empty(t, files[0].DuplicateOf)
+	require.Empty(t, files[1].DuplicateOf)
+	require.Equal(t, "x", files[2].DuplicateOf)
+	require.Equal(t, "xx", files[3].DuplicateOf)
+}
+
+func TestDedupEviction(t *testing.T) {
+	orig := dedupCandidateLimit
+	defer func() { dedupCandidateLimit = orig }()
+	dedupCandidateLimit = 2
+
+	top := t.TempDir()
+	files := []*File{}
+	for _, content := range []string{"aaaa", "bbbb", "cccc", "aaaa", "cccc"} {
+		fn := path.Join(top, strings.Repeat("x", len(files)+1))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+		files = append(files, &File{Path: fn, Destination: path.Base(fn), Size: 4, Hash: content})
+	}
+	d := newDuplicates()
+	fn := d.wrap(func(*File) error { return nil })
+	for _, f := range files {
+		require.NoError(t, fn(f))
+	}
+	// The first file was forgotten by the time its duplicate came along,
+	// which then took its place
+	require.Empty(t, files[3].DuplicateOf)
+	require.Equal(t, "xxx", files[4].DuplicateOf)
+	require.Equal(t, 2, d.order.Len())
+	require.Equal(t, 2, len(d.seen))
+}
+
+func TestSameContent(t *testing.T) {
+	dir := t.TempDir()
+	big := strings.Repeat("0123456789", 10000)
+	for fn, content := range map[string]string{
+		"a": big,
+		"b": big,
+		"c": big + "!",
+		"d": big[:len(big)-1] + "!",
+	} {
+		require.NoError(t, os.WriteFile(path.Join(dir, fn), []byte(content), 0o644))
+	}
+	for other, expected := range map[string]bool{"b": true, "c": false, "d": false} {
+		got, err := sameContent(path.Join(dir, "a"), path.Join(dir, other))
+		require.NoError(t, err)
+		require.Equal(t, expected, got, other)
+	}
+	_, err := sameContent(path.Join(dir, "a"), path.Join(dir, "missing"))
+	require.Error(t, err)
+}
@@ -0,0 +1,244 @@
+package inventory
+
+import (
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Filters narrow down which files end up in an inventory. Every filter that is
+// set must pass for a file to be included
+type Filters struct {
+	MinSize            int64         `yaml:"min_size,omitempty" json:"min_size,omitempty"`
+	MaxSize            int64         `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	OlderThan          time.Duration `yaml:"older_than,omitempty" json:"older_than,omitempty"`
+	NewerThan          time.Duration `yaml:"newer_than,omitempty" json:"newer_than,omitempty"`
+	AccessedOlderThan  time.Duration `yaml:"accessed_older_than,omitempty" json:"accessed_older_than,omitempty"`
+	AccessedNewerThan  time.Duration `yaml:"accessed_newer_than,omitempty" json:"accessed_newer_than,omitempty"`
+	Types              []string      `yaml:"types,omitempty" json:"types,omitempty"`
+	PathRegexes        []string      `yaml:"path_regexes,omitempty" json:"path_regexes,omitempty"`
+	ExcludePathRegexes []string      `yaml:"exclude_path_regexes,omitempty" json:"exclude_path_regexes,omitempty"`
+	Owners             []string      `yaml:"owners,omitempty" json:"owners,omitempty"`
+}
+
+// FileTypes are the values understood by Filters.Types
+var FileTypes = []string{"file", "symlink", "directory", "fifo", "socket", "device"}
+
+// ExclusionSummary counts up the files a single filter left out
+type ExclusionSummary struct {
+	Count     int    `yaml:"count" json:"count"`
+	Size      int64  `yaml:"size" json:"size"`
+	HumanSize string `yaml:"human_size" json:"human_size"`
+}
+
+// fileFilters is the compiled form of Filters, counting up what gets excluded
+type fileFilters struct {
+	f       Filters
+	now     time.Time
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+	mu      sync.Mutex
+	counts  map[string]*ExclusionSummary
+}
+
+func newFileFilters(f *Filters) (*fileFilters, error) {
+	ret := &fileFilters{
+		now:    time.Now(),
+		counts: map[string]*ExclusionSummary{},
+	}
+	if f == nil {
+		return ret, nil
+	}
+	ret.f = *f
+	for _, t := range f.Types {
+		if !slices.Contains(FileTypes, t) {
+			return nil, fmt.Errorf("unknown file type %v, should be one of: %v", t, FileTypes)
+		}
+	}
+	var err error
+	if ret.include, err = compileRegexes(f.PathRegexes); err != nil {
+		return nil, err
+	}
+	if ret.exclude, err = compileRegexes(f.ExcludePathRegexes); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func compileRegexes(s []string) ([]*regexp.Regexp, error) {
+	ret := make([]*regexp.Regexp, len(s))
+	for idx, item := range s {
+		var err error
+		if ret[idx], err = regexp.Compile(item); err != nil {
+			return nil, fmt.Errorf("invalid path regex %v: %w", item, err)
+		}
+	}
+	return ret, nil
+}
+
+// keep returns true if f passes every filter. Otherwise the first filter it
+// failed is counted up
+func (ff *fileFilters) keep(f *File, isSymlink bool) bool {
+	name := ff.rejectedBy(f, isSymlink)
+	if name == "" {
+		return true
+	}
+	ff.countExcluded(name, f.Size)
+	return false
+}
+
+// countExcluded counts up a single excluded file under name
+func (ff *fileFilters) countExcluded(name string, size int64) {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if _, ok := ff.counts[name]; !ok {
+		ff.counts[name] = &ExclusionSummary{}
+	}
+	ff.counts[name].Count++
+	ff.counts[name].Size += size
+}
+
+// rejectedBy returns the name of the first filter f fails, or an empty string
+func (ff *fileFilters) rejectedBy(f *File, isSymlink bool) string {
+	switch {
+	case ff.f.MinSize > 0 && f.Type.HasContent() && f.Size < ff.f.MinSize:
+		return "min-size"
+	case ff.f.MaxSize > 0 && f.Type.HasContent() && f.Size > ff.f.MaxSize:
+		return "max-size"
+	case ff.f.OlderThan > 0 && ff.now.Sub(f.ModTime) < ff.f.OlderThan:
+		return "older-than"
+	case ff.f.NewerThan > 0 && ff.now.Sub(f.ModTime) > ff.f.NewerThan:
+		return "newer-than"
+	}
+	if f.Posix != nil && !f.Posix.AccessTime.IsZero() {
+		switch {
+		case ff.f.AccessedOlderThan > 0 && ff.now.Sub(f.Posix.AccessTime) < ff.f.AccessedOlderThan:
+			return "accessed-older-than"
+		case ff.f.AccessedNewerThan > 0 && ff.now.Sub(f.Posix.AccessTime) > ff.f.AccessedNewerThan:
+			return "accessed-newer-than"
+		}
+	}
+	if len(ff.f.Types) > 0 && !slices.Contains(ff.f.Types, fileType(f, isSymlink)) {
+		return "type"
+	}
+	if len(ff.include) > 0 && !slices.ContainsFunc(ff.include, func(r *regexp.Regexp) bool { return r.MatchString(f.Path) }) {
+		return "path-regex"
+	}
+	if slices.ContainsFunc(ff.exclude, func(r *regexp.Regexp) bool { return r.MatchString(f.Path) }) {
+		return "exclude-path-regex"
+	}
+	if len(ff.f.Owners) > 0 && !ownedBy(f, ff.f.Owners) {
+		return "owner"
+	}
+	return ""
+}
+
+// excluded returns the counts for each filter that left something out
+func (ff *fileFilters) excluded() map[string]*ExclusionSummary {
+	ff.mu.Lock()
+	defer ff.mu.Unlock()
+	if len(ff.counts) == 0 {
+		return nil
+	}
+	ret := make(map[string]*ExclusionSummary, len(ff.counts))
+	for k, v := range ff.counts {
+		ret[k] = &ExclusionSummary{
+			Count:     v.Count,
+			Size:      v.Size,
+			HumanSize: humanize.Bytes(int64ToUint64(v.Size)),
+		}
+	}
+	return ret
+}
+
+func fileType(f *File, isSymlink bool) string {
+	if isSymlink {
+		return "symlink"
+	}
+	if f.Posix == nil {
+		return "file"
+	}
+	switch m := f.Posix.Mode; {
+	case m.IsDir():
+		return "directory"
+	case m&fs.ModeNamedPipe != 0:
+		return "fifo"
+	case m&fs.ModeSocket != 0:
+		return "socket"
+	case m&fs.ModeDevice != 0:
+		return "device"
+	default:
+		return "file"
+	}
+}
+
+// ownedBy returns true if f belongs to one of owners, given as user names or uids
+func ownedBy(f *File, owners []string) bool {
+	if f.Posix == nil {
+		return false
+	}
+	uid := strconv.Itoa(f.Posix.UID)
+	return slices.ContainsFunc(owners, func(o string) bool {
+		return o == f.Posix.Owner || o == uid
+	})
+}
+
+// parseAge reads a duration, also allowing days and weeks such as 180d or 2w
+func parseAge(s string) (time.Duration, error) {
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if n, ok := strings.CutSuffix(s, suffix); ok {
+			v, err := strconv.ParseFloat(n, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid age %v: %w", s, err)
+			}
+			return time.Duration(v * float64(unit)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+func mustParseAge(s string) time.Duration {
+	d, err := parseAge(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// filtersWith updates f with any of the filter settings that are set, using
+// the getters from either viper or cobra
+func filtersWith(f *Filters, isSet func(string) bool, getString func(string) string, getStrings func(string) []string) *Filters {
+	ret := &Filters{}
+	if f != nil {
+		*ret = *f
+	}
+	changed := false
+	for k, set := range map[string]func(){
+		"min-size":            func() { ret.MinSize = mustBytesFromHuman(getString("min-size")) },
+		"max-size":            func() { ret.MaxSize = mustBytesFromHuman(getString("max-size")) },
+		"older-than":          func() { ret.OlderThan = mustParseAge(getString("older-than")) },
+		"newer-than":          func() { ret.NewerThan = mustParseAge(getString("newer-than")) },
+		"accessed-older-than": func() { ret.AccessedOlderThan = mustParseAge(getString("accessed-older-than")) },
+		"accessed-newer-than": func() { ret.AccessedNewerThan = mustParseAge(getString("accessed-newer-than")) },
+		"file-type":           func() { ret.Types = getStrings("file-type") },
+		"path-regex":          func() { ret.PathRegexes = getStrings("path-regex") },
+		"exclude-path-regex":  func() { ret.ExcludePathRegexes = getStrings("exclude-path-regex") },
+		"owner":               func() { ret.Owners = getStrings("owner") },
+	} {
+		if isSet(k) {
+			set()
+			changed = true
+		}
+	}
+	if !changed {
+		return f
+	}
+	return ret
+}
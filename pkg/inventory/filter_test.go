@@ -0,0 +1,195 @@
+package inventory
+
+import (
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFilterTree(t *testing.T) string {
+	top := t.TempDir()
+	old := time.Now().Add(-400 * 24 * time.Hour)
+	for fn, size := range map[string]int{
+		"small.txt":           10,
+		"medium.dat":          1000,
+		"large.dat":           5000,
+		"old.dat":             1000,
+		"cache/scratch.tmp":   300,
+		"cache/keep.dat":      1000,
+		"project/raw/run1.h5": 2000,
+	} {
+		fn = path.Join(top, fn)
+		require.NoError(t, os.MkdirAll(path.Dir(fn), 0o755))
+		require.NoError(t, os.WriteFile(fn, make([]byte, size), 0o644))
+	}
+	require.NoError(t, os.Chtimes(path.Join(top, "old.dat"), old, old))
+	return top
+}
+
+func filteredNames(i *Inventory) []string {
+	got := []string{}
+	for _, f := range i.Files {
+		got = append(got, f.Name)
+	}
+	sort.Strings(got)
+	return got
+}
+
+func TestFilters(t *testing.T) {
+	top := writeFilterTree(t)
+	tests := map[string]struct {
+		filters  Filters
+		expect   []string
+		excluded map[string]ExclusionSummary
+	}{
+		"size": {
+			filters: Filters{MinSize: 100, MaxSize: 2000},
+			expect:  []string{"keep.dat", "medium.dat", "old.dat", "run1.h5", "scratch.tmp"},
+			excluded: map[string]ExclusionSummary{
+				"min-size": {Count: 1, Size: 10},
+				"max-size": {Count: 1, Size: 5000},
+			},
+		},
+		"older-than": {
+			filters: Filters{OlderThan: 180 * 24 * time.Hour},
+			expect:  []string{"old.dat"},
+			excluded: map[string]ExclusionSummary{
+				"older-than": {Count: 6, Size: 9310},
+			},
+		},
+		"newer-than": {
+			filters: Filters{NewerThan: 180 * 24 * time.Hour},
+			expect:  []string{"keep.dat", "large.dat", "medium.dat", "run1.h5", "scratch.tmp", "small.txt"},
+			excluded: map[string]ExclusionSummary{
+				"newer-than": {Count: 1, Size: 1000},
+			},
+		},
+		"path-regex": {
+			filters: Filters{PathRegexes: []string{`/project/raw/`, `\.txt$`}},
+			expect:  []string{"run1.h5", "small.txt"},
+			excluded: map[string]ExclusionSummary{
+				"path-regex": {Count: 5, Size: 8300},
+			},
+		},
+		"exclude-path-regex": {
+			filters: Filters{ExcludePathRegexes: []string{`/cache/.*\.tmp$`}},
+			expect:  []string{"keep.dat", "large.dat", "medium.dat", "old.dat", "run1.h5", "small.txt"},
+			excluded: map[string]ExclusionSummary{
+				"exclude-path-regex": {Count: 1, Size: 300},
+			},
+		},
+		"type": {
+			filters: Filters{Types: []string{"symlink"}},
+			expect:  []string{},
+			excluded: map[string]ExclusionSummary{
+				"type": {Count: 7, Size: 10310},
+			},
+		},
+		"owner": {
+			filters: Filters{Owners: []string{strconv.Itoa(os.Getuid())}},
+			expect:  []string{"keep.dat", "large.dat", "medium.dat", "old.dat", "run1.h5", "scratch.tmp", "small.txt"},
+		},
+		"other-owner": {
+			filters: Filters{Owners: []string{"no-such-owner"}},
+			expect:  []string{},
+			excluded: map[string]ExclusionSummary{
+				"owner": {Count: 7, Size: 10310},
+			},
+		},
+	}
+	for desc, tt := range tests {
+		for _, workers := range []int{0, 4} {
+			i, err := NewDirectoryInventory(NewOptions(
+				WithDirectories([]string{top}),
+				WithWalkConcurrency(workers),
+				WithFilters(tt.filters),
+			))
+			require.NoError(t, err, desc)
+			require.Equal(t, tt.expect, filteredNames(i), desc)
+			got := map[string]ExclusionSummary{}
+			for k, v := range i.Excluded {
+				got[k] = ExclusionSummary{Count: v.Count, Size: v.Size}
+				require.NotEmpty(t, v.HumanSize, desc)
+			}
+			if tt.excluded == nil {
+				tt.excluded = map[string]ExclusionSummary{}
+			}
+			require.Equal(t, tt.excluded, got, desc)
+		}
+	}
+}
+
+func TestFiltersRecordedInNDJSON(t *testing.T) {
+	top := writeFilterTree(t)
+	out := path.Join(t.TempDir(), "inventory.ndjson")
+	f, err := os.Create(out)
+	require.NoError(t, err)
+	_, err = NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{top}),
+		WithFilters(Filters{MinSize: 100}),
+	), f)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	got, err := NewInventoryWithFilename(out)
+	require.NoError(t, err)
+	require.Equal(t, 6, len(got.Files))
+	require.Equal(t, 1, got.Excluded["min-size"].Count)
+	require.Equal(t, int64(10), got.Excluded["min-size"].Size)
+	require.Equal(t, int64(100), got.Options.Filters.MinSize)
+}
+
+func TestFiltersInvalid(t *testing.T) {
+	_, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithFilters(Filters{PathRegexes: []string{"("}}),
+	))
+	require.ErrorContains(t, err, "invalid path regex")
+
+	_, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithFilters(Filters{Types: []string{"blob"}}),
+	))
+	require.EqualError(t, err, "unknown file type blob, should be one of: [file symlink directory fifo socket device]")
+}
+
+func TestParseAge(t *testing.T) {
+	for s, expect := range map[string]time.Duration{
+		"180d": 180 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+		"36h":  36 * time.Hour,
+	} {
+		got, err := parseAge(s)
+		require.NoError(t, err, s)
+		require.Equal(t, expect, got, s)
+	}
+	_, err := parseAge("xd")
+	require.Error(t, err)
+	require.Panics(t, func() { mustParseAge("never") })
+}
+
+func TestFiltersWithViper(t *testing.T) {
+	v := viper.New()
+	v.Set("min-size", "1MB")
+	v.Set("older-than", "30d")
+	v.Set("exclude-path-regex", []string{`\.tmp$`})
+	o := &Options{}
+	setFilters(*v, o)
+	require.Equal(t, &Filters{
+		MinSize:            1000000,
+		OlderThan:          30 * 24 * time.Hour,
+		ExcludePathRegexes: []string{`\.tmp$`},
+	}, o.Filters)
+
+	// Nothing set leaves filters alone
+	o = &Options{}
+	setFilters(*viper.New(), o)
+	require.Nil(t, o.Filters)
+}
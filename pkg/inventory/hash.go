@@ -0,0 +1,214 @@
+package inventory
+
+import (
+	"bufio"
+	"crypto/md5"  // nolint:gosec
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sourcegraph/conc/pool"
+)
+
+// NewHasher returns a new hash.Hash using the algorithm
+func (h HashAlgorithm) NewHasher() (hash.Hash, error) {
+	switch h {
+	case MD5Hash:
+		return md5.New(), nil // nolint:gosec
+	case SHA1Hash:
+		return sha1.New(), nil // nolint:gosec
+	case SHA256Hash:
+		return sha256.New(), nil
+	case SHA512Hash:
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("no hasher available for hash algorithm: %v", int(h))
+	}
+}
+
+// HashFile returns the hex encoded hash of the file at path
+func HashFile(path string, h HashAlgorithm) (string, error) {
+	f, err := os.Open(path) // nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer dclose(f)
+	return HashReader(f, h)
+}
+
+// HashReader returns the hex encoded hash of everything read from r
+func HashReader(r io.Reader, h HashAlgorithm) (string, error) {
+	dst, err := h.NewHasher()
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(dst, bufio.NewReaderSize(r, os.Getpagesize())); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(dst.Sum(nil)), nil
+}
+
+// ParseHashAlgorithms parses a comma separated list of hash algorithm names,
+// such as "sha256,md5". Repeats are dropped, and an empty string gives none
+func ParseHashAlgorithms(s string) ([]HashAlgorithm, error) {
+	var ret []HashAlgorithm
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		var h HashAlgorithm
+		if err := h.Set(name); err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ret, h) {
+			ret = append(ret, h)
+		}
+	}
+	return ret, nil
+}
+
+// MultiHasher computes several hashes in a single pass, so the data only has
+// to be read once no matter how many algorithms are wanted
+type MultiHasher struct {
+	io.Writer
+	algs   []HashAlgorithm
+	hashes []hash.Hash
+}
+
+// NewMultiHasher returns a MultiHasher for each of algs
+func NewMultiHasher(algs ...HashAlgorithm) (*MultiHasher, error) {
+	if len(algs) == 0 {
+		return nil, fmt.Errorf("at least one hash algorithm is needed")
+	}
+	m := &MultiHasher{algs: algs}
+	writers := make([]io.Writer, len(algs))
+	for i, alg := range algs {
+		h, err := alg.NewHasher()
+		if err != nil {
+			return nil, err
+		}
+		m.hashes = append(m.hashes, h)
+		writers[i] = h
+	}
+	m.Writer = io.MultiWriter(writers...)
+	return m, nil
+}
+
+// Algorithms returns the algorithms being computed, in the order given
+func (m *MultiHasher) Algorithms() []HashAlgorithm {
+	return m.algs
+}
+
+// Sums returns the hex encoded hash of everything written so far, keyed by
+// algorithm name
+func (m *MultiHasher) Sums() map[string]string {
+	ret := make(map[string]string, len(m.algs))
+	for i, alg := range m.algs {
+		ret[alg.String()] = hex.EncodeToString(m.hashes[i].Sum(nil))
+	}
+	return ret
+}
+
+// fileHasher hashes files with a bounded pool of workers while the walk
+// carries on, then hands them to fn one at a time, in the order they were added
+type fileHasher struct {
+	alg     HashAlgorithm
+	fn      func(*File) error
+	workers *pool.Pool
+	pending chan *hashJob
+	done    chan struct{}
+	mu      sync.Mutex
+	err     error
+}
+
+type hashJob struct {
+	f    *File
+	done chan error
+}
+
+// newFileHasher starts up a fileHasher with up to concurrency workers.
+// Concurrency of 0 or less uses one worker per CPU
+func newFileHasher(alg HashAlgorithm, concurrency int, fn func(*File) error) *fileHasher {
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+	h := &fileHasher{
+		alg:     alg,
+		fn:      fn,
+		workers: pool.New().WithMaxGoroutines(concurrency),
+		// Only let the walk get so far ahead of the slowest hash
+		pending: make(chan *hashJob, concurrency*2),
+		done:    make(chan struct{}),
+	}
+	go h.collect()
+	return h
+}
+
+// add queues up f to be hashed. It returns the first error seen so far, so
+// the walk can stop early
+func (h *fileHasher) add(f *File) error {
+	if err := h.firstErr(); err != nil {
+		return err
+	}
+	job := &hashJob{f: f, done: make(chan error, 1)}
+	h.pending <- job
+	if !f.Type.HasContent() {
+		job.done <- nil
+		return nil
+	}
+	h.workers.Go(func() {
+		var err error
+		if job.f.Hash, err = HashFile(job.f.Path, h.alg); err != nil {
+			err = fmt.Errorf("could not hash %v: %w", job.f.Path, err)
+		}
+		job.done <- err
+	})
+	return nil
+}
+
+// collect waits on each job in order, passing finished files on to fn. Once
+// something fails, the rest are drained without calling fn
+func (h *fileHasher) collect() {
+	defer close(h.done)
+	for job := range h.pending {
+		err := <-job.done
+		if err == nil && h.firstErr() == nil {
+			err = h.fn(job.f)
+		}
+		if err != nil {
+			h.setErr(err)
+		}
+	}
+}
+
+// wait blocks until every added file has been hashed and handed to fn
+func (h *fileHasher) wait() error {
+	h.workers.Wait()
+	close(h.pending)
+	<-h.done
+	return h.firstErr()
+}
+
+func (h *fileHasher) firstErr() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
+
+func (h *fileHasher) setErr(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.err == nil {
+		h.err = err
+	}
+}
@@ -0,0 +1,91 @@
+package inventory
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashFile(t *testing.T) {
+	for alg, expected := range map[HashAlgorithm]string{
+		MD5Hash:    "1bb3f2a51adb819141a519739be20507",
+		SHA1Hash:   "e10869be2ad3739c92786bff8e18554db0df85f8",
+		SHA256Hash: "68e6c64a20407c35ebc20d905c941e03c63b3bfe3c853a708a93ec5a95532fbd",
+		SHA512Hash: "d38cb6f19d953a6dce9eb18cfde44a554098c7691c1d60b8a72d380c8c07913a1a873573e53372d0503cafa49b952fbc6c48c5255bad15720b50b24da2d579a0",
+	} {
+		got, err := HashFile("../testdata/name.txt", alg)
+		require.NoError(t, err)
+		require.Equal(t, expected, got)
+	}
+	_, err := HashFile("../testdata/name.txt", NullHash)
+	require.EqualError(t, err, "no hasher available for hash algorithm: 0")
+	_, err = HashFile("../testdata/never-exists.txt", MD5Hash)
+	require.Error(t, err)
+}
+
+func TestParseHashAlgorithms(t *testing.T) {
+	got, err := ParseHashAlgorithms("sha256, md5,sha256,")
+	require.NoError(t, err)
+	require.Equal(t, []HashAlgorithm{SHA256Hash, MD5Hash}, got)
+
+	got, err = ParseHashAlgorithms("")
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	_, err = ParseHashAlgorithms("sha256,crc32")
+	require.Error(t, err)
+}
+
+func TestMultiHasher(t *testing.T) {
+	_, err := NewMultiHasher()
+	require.Error(t, err)
+
+	h, err := NewMultiHasher(MD5Hash, SHA256Hash)
+	require.NoError(t, err)
+	require.Equal(t, []HashAlgorithm{MD5Hash, SHA256Hash}, h.Algorithms())
+	_, err = h.Write([]byte("Joe the user\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{
+		"md5":    "1bb3f2a51adb819141a519739be20507",
+		"sha256": "68e6c64a20407c35ebc20d905c941e03c63b3bfe3c853a708a93ec5a95532fbd",
+	}, h.Sums())
+}
+
+func TestWalkDirHashFiles(t *testing.T) {
+	var plain, hashed []string
+	require.NoError(t, walkDirWithFunc("../testdata/fake-dir", NewOptions(), func(f *File) error {
+		require.Empty(t, f.Hash)
+		plain = append(plain, f.Path)
+		return nil
+	}))
+	require.NoError(t, walkDirWithFunc("../testdata/fake-dir", NewOptions(
+		WithHashFiles(),
+		WithHashConcurrency(2),
+		WithHashAlgorithms(SHA256Hash),
+	), func(f *File) error {
+		expected, err := HashFile(f.Path, SHA256Hash)
+		require.NoError(t, err)
+		require.Equal(t, expected, f.Hash)
+		hashed = append(hashed, f.Path)
+		return nil
+	}))
+	require.NotEmpty(t, hashed)
+	require.Equal(t, plain, hashed, "hashing should not change the walk order")
+
+	err := walkDirWithFunc("../testdata/fake-dir", NewOptions(
+		WithHashFiles(),
+		WithHashAlgorithms(NullHash),
+	), func(*File) error { return nil })
+	require.ErrorContains(t, err, "no hasher available for hash algorithm: 0")
+}
+
+func TestNewDirectoryInventoryHashFiles(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithHashFiles(),
+	))
+	require.NoError(t, err)
+	for _, f := range i.Files {
+		require.NotEmpty(t, f.Hash, f.Path)
+	}
+}
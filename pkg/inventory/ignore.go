@@ -0,0 +1,121 @@
+package inventory
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
+)
+
+// IgnoreFilename is the name of the files holding gitignore style patterns of
+// things to leave out of an inventory. They apply to the directory they are in,
+// and everything below it
+const IgnoreFilename = ".cargoshipignore"
+
+// IgnoreRule is a single pattern read from an ignore file
+type IgnoreRule struct {
+	Source  string `yaml:"source" json:"source"`
+	Pattern string `yaml:"pattern" json:"pattern"`
+}
+
+// ignoreRules collects the patterns from every ignore file found while
+// walking a single top level directory. Patterns only match underneath the
+// directory they came from, so rules picked up in one part of the tree can
+// safely sit alongside rules from another. Directories are always read after
+// their parent, so deeper files are added later, taking priority like git does
+type ignoreRules struct {
+	top      string
+	mu       sync.RWMutex
+	patterns []gitignore.Pattern
+	matcher  gitignore.Matcher
+	rules    []IgnoreRule
+}
+
+func newIgnoreRules(top string) *ignoreRules {
+	return &ignoreRules{top: top}
+}
+
+// load reads the ignore file in dir, if there is one. Patterns are anchored
+// to the top level directory
+func (r *ignoreRules) load(dir string) error {
+	fn := filepath.Join(dir, IgnoreFilename)
+	f, err := os.Open(fn) // nolint:gosec
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer dclose(f)
+
+	domain := splitRelative(r.top, dir)
+	var patterns []gitignore.Pattern
+	var rules []IgnoreRule
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+		patterns = append(patterns, gitignore.ParsePattern(line, domain))
+		rules = append(rules, IgnoreRule{Source: fn, Pattern: line})
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.patterns = append(r.patterns, patterns...)
+	r.rules = append(r.rules, rules...)
+	// Built once here, instead of for every path checked
+	r.matcher = gitignore.NewMatcher(r.patterns)
+	return nil
+}
+
+// ignored returns true if path, underneath the top level directory, should be
+// left out
+func (r *ignoreRules) ignored(path string, isDir bool) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.matcher == nil {
+		return false
+	}
+	return r.matcher.Match(splitRelative(r.top, path), isDir)
+}
+
+// effective returns every rule that was loaded, in the order they apply.
+// Sibling directories may be read in any order by the parallel walker, so
+// rules are sorted by the directory they came from, parents first, keeping
+// the order within each file
+func (r *ignoreRules) effective() []IgnoreRule {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ret := append([]IgnoreRule(nil), r.rules...)
+	sort.SliceStable(ret, func(a, b int) bool {
+		return slices.Compare(
+			splitRelative(r.top, filepath.Dir(ret[a].Source)),
+			splitRelative(r.top, filepath.Dir(ret[b].Source)),
+		) < 0
+	})
+	return ret
+}
+
+// splitRelative returns the path components of path, relative to top
+func splitRelative(top, path string) []string {
+	rel, err := filepath.Rel(top, path)
+	if err != nil || rel == "." {
+		return []string{}
+	}
+	return strings.Split(filepath.ToSlash(rel), "/")
+}
@@ -0,0 +1,160 @@
+package inventory
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeIgnoreTree(t *testing.T) string {
+	top := t.TempDir()
+	for fn, content := range map[string]string{
+		".cargoshipignore":         "# comment\nscratch/\n*.tmp\n!keep.tmp\n/rootonly.txt\nlogs/**/*.log\n",
+		"scratch/.cargoshipignore": "never-read\n",
+		"scratch/a.txt":            "",
+		"a.tmp":                    "",
+		"keep.tmp":                 "",
+		"rootonly.txt":             "",
+		"secret.txt":               "",
+		"logs/x/y/z.log":           "",
+		"logs/x/keep.txt":          "",
+		"data/.cargoshipignore":    "!*.tmp\nsecret.txt\n",
+		"data/scratch/b.txt":       "",
+		"data/rootonly.txt":        "",
+		"data/other.tmp":           "",
+		"data/secret.txt":          "",
+	} {
+		fn = path.Join(top, fn)
+		require.NoError(t, os.MkdirAll(path.Dir(fn), 0o755))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+	}
+	return top
+}
+
+func TestIgnoreFiles(t *testing.T) {
+	top := writeIgnoreTree(t)
+	expected := []string{
+		".cargoshipignore",
+		"data/.cargoshipignore",
+		"data/other.tmp",
+		"data/rootonly.txt",
+		"keep.tmp",
+		"logs/x/keep.txt",
+		"secret.txt",
+	}
+	for _, workers := range []int{0, 4} {
+		i, err := NewDirectoryInventory(NewOptions(
+			WithDirectories([]string{top}),
+			WithWalkConcurrency(workers),
+		))
+		require.NoError(t, err)
+		got := []string{}
+		for _, f := range i.Files {
+			got = append(got, strings.TrimPrefix(f.Destination, "/"))
+		}
+		sort.Strings(got)
+		require.Equal(t, expected, got)
+
+		sources := map[string]int{}
+		for _, rule := range i.IgnoreRules {
+			sources[strings.TrimPrefix(rule.Source, top)]++
+		}
+		// The pruned scratch directory never has its ignore file read
+		require.Equal(t, map[string]int{"/.cargoshipignore": 5, "/data/.cargoshipignore": 2}, sources)
+	}
+}
+
+func TestNoIgnoreFiles(t *testing.T) {
+	top := writeIgnoreTree(t)
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{top}),
+		WithNoIgnoreFiles(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, 14, len(i.Files))
+	require.Empty(t, i.IgnoreRules)
+}
+
+func TestSplitRelative(t *testing.T) {
+	require.Equal(t, []string{}, splitRelative("/top", "/top"))
+	require.Equal(t, []string{"a", "b.txt"}, splitRelative("/top", "/top/a/b.txt"))
+	require.Equal(t, []string{"a"}, splitRelative("/top/", "/top/a"))
+}
+
+func TestIgnoreRulesRoundTrip(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{writeIgnoreTree(t)}),
+	))
+	require.NoError(t, err)
+	require.NotEmpty(t, i.IgnoreRules)
+
+	var w bytes.Buffer
+	require.NoError(t, (&JSONer{}).Write(&w, i))
+	expected, err := i.JSONString()
+	require.NoError(t, err)
+	require.JSONEq(t, expected, w.String())
+	got, err := (&JSONer{}).Read(w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, i.IgnoreRules, got.IgnoreRules)
+
+	w.Reset()
+	require.NoError(t, (&NDJSONer{}).Write(&w, i))
+	got, err = (&NDJSONer{}).Read(w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, i.IgnoreRules, got.IgnoreRules)
+}
+
+func TestIgnoreFilesPerDirectory(t *testing.T) {
+	// Rules from one top level directory must not leak in to another
+	a, b := t.TempDir(), t.TempDir()
+	for fn, content := range map[string]string{
+		path.Join(a, ".cargoshipignore"): "*.tmp\n/sub/\n",
+		path.Join(a, "sub", "x.txt"):     "",
+		path.Join(a, "a.tmp"):            "",
+		path.Join(b, "sub", "x.txt"):     "",
+		path.Join(b, "b.tmp"):            "",
+	} {
+		require.NoError(t, os.MkdirAll(path.Dir(fn), 0o755))
+		require.NoError(t, os.WriteFile(fn, []byte(content), 0o644))
+	}
+	for _, workers := range []int{0, 4} {
+		i, err := NewDirectoryInventory(NewOptions(
+			WithDirectories([]string{a, b}),
+			WithWalkConcurrency(workers),
+		))
+		require.NoError(t, err)
+		got := []string{}
+		for _, f := range i.Files {
+			got = append(got, f.Path)
+		}
+		sort.Strings(got)
+		expected := []string{path.Join(a, ".cargoshipignore"), path.Join(b, "b.tmp"), path.Join(b, "sub", "x.txt")}
+		sort.Strings(expected)
+		require.Equal(t, expected, got)
+	}
+}
+
+func TestIgnoreRulesOrder(t *testing.T) {
+	// Lots of sibling ignore files, which the parallel walker reads in any order
+	top := t.TempDir()
+	for _, dir := range []string{"", "a", "b", "c", "d", "e", "f", "-dash", "a/deeper"} {
+		require.NoError(t, os.MkdirAll(path.Join(top, dir), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(top, dir, ".cargoshipignore"), []byte("*.tmp\n*.bak\n"), 0o644))
+	}
+	serial, err := NewDirectoryInventory(NewOptions(WithDirectories([]string{top})))
+	require.NoError(t, err)
+	require.Equal(t, path.Join(top, ".cargoshipignore"), serial.IgnoreRules[0].Source)
+	for range 5 {
+		parallel, err := NewDirectoryInventory(NewOptions(
+			WithDirectories([]string{top}),
+			WithWalkConcurrency(8),
+		))
+		require.NoError(t, err)
+		require.Equal(t, serial.IgnoreRules, parallel.IgnoreRules)
+	}
+}
@@ -0,0 +1,169 @@
+package inventory
+
+import (
+	"fmt"
+	"log/slog"
+	"sort"
+)
+
+// Delta describes how an inventory differs from the previous inventory it was
+// compared against. Only the added and changed files end up in the inventory
+// Files, and so in new suitcases
+type Delta struct {
+	PreviousInventory string   `yaml:"previous_inventory" json:"previous_inventory"`
+	Added             []string `yaml:"added,omitempty" json:"added,omitempty"`
+	Changed           []string `yaml:"changed,omitempty" json:"changed,omitempty"`
+	Deleted           []string `yaml:"deleted,omitempty" json:"deleted,omitempty"`
+	// Unchanged files are not packed again. They still live in the suitcases
+	// named by their SuitcaseName
+	Unchanged []*File `yaml:"unchanged,omitempty" json:"unchanged,omitempty"`
+}
+
+// AllFiles returns every file the inventory describes. For incremental
+// inventories, this includes the unchanged files carried over from previous
+// inventories
+func (di Inventory) AllFiles() []*File {
+	if di.Delta == nil || len(di.Delta.Unchanged) == 0 {
+		return di.Files
+	}
+	ret := make([]*File, 0, len(di.Files)+len(di.Delta.Unchanged))
+	ret = append(ret, di.Files...)
+	return append(ret, di.Delta.Unchanged...)
+}
+
+// EachOfAllFiles calls fn on every file AllFiles returns, reading the files of
+// streamed inventories from disk as EachFile does
+func (di Inventory) EachOfAllFiles(fn func(*File) error) error {
+	if err := di.EachFile(fn); err != nil {
+		return err
+	}
+	if di.Delta == nil {
+		return nil
+	}
+	for _, f := range di.Delta.Unchanged {
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// previousFiles loads up every file described by a previous inventory, keyed
+// by path, with the suitcase names filled in. Files that were split up are
+// returned whole, with their segments in the second map
+func previousFiles(fn string) (map[string]*File, map[string][]*File, error) {
+	var prev *Inventory
+	var err error
+	if IsNDJSONFilename(fn) {
+		prev, err = NewStreamingInventoryWithFilename(fn)
+	} else {
+		prev, err = NewInventoryWithFilename(fn)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read previous inventory: %w", err)
+	}
+	ret := map[string]*File{}
+	segments := map[string][]*File{}
+	add := func(f *File) {
+		if f.Segment == nil {
+			ret[f.Path] = f
+			return
+		}
+		segments[f.Path] = append(segments[f.Path], f)
+		whole := *f
+		whole.Size = f.Segment.TotalSize
+		whole.Segment = nil
+		ret[f.Path] = &whole
+	}
+	if err := prev.EachFile(func(f *File) error {
+		f.SuitcaseName = prev.SuitcaseNameForFile(f)
+		add(f)
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+	if prev.Delta != nil {
+		for _, f := range prev.Delta.Unchanged {
+			add(f)
+		}
+	}
+	return ret, segments, nil
+}
+
+// applyPreviousInventory compares the walked files against a previous
+// inventory, leaving only the added and changed files in Files
+func (di *Inventory) applyPreviousInventory(fn string) error {
+	prev, prevSegments, err := previousFiles(fn)
+	if err != nil {
+		return err
+	}
+	delta := &Delta{PreviousInventory: fn}
+	files := []*File{}
+	for _, f := range di.Files {
+		pf, ok := prev[f.Path]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, f.Path)
+			files = append(files, f)
+		case fileChanged(pf, f, di.Options.CompareHash):
+			delta.Changed = append(delta.Changed, f.Path)
+			files = append(files, f)
+		default:
+			// Keep what we know now, but point at the suitcase it already lives in
+			f.SuitcaseIndex = 0
+			f.SuitcaseName = pf.SuitcaseName
+			if segs, ok := prevSegments[f.Path]; ok {
+				for _, seg := range segs {
+					cur := *f
+					cur.Size = seg.Size
+					cur.SuitcaseName = seg.SuitcaseName
+					cur.Segment = seg.Segment
+					delta.Unchanged = append(delta.Unchanged, &cur)
+				}
+				break
+			}
+			delta.Unchanged = append(delta.Unchanged, f)
+		}
+		delete(prev, f.Path)
+	}
+	for p := range prev {
+		delta.Deleted = append(delta.Deleted, p)
+	}
+	sort.Strings(delta.Added)
+	sort.Strings(delta.Changed)
+	sort.Strings(delta.Deleted)
+	slog.Info("compared against previous inventory",
+		"previous", fn,
+		"added", len(delta.Added),
+		"changed", len(delta.Changed),
+		"deleted", len(delta.Deleted),
+		"unchanged", len(delta.Unchanged),
+	)
+	di.Files = keepDuplicatesLocal(files)
+	di.Delta = delta
+	return nil
+}
+
+// keepDuplicatesLocal stores the content of any duplicate again when the file
+// it points at is not going in to this round of suitcases
+func keepDuplicatesLocal(files []*File) []*File {
+	present := make(map[string]bool, len(files))
+	for _, f := range files {
+		present[f.Destination] = true
+	}
+	for _, f := range files {
+		if f.DuplicateOf != "" && !present[f.DuplicateOf] {
+			f.DuplicateOf = ""
+		}
+	}
+	return files
+}
+
+// fileChanged returns true if cur looks different than prev. Files without a
+// recorded modification time are always considered changed
+func fileChanged(prev, cur *File, compareHash bool) bool {
+	if prev.Size != cur.Size || !prev.ModTime.Equal(cur.ModTime) {
+		return true
+	}
+	return compareHash && prev.Hash != cur.Hash
+}
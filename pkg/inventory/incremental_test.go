@@ -0,0 +1,117 @@
+package inventory
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestInventory(t *testing.T, i *Inventory) string {
+	fn := path.Join(t.TempDir(), "inventory.yaml")
+	f, err := os.Create(fn)
+	require.NoError(t, err)
+	require.NoError(t, (&VAMLer{}).Write(f, i))
+	require.NoError(t, f.Close())
+	return fn
+}
+
+func TestIncrementalInventory(t *testing.T) {
+	src := t.TempDir()
+	for _, fn := range []string{"static.txt", "changes.txt", "goes-away.txt"} {
+		require.NoError(t, os.WriteFile(path.Join(src, fn), []byte("original"), 0o644))
+	}
+	first, err := NewDirectoryInventory(NewOptions(WithDirectories([]string{src})))
+	require.NoError(t, err)
+	require.Nil(t, first.Delta)
+	require.Equal(t, 3, len(first.Files))
+	require.False(t, first.Files[0].ModTime.IsZero())
+	prevFn := writeTestInventory(t, first)
+
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.WriteFile(path.Join(src, "changes.txt"), []byte("changed"), 0o644))
+	require.NoError(t, os.Chtimes(path.Join(src, "changes.txt"), later, later))
+	require.NoError(t, os.Remove(path.Join(src, "goes-away.txt")))
+	require.NoError(t, os.WriteFile(path.Join(src, "new.txt"), []byte("new"), 0o644))
+
+	second, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithPreviousInventory(prevFn),
+	))
+	require.NoError(t, err)
+	require.Equal(t, []string{path.Join(src, "new.txt")}, second.Delta.Added)
+	require.Equal(t, []string{path.Join(src, "changes.txt")}, second.Delta.Changed)
+	require.Equal(t, []string{path.Join(src, "goes-away.txt")}, second.Delta.Deleted)
+	require.Equal(t, 1, len(second.Delta.Unchanged))
+	require.Equal(t, first.SuitcaseNameWithIndex(1), second.Delta.Unchanged[0].SuitcaseName)
+	require.Equal(t, 2, len(second.Files))
+	require.Equal(t, 3, len(second.AllFiles()))
+	// Unchanged files can still be looked up
+	matched, err := second.FilesMatchingGlob("static.txt")
+	require.NoError(t, err)
+	require.Equal(t, []*File{second.Delta.Unchanged[0]}, matched)
+	q, err := ParseQuery("name:static.txt")
+	require.NoError(t, err)
+	found, err := second.Find(q)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(found))
+	require.Equal(t, first.SuitcaseNameWithIndex(1), found[0].Suitcase)
+
+	// Chaining on to the delta inventory knows about everything
+	third, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithPreviousInventory(writeTestInventory(t, second)),
+	))
+	require.NoError(t, err)
+	require.Empty(t, third.Files)
+	require.Empty(t, third.Delta.Added)
+	require.Empty(t, third.Delta.Changed)
+	require.Empty(t, third.Delta.Deleted)
+	require.Equal(t, 3, len(third.Delta.Unchanged))
+}
+
+func TestIncrementalInventoryCompareHash(t *testing.T) {
+	src := t.TempDir()
+	fn := path.Join(src, "sneaky.txt")
+	require.NoError(t, os.WriteFile(fn, []byte("original"), 0o644))
+	st, err := os.Stat(fn)
+	require.NoError(t, err)
+
+	first, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithCompareHash(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, "919c8b643b7133116b02fc0d9bb7df3f", first.Files[0].Hash)
+	prevFn := writeTestInventory(t, first)
+
+	// Same size and modification time, different content
+	require.NoError(t, os.WriteFile(fn, []byte("Original"), 0o644))
+	require.NoError(t, os.Chtimes(fn, st.ModTime(), st.ModTime()))
+
+	sizeOnly, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithPreviousInventory(prevFn),
+	))
+	require.NoError(t, err)
+	require.Empty(t, sizeOnly.Delta.Changed)
+
+	withHash, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithPreviousInventory(prevFn),
+		WithCompareHash(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, []string{fn}, withHash.Delta.Changed)
+}
+
+func TestIncrementalInventoryMissingPrevious(t *testing.T) {
+	_, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/limit-dir"}),
+		WithPreviousInventory("../testdata/never-exists.yaml"),
+	))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not read previous inventory")
+}
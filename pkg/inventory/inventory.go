@@ -4,7 +4,6 @@ Package inventory provides the needed pieces to correctly create an Inventory of
 package inventory
 
 import (
-	"context" // nolint
 	json "encoding/json"
 	"errors"
 	"fmt"
@@ -23,12 +22,12 @@ import (
 	"time"
 
 	"github.com/charmbracelet/log"
-	"github.com/mholt/archiver/v4"
 	"github.com/scttfrdmn/cargoship/pkg/plugins/transporters"
 	"github.com/scttfrdmn/cargoship/pkg/plugins/transporters/cloud"
 	"github.com/scttfrdmn/cargoship/pkg/plugins/transporters/shell"
 
 	"github.com/dustin/go-humanize"
+	"github.com/invopop/jsonschema"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
@@ -113,6 +112,20 @@ func (h *HashAlgorithm) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%v\"", h.String())), nil
 }
 
+// UnmarshalJSON reads the string value written by MarshalJSON back in
+func (h *HashAlgorithm) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return h.Set(v)
+}
+
+// JSONSchema describes HashAlgorithm as the string MarshalJSON writes
+func (HashAlgorithm) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "string", Enum: stringEnum(hashMap)}
+}
+
 // Format is the format the inventory will use, such as yaml, json, etc
 type Format int
 
@@ -123,17 +136,21 @@ const (
 	YAMLFormat
 	// JSONFormat is for yaml
 	JSONFormat
+	// NDJSONFormat is for streaming, newline delimited json
+	NDJSONFormat
 )
 
 var formatMap = map[string]Format{
-	"yaml": YAMLFormat,
-	"json": JSONFormat,
-	"":     NullFormat,
+	"yaml":   YAMLFormat,
+	"json":   JSONFormat,
+	"ndjson": NDJSONFormat,
+	"":       NullFormat,
 }
 
 var formatHelp = map[string]string{
-	"yaml": "YAML is the preferred format. It allows for easy human readable inventories that can also be easily parsed by machines",
-	"json": "JSON inventory is not very readable, but could allow for faster machine parsing under certain conditions",
+	"yaml":   "YAML is the preferred format. It allows for easy human readable inventories that can also be easily parsed by machines",
+	"json":   "JSON inventory is not very readable, but could allow for faster machine parsing under certain conditions",
+	"ndjson": "Streaming JSON inventory, one file per line. Use this for very large trees, as files are never all held in memory",
 }
 
 // FormatCompletion returns shell completion
@@ -174,6 +191,15 @@ func (f *Format) MarshalJSON() ([]byte, error) {
 	return []byte(fmt.Sprintf("\"%v\"", f.String())), nil
 }
 
+// UnmarshalJSON reads the string value written by MarshalJSON back in
+func (f *Format) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return f.Set(v)
+}
+
 // Inventoryer is an interface to define what an Inventory Operator does
 type Inventoryer interface {
 	Write(io.Writer, *Inventory) error
@@ -182,12 +208,29 @@ type Inventoryer interface {
 
 // Inventory is the inventory of a set of suitcases
 type Inventory struct {
+	SchemaVersion    string                `yaml:"schema_version" json:"schema_version"`
 	Files            []*File               `yaml:"files" json:"files"`
 	Options          *Options              `yaml:"options" json:"options"`
 	TotalIndexes     int                   `yaml:"total_indexes" json:"total_indexes"`
 	IndexSummaries   map[int]*IndexSummary `yaml:"index_summaries" json:"index_summaries"`
 	InternalMetadata map[string]string     `yaml:"internal_metadata" json:"internal_metadata"`
 	ExternalMetadata map[string]string     `yaml:"external_metadata" json:"external_metadata"`
+	Delta            *Delta                `yaml:"delta,omitempty" json:"delta,omitempty"`
+	IgnoreRules      []IgnoreRule          `yaml:"ignore_rules,omitempty" json:"ignore_rules,omitempty"`
+	// Excluded counts up the files left out by each filter, keyed by the filter name
+	Excluded map[string]*ExclusionSummary `yaml:"excluded,omitempty" json:"excluded,omitempty"`
+	// EntryCounts is the number of links, empty directories and special files
+	// found when preserving them
+	EntryCounts map[EntryType]int `yaml:"entry_counts,omitempty" json:"entry_counts,omitempty"`
+	// MetadataFields are the merged fields from any YAML or JSON external metadata files
+	MetadataFields map[string]any `yaml:"metadata_fields,omitempty" json:"metadata_fields,omitempty"`
+	// streamFile is set for streaming inventories, whose Files are read back
+	// from disk by EachFile instead of being held in memory
+	streamFile string
+	// migratedFrom is the schema version the inventory was read in as, and
+	// fileMigrations still need running on any files read back from streamFile
+	migratedFrom   string
+	fileMigrations []func(*Inventory, *File)
 	// CLIMeta          CLIMeta               `yaml:"cli_meta" json:"cli_meta"`
 }
 
@@ -203,10 +246,13 @@ func (di Inventory) MustJSONString() string {
 // ValidateAccess ensures that we have access to all files in a given inventory
 func (di Inventory) ValidateAccess() error {
 	invalidFiles := []string{}
-	for _, item := range di.Files {
+	if err := di.EachFile(func(item *File) error {
 		if !isFileReadable(item.Path) {
 			invalidFiles = append(invalidFiles, item.Path)
 		}
+		return nil
+	}); err != nil {
+		return err
 	}
 	if len(invalidFiles) > 0 {
 		return fmt.Errorf("the following files are not readable: %v", strings.Join(invalidFiles, ","))
@@ -232,6 +278,9 @@ type Analysis struct {
 	AverageFileSizeHR string
 	TotalFileSize     int64
 	TotalFileSizeHR   string
+	DuplicateCount    uint
+	DedupSavedSize    int64
+	DedupSavedSizeHR  string
 }
 
 // Analyze examines an inventory and returns an Analysis object
@@ -243,6 +292,8 @@ func (di Inventory) Analyze() Analysis {
 	var largest File
 	var fc uint  // file count
 	var ts int64 // total size
+	var dc uint  // duplicate count
+	var ds int64 // dedup saved size
 	// allSizes := make([]int64, len(di.Files))
 	for _, f := range di.Files {
 		// allSizes[idx] = f.Size
@@ -251,9 +302,17 @@ func (di Inventory) Analyze() Analysis {
 		if f.Size > largest.Size {
 			largest = *f
 		}
+		if f.DuplicateOf != "" {
+			dc++
+			ds += f.Size
+		}
 	}
 
 	avg := ts / int64(len(di.Files))
+	var dsHR string
+	if dc > 0 {
+		dsHR = humanize.Bytes(int64ToUint64(ds))
+	}
 	return Analysis{
 		LargestFileSize:   largest.Size,
 		LargestFileSizeHR: humanize.Bytes(int64ToUint64(largest.Size)),
@@ -262,6 +321,9 @@ func (di Inventory) Analyze() Analysis {
 		AverageFileSizeHR: humanize.Bytes(int64ToUint64(avg)),
 		TotalFileSize:     ts,
 		TotalFileSizeHR:   humanize.Bytes(int64ToUint64(ts)),
+		DuplicateCount:    dc,
+		DedupSavedSize:    ds,
+		DedupSavedSizeHR:  dsHR,
 	}
 }
 
@@ -322,6 +384,32 @@ type Options struct {
 	IncludeArchiveTOC     bool                     `yaml:"include_archive_toc" json:"include_archive_toc"`
 	IncludeArchiveTOCDeep bool                     `yaml:"include_archive_toc_deep" json:"include_archive_toc_deep"`
 	TransportPlugin       transporters.Transporter `yaml:"transport_plugin" json:"transport_plugin"`
+	PreviousInventory     string                   `yaml:"previous_inventory,omitempty" json:"previous_inventory,omitempty"`
+	CompareHash           bool                     `yaml:"compare_hash,omitempty" json:"compare_hash,omitempty"`
+	IncludeXattrs         bool                     `yaml:"include_xattrs,omitempty" json:"include_xattrs,omitempty"`
+	HashFiles             bool                     `yaml:"hash_files,omitempty" json:"hash_files,omitempty"`
+	HashConcurrency       int                      `yaml:"hash_concurrency,omitempty" json:"hash_concurrency,omitempty"`
+	WalkConcurrency       int                      `yaml:"walk_concurrency,omitempty" json:"walk_concurrency,omitempty"`
+	PackingStrategy       PackingStrategy          `yaml:"packing_strategy,omitempty" json:"packing_strategy,omitempty"`
+	SplitLargeFiles       bool                     `yaml:"split_large_files,omitempty" json:"split_large_files,omitempty"`
+	NoIgnoreFiles         bool                     `yaml:"no_ignore_files,omitempty" json:"no_ignore_files,omitempty"`
+	Filters               *Filters                 `yaml:"filters,omitempty" json:"filters,omitempty"`
+	Preserve              bool                     `yaml:"preserve,omitempty" json:"preserve,omitempty"`
+	Dedup                 bool                     `yaml:"dedup,omitempty" json:"dedup,omitempty"`
+	MetadataSchema        string                   `yaml:"metadata_schema,omitempty" json:"metadata_schema,omitempty"`
+	RequiredMetadata      []string                 `yaml:"required_metadata,omitempty" json:"required_metadata,omitempty"`
+	ArchiveTOCDepth       int                      `yaml:"archive_toc_depth,omitempty" json:"archive_toc_depth,omitempty"`
+}
+
+// UnmarshalJSON reads options back in from json. The transport plugin only
+// matters at run time and can't be rebuilt from its json form, so it is skipped
+func (o *Options) UnmarshalJSON(b []byte) error {
+	type plainOptions Options
+	aux := struct {
+		*plainOptions
+		TransportPlugin json.RawMessage `json:"transport_plugin"`
+	}{plainOptions: (*plainOptions)(o)}
+	return json.Unmarshal(b, &aux)
 }
 
 // AbsoluteDirectories converts the Directories entries to absolute paths
@@ -348,6 +436,15 @@ func WithArchiveTOCDeep() func(*Options) {
 	}
 }
 
+// WithArchiveTOCDepth also lists the contents of archives nested inside of
+// archives, up to d levels down. Nested archives over 1GiB are listed
+// without their contents
+func WithArchiveTOCDepth(d int) func(*Options) {
+	return func(o *Options) {
+		o.ArchiveTOCDepth = d
+	}
+}
+
 // WithIgnoreGlobs sets the IgnoreGlobs strings
 func WithIgnoreGlobs(g []string) func(*Options) {
 	return func(o *Options) {
@@ -416,6 +513,126 @@ func WithPrefix(p string) func(*Options) {
 	}
 }
 
+// WithPreviousInventory compares the new inventory against a previous
+// inventory file, only including files that were added or changed since
+func WithPreviousInventory(s string) func(*Options) {
+	return func(o *Options) {
+		o.PreviousInventory = s
+	}
+}
+
+// WithCompareHash also compares file hashes when building an incremental inventory
+func WithCompareHash() func(*Options) {
+	return func(o *Options) {
+		o.CompareHash = true
+	}
+}
+
+// WithXattrs also records extended attributes for each file
+func WithXattrs() func(*Options) {
+	return func(o *Options) {
+		o.IncludeXattrs = true
+	}
+}
+
+// WithHashFiles computes the HashAlgorithm hash of every file while walking,
+// storing it in the inventory
+func WithHashFiles() func(*Options) {
+	return func(o *Options) {
+		o.HashFiles = true
+	}
+}
+
+// WithHashConcurrency sets the number of files hashed at once. 0 uses one per CPU
+func WithHashConcurrency(n int) func(*Options) {
+	return func(o *Options) {
+		o.HashConcurrency = n
+	}
+}
+
+// WithWalkConcurrency reads up to n directories at once while walking. Files
+// come out of a parallel walk sorted by path, depth first
+func WithWalkConcurrency(n int) func(*Options) {
+	return func(o *Options) {
+		o.WalkConcurrency = n
+	}
+}
+
+// WithPackingStrategy sets how files are packed in to suitcases
+func WithPackingStrategy(p PackingStrategy) func(*Options) {
+	return func(o *Options) {
+		o.PackingStrategy = p
+	}
+}
+
+// WithSplitLargeFiles splits files bigger than MaxSuitcaseSize in to segments,
+// instead of failing the inventory
+func WithSplitLargeFiles() func(*Options) {
+	return func(o *Options) {
+		o.SplitLargeFiles = true
+	}
+}
+
+// WithNoIgnoreFiles skips reading .cargoshipignore files while walking
+func WithNoIgnoreFiles() func(*Options) {
+	return func(o *Options) {
+		o.NoIgnoreFiles = true
+	}
+}
+
+// WithExternalMetadataFiles includes the given files as external metadata
+func WithExternalMetadataFiles(f ...string) func(*Options) {
+	return func(o *Options) {
+		o.ExternalMetadataFiles = f
+	}
+}
+
+// WithMetadataSchema validates the fields of the external metadata files
+// against the JSON schema in the file at s
+func WithMetadataSchema(s string) func(*Options) {
+	return func(o *Options) {
+		o.MetadataSchema = s
+	}
+}
+
+// WithRequiredMetadata fails the inventory when any of the given fields are
+// missing from the external metadata, such as pi, grant or retention
+func WithRequiredMetadata(r ...string) func(*Options) {
+	return func(o *Options) {
+		o.RequiredMetadata = r
+	}
+}
+
+// WithDedup stores files with identical content only once. Every file is
+// hashed to find them, and files with matching hashes are compared byte for
+// byte before being treated as duplicates
+func WithDedup() func(*Options) {
+	return func(o *Options) {
+		o.Dedup = true
+	}
+}
+
+// WithPreserve keeps symlinks as links, hardlinks, empty directories and
+// special files such as FIFOs and devices, instead of only regular files
+func WithPreserve() func(*Options) {
+	return func(o *Options) {
+		o.Preserve = true
+	}
+}
+
+// followSymlinks returns true if symlinks should be followed while walking.
+// Preservation mode always keeps them as links instead
+func (o *Options) followSymlinks() bool {
+	return o.FollowSymlinks && !o.Preserve
+}
+
+// WithFilters only includes files passing every filter that is set
+func WithFilters(f Filters) func(*Options) {
+	return func(o *Options) {
+		o.Filters = &f
+	}
+}
+
 // WithHashAlgorithms sets the hashing algorithms to use for signatures
 func WithHashAlgorithms(a HashAlgorithm) func(*Options) {
 	return func(o *Options) {
@@ -447,13 +664,20 @@ func NewOptions(options ...func(*Options)) *Options {
 
 // File is a file item inside an inventory
 type File struct {
-	Path          string   `yaml:"path" json:"path"`
-	Destination   string   `yaml:"destination" json:"destination"`
-	Name          string   `yaml:"name" json:"name"`
-	Size          int64    `yaml:"size" json:"size"`
-	ArchiveTOC    []string `yaml:"archive_toc,omitempty" json:"archive_toc,omitempty"`
-	SuitcaseIndex int      `yaml:"suitcase_index,omitempty" json:"suitcase_index,omitempty"`
-	SuitcaseName  string   `yaml:"suitcase_name,omitempty" json:"suitcase_name,omitempty"`
+	Path          string         `yaml:"path" json:"path"`
+	Destination   string         `yaml:"destination" json:"destination"`
+	Name          string         `yaml:"name" json:"name"`
+	Size          int64          `yaml:"size" json:"size"`
+	ArchiveTOC    []ArchiveEntry `yaml:"archive_toc,omitempty" json:"archive_toc,omitempty"`
+	SuitcaseIndex int            `yaml:"suitcase_index,omitempty" json:"suitcase_index,omitempty"`
+	SuitcaseName  string         `yaml:"suitcase_name,omitempty" json:"suitcase_name,omitempty"`
+	ModTime       time.Time      `yaml:"mod_time,omitempty" json:"mod_time,omitempty"`
+	Hash          string         `yaml:"hash,omitempty" json:"hash,omitempty"`
+	Posix         *PosixMetadata `yaml:"posix,omitempty" json:"posix,omitempty"`
+	Segment       *Segment       `yaml:"segment,omitempty" json:"segment,omitempty"`
+	Type          EntryType      `yaml:"type,omitempty" json:"type,omitempty"`
+	LinkTarget    string         `yaml:"link_target,omitempty" json:"link_target,omitempty"`
+	DuplicateOf   string         `yaml:"duplicate_of,omitempty" json:"duplicate_of,omitempty"`
 }
 
 // FileBucket describes what a filebucket state is
@@ -493,54 +717,29 @@ func (di Inventory) UniqueSuitcaseNames() []string {
 // IndexWithSize Loops through inventory and assign suitcase indexes based on a
 // given max size
 func (di *Inventory) IndexWithSize(maxSize int64) error {
-	caseSet := NewCaseSet(maxSize)
-	numCases := 1
-	// Sort by descending size
-	sort.Slice(di.Files, func(i, j int) bool {
-		return di.Files[i].Size > di.Files[j].Size
-	})
-	for _, item := range di.Files {
-		// Implementation requires that maxSize is greater than or equal to the size of the largest file
-		// If maxSize == 0, everything goes in the same suitcase
-		if maxSize == 0 {
-			item.SuitcaseIndex = 1
-		} else {
-			err := checkItemSize(item, maxSize)
-			if err != nil {
-				return err
-			}
-			// for loop := true; loop; {
-			var sorted bool
-			for index, sizeLeft := range caseSet {
-				if item.Size <= sizeLeft {
-					item.SuitcaseIndex = index
-					caseSet[index] -= item.Size
-					sorted = true
-					break
-				}
-			}
-			if !sorted {
-				slog.Debug("index is full, adding new index",
-					"path", item.Path,
-					"size", item.Size,
-					"numCases", numCases,
-				)
-				numCases++
-				caseSet[numCases] = maxSize - item.Size
-				item.SuitcaseIndex = numCases
-			}
-		}
-		// Write up summary
-		if di.IndexSummaries == nil {
-			di.IndexSummaries = map[int]*IndexSummary{}
+	strategy := FirstFitPacking
+	if di.Options != nil {
+		if di.Options.PackingStrategy != NullPacking {
+			strategy = di.Options.PackingStrategy
 		}
-
+		di.Options.PackingStrategy = strategy
+	}
+	numCases, err := strategy.Packer().Pack(di.Files, maxSize)
+	if err != nil {
+		return err
+	}
+	slog.Debug("packed suitcases", "strategy", strategy, "numCases", numCases)
+	// Write up summary
+	if di.IndexSummaries == nil {
+		di.IndexSummaries = map[int]*IndexSummary{}
+	}
+	for _, item := range di.Files {
 		if _, ok := di.IndexSummaries[item.SuitcaseIndex]; !ok {
 			di.IndexSummaries[item.SuitcaseIndex] = &IndexSummary{}
 		}
 		s := di.IndexSummaries[item.SuitcaseIndex]
 		s.Count++
-		s.Size += item.Size
+		s.Size += item.StoredSize()
 	}
 	// Generate human readable total sizes
 	for _, v := range di.IndexSummaries {
@@ -553,8 +752,40 @@ func (di *Inventory) IndexWithSize(maxSize int64) error {
 
 // NewDirectoryInventory creates a new DirectoryInventory using options
 func NewDirectoryInventory(opts *Options) (*Inventory, error) {
+	ret, err := newInventoryWithMetadata(opts)
+	if err != nil {
+		return nil, err
+	}
+	state, err := walkDirs(opts, func(f *File) error {
+		ret.Files = append(ret.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	state.record(ret)
+	if opts.PreviousInventory != "" {
+		if err := ret.applyPreviousInventory(opts.PreviousInventory); err != nil {
+			return nil, err
+		}
+	}
+	if opts.SplitLargeFiles {
+		if ret.Files, err = splitLargeFiles(ret.Files, opts.MaxSuitcaseSize, opts.HashAlgorithm); err != nil {
+			return nil, err
+		}
+	}
+	if ierr := ret.IndexWithSize(opts.MaxSuitcaseSize); ierr != nil {
+		return nil, ierr
+	}
+	return ret, nil
+}
+
+// newInventoryWithMetadata validates the options and returns a new inventory
+// with everything but the files filled in
+func newInventoryWithMetadata(opts *Options) (*Inventory, error) {
 	ret := &Inventory{
-		Options: opts,
+		SchemaVersion: SchemaVersion,
+		Options:       opts,
 	}
 	if opts.Prefix == "" {
 		opts.Prefix = "suitcase"
@@ -574,9 +805,17 @@ func NewDirectoryInventory(opts *Options) (*Inventory, error) {
 	}
 
 	// Mmm...internal metadata is tasty, but I'm still hungry for some of that external metadata
-	externalMeta := map[string]string{}
 	if len(opts.ExternalMetadataFiles) > 0 {
-		ret.ExternalMetadata = externalMeta
+		em, err := readExternalMetadata(opts.ExternalMetadataFiles)
+		if err != nil {
+			return nil, err
+		}
+		ret.ExternalMetadata = em.raw
+		ret.MetadataFields = em.fields
+	}
+	// Fail before walking anything if the metadata isn't up to snuff
+	if err := ret.validateMetadataFields(); err != nil {
+		return nil, err
 	}
 
 	if len(ret.InternalMetadata) == 0 && len(ret.ExternalMetadata) == 0 {
@@ -592,18 +831,27 @@ func NewDirectoryInventory(opts *Options) (*Inventory, error) {
 			log.Warn("top level directory does not exist", "directory", dir)
 			return nil, errors.New("not a directory")
 		}
+	}
+	return ret, nil
+}
+
+// walkDirs walks each of the top level directories, calling fn for every file
+// found. The returned state holds the ignore rules and filter counts from the walk
+func walkDirs(opts *Options, fn func(*File) error) (*walkState, error) {
+	state, err := newWalkState(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range opts.Directories {
 		log.Debug("walking directory", "directory", dir)
-		err := walkDir(dir, opts, ret)
+		err := walkDirWithState(dir, opts, state, fn)
 		if err != nil {
 			if err.Error() != "halt" {
 				return nil, err
 			}
 		}
 	}
-	if ierr := ret.IndexWithSize(opts.MaxSuitcaseSize); ierr != nil {
-		return nil, ierr
-	}
-	return ret, nil
+	return state, nil
 }
 
 // GetMetadataWithGlob Given a file path with a glob, return metadata. The metadata is a map of filename to data
@@ -663,6 +911,10 @@ func NewInventoryWithFilename(s string) (*Inventory, error) {
 	if err != nil {
 		return nil, err
 	}
+	// Older inventories are upgraded to the current schema as they are read
+	if err := inventoryD.migrate(); err != nil {
+		return nil, err
+	}
 	return inventoryD, nil
 }
 
@@ -673,6 +925,10 @@ func NewInventoryerWithFilename(filename string) (Inventoryer, error) {
 	switch ext {
 	case ".yaml", ".yml":
 		ir = &VAMLer{}
+	case ".json":
+		ir = &JSONer{}
+	case ".ndjson", ".jsonl":
+		ir = &NDJSONer{}
 	default:
 		return nil, fmt.Errorf("unsupported file extension %s", ext)
 	}
@@ -716,6 +972,21 @@ func WithViper(v *viper.Viper) func(*Options) {
 		// setTransportPlugin(*v, o)
 		setCloudDestination(*v, o)
 		setShellDestination(*v, o)
+		setPreviousInventory(*v, o)
+		setCompareHash(*v, o)
+		setIncludeXattrs(*v, o)
+		setHashFiles(*v, o)
+		setHashConcurrency(*v, o)
+		setWalkConcurrency(*v, o)
+		setPackingStrategy(*v, o)
+		setSplitLargeFiles(*v, o)
+		setNoIgnoreFiles(*v, o)
+		setFilters(*v, o)
+		setPreserve(*v, o)
+		setDedup(*v, o)
+		setMetadataSchema(*v, o)
+		setRequiredMetadata(*v, o)
+		setArchiveTOCDepth(*v, o)
 
 		// Formats are a little funky...should we set them special?
 		// Strip out leading dots
@@ -748,6 +1019,256 @@ func setInternalMetadataGlob[T viper.Viper | cobra.Command](v T, o *Options) {
 	}
 }
 
+func setPreviousInventory[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "previous-inventory"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.PreviousInventory = vi.GetString(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.PreviousInventory = mustGetCmd[string](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setCompareHash[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "compare-hash"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.CompareHash = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.CompareHash = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setHashFiles[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "hash-files"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.HashFiles = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.HashFiles = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setHashConcurrency[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "hash-concurrency"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.HashConcurrency = vi.GetInt(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.HashConcurrency = mustGetCmd[int](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setWalkConcurrency[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "walk-concurrency"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.WalkConcurrency = vi.GetInt(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.WalkConcurrency = mustGetCmd[int](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setPackingStrategy[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "packing-strategy"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.PackingStrategy = mustPackingStrategy(vi.GetString(k))
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.PackingStrategy = mustPackingStrategy(mustGetCmd[string](ci, k))
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setSplitLargeFiles[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "split-large-files"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.SplitLargeFiles = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.SplitLargeFiles = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setNoIgnoreFiles[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "no-ignore-files"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.NoIgnoreFiles = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.NoIgnoreFiles = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setMetadataSchema[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "metadata-schema"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.MetadataSchema = vi.GetString(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.MetadataSchema = mustGetCmd[string](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setRequiredMetadata[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "required-metadata"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.RequiredMetadata = vi.GetStringSlice(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.RequiredMetadata = mustGetCmd[[]string](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setDedup[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "dedup"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.Dedup = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.Dedup = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setPreserve[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "preserve"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.Preserve = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.Preserve = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
+func setFilters[T viper.Viper | cobra.Command](v T, o *Options) {
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		o.Filters = filtersWith(o.Filters, vi.IsSet, vi.GetString, vi.GetStringSlice)
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		o.Filters = filtersWith(o.Filters, ci.Flags().Changed,
+			func(k string) string { return mustGetCmd[string](ci, k) },
+			func(k string) []string { return mustGetCmd[[]string](ci, k) },
+		)
+	default:
+		panic("unexpected use of set filters")
+	}
+}
+
+func setIncludeXattrs[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "xattrs"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.IncludeXattrs = vi.GetBool(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.IncludeXattrs = mustGetCmd[bool](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
 func setLimitFileCount[T viper.Viper | cobra.Command](v T, o *Options) {
 	k := "limit-file-count"
 	switch any(new(T)).(type) {
@@ -856,6 +1377,24 @@ func setArchiveTOCDeep[T viper.Viper | cobra.Command](v T, o *Options) {
 	}
 }
 
+func setArchiveTOCDepth[T viper.Viper | cobra.Command](v T, o *Options) {
+	k := "archive-toc-depth"
+	switch any(new(T)).(type) {
+	case *viper.Viper:
+		vi := mustGetViper(v)
+		if vi.IsSet(k) {
+			o.ArchiveTOCDepth = vi.GetInt(k)
+		}
+	case *cobra.Command:
+		ci := mustGetCommand(v)
+		if ci.Flags().Changed(k) {
+			o.ArchiveTOCDepth = mustGetCmd[int](ci, k)
+		}
+	default:
+		panic(fmt.Sprintf("unexpected use of set %v", k))
+	}
+}
+
 func setArchiveTOC[T viper.Viper | cobra.Command](v T, o *Options) {
 	k := "archive-toc"
 	switch any(new(T)).(type) {
@@ -1020,6 +1559,21 @@ func WithCobra(cmd *cobra.Command, args []string) func(*Options) {
 		// setTransportPlugin(*cmd, o)
 		setCloudDestination(*cmd, o)
 		setShellDestination(*cmd, o)
+		setPreviousInventory(*cmd, o)
+		setCompareHash(*cmd, o)
+		setIncludeXattrs(*cmd, o)
+		setHashFiles(*cmd, o)
+		setHashConcurrency(*cmd, o)
+		setWalkConcurrency(*cmd, o)
+		setPackingStrategy(*cmd, o)
+		setSplitLargeFiles(*cmd, o)
+		setNoIgnoreFiles(*cmd, o)
+		setFilters(*cmd, o)
+		setPreserve(*cmd, o)
+		setDedup(*cmd, o)
+		setMetadataSchema(*cmd, o)
+		setRequiredMetadata(*cmd, o)
+		setArchiveTOCDepth(*cmd, o)
 
 		if len(args) > 0 {
 			o.Directories = args
@@ -1065,7 +1619,7 @@ func mustTempDir() string {
 */
 
 func checkItemSize(item *File, maxSize int64) error {
-	if item.Size > maxSize {
+	if item.StoredSize() > maxSize {
 		log.Warn("file is too large for suitcase",
 			"path", item.Path,
 			"size", item.Size,
@@ -1130,45 +1684,76 @@ func isFileReadable(filePath string) bool {
 }
 
 func walkDir(dir string, opts *Options, ret *Inventory) error {
+	return walkDirWithFunc(dir, opts, func(f *File) error {
+		ret.Files = append(ret.Files, f)
+		return nil
+	})
+}
+
+// walkDirWithFunc walks dir, calling fn with each file that should be in the
+// inventory. When files need hashing, that happens in a pool of workers
+// alongside the walk, and fn still sees the files in walk order
+func walkDirWithFunc(dir string, opts *Options, fn func(*File) error) error {
+	state, err := newWalkState(opts)
+	if err != nil {
+		return err
+	}
+	return walkDirWithState(dir, opts, state, fn)
+}
+
+// walkDirWithState is walkDirWithFunc, sharing state with the other top level
+// directories
+func walkDirWithState(dir string, opts *Options, state *walkState, fn func(*File) error) error {
+	if !opts.HashFiles && !opts.CompareHash && !opts.Dedup {
+		return walkDirFiles(dir, opts, state, state.wrap(opts, fn))
+	}
+	if opts.Dedup {
+		fn = state.duplicates.wrap(fn)
+	}
+	h := newFileHasher(opts.HashAlgorithm, opts.HashConcurrency, fn)
+	werr := walkDirFiles(dir, opts, state, state.wrap(opts, h.add))
+	if err := h.wait(); err != nil {
+		return err
+	}
+	return werr
+}
+
+// walkDirFiles walks dir in a single godirwalk, or hands off to the parallel
+// walker when opts.WalkConcurrency asks for more than one worker
+func walkDirFiles(dir string, opts *Options, state *walkState, fn func(*File) error) error {
+	if opts.WalkConcurrency > 1 {
+		return walkDirParallel(dir, opts, state, fn)
+	}
+	rules := state.ignoreRules(dir)
 	var addedCount int
 	if err := godirwalk.Walk(dir, &godirwalk.Options{
-		FollowSymbolicLinks: opts.FollowSymlinks,
+		FollowSymbolicLinks: opts.followSymlinks(),
 		Callback: func(path string, de *godirwalk.Dirent) error {
-			if de.IsDir() { // Skip top level directories from inventory
-				return nil
+			isDir := de.IsDir() || (de.IsSymlink() && opts.followSymlinks() && isDirectory(path))
+			if rules.ignored(path, isDir) {
+				// Prune whole directories here, instead of walking them
+				return godirwalk.SkipThis
 			}
-
-			ogPath := path
-			if de.IsSymlink() {
-				target, skip := shouldSkipSymlink(path)
-				if skip || !opts.FollowSymlinks {
+			// Skip directories from inventory, unless they are empty ones to preserve
+			keepDir := isDir && opts.Preserve && filepath.Clean(path) != filepath.Clean(dir) && isEmptyDir(path)
+			if isDir && !keepDir {
+				if opts.NoIgnoreFiles {
 					return nil
 				}
-				path = target
+				return rules.load(path)
 			}
 
-			st := mustStat(path)
-
-			name := de.Name()
-			if filenameMatchesGlobs(name, opts.IgnoreGlobs) {
+			invf, err := newWalkedFile(dir, path, de.Name(), de.IsSymlink(), opts, state.filters)
+			if err != nil {
+				return err
+			}
+			if invf == nil {
 				return nil
 			}
 
-			invf := &File{
-				Path:        path,
-				Destination: strings.TrimPrefix(ogPath, dir),
-				Name:        name,
-				Size:        st.Size(),
-			}
-			// if opts.IncludeArchiveTOC || opts.IncludeArchiveTOCDeep {
-			if opts.IncludeArchiveTOCDeep || (opts.IncludeArchiveTOC && isTOCAble(path)) {
-				var aerr error
-				if invf.ArchiveTOC, aerr = ArchiveTOC(path); aerr != nil {
-					slog.Debug("error attemping to look at table of contents in file", "file", path)
-				}
+			if err := fn(invf); err != nil {
+				return err
 			}
-
-			ret.Files = append(ret.Files, invf)
 			addedCount++
 
 			if herr := haltIfLimit(opts, addedCount); herr != nil {
@@ -1185,6 +1770,52 @@ func walkDir(dir string, opts *Options, ret *Inventory) error {
 	return nil
 }
 
+// newWalkedFile builds up the File for path, found while walking the top level
+// directory dir. A nil File means path should be left out of the inventory
+func newWalkedFile(dir, path, name string, isSymlink bool, opts *Options, filters *fileFilters) (*File, error) {
+	if opts.Preserve {
+		return newPreservedFile(dir, path, name, opts, filters)
+	}
+	ogPath := path
+	if isSymlink {
+		target, skip := shouldSkipSymlink(path)
+		if skip || !opts.followSymlinks() {
+			return nil, nil
+		}
+		path = target
+	}
+
+	st := mustStat(path)
+
+	if filenameMatchesGlobs(name, opts.IgnoreGlobs) {
+		filters.countExcluded("ignore-glob", st.Size())
+		return nil, nil
+	}
+
+	invf := &File{
+		Path:        path,
+		Destination: strings.TrimPrefix(ogPath, dir),
+		Name:        name,
+		Size:        st.Size(),
+		ModTime:     st.ModTime().UTC(),
+	}
+	var perr error
+	if invf.Posix, perr = NewPosixMetadata(path, st, opts.IncludeXattrs); perr != nil {
+		return nil, perr
+	}
+	if !filters.keep(invf, isSymlink) {
+		return nil, nil
+	}
+	// if opts.IncludeArchiveTOC || opts.IncludeArchiveTOCDeep {
+	if opts.IncludeArchiveTOCDeep || (opts.IncludeArchiveTOC && isTOCAble(path)) {
+		var aerr error
+		if invf.ArchiveTOC, aerr = ArchiveContents(path, opts.ArchiveTOCDepth); aerr != nil {
+			slog.Debug("error attemping to look at table of contents in file", "file", path)
+		}
+	}
+	return invf, nil
+}
+
 // shouldSkipSymlink returns the target of the symlink and a boolean on if it should be skipped
 func shouldSkipSymlink(path string) (string, bool) {
 	target, eerr := filepath.EvalSymlinks(path)
@@ -1225,7 +1856,7 @@ func nonEmptyKeys[V any](m map[string]V) []string {
 }
 
 // reverseMap takes a map[k]v and returns a map[v]k
-func reverseMap[K string, V string | Format | HashAlgorithm](m map[K]V) map[V]K {
+func reverseMap[K string, V string | Format | HashAlgorithm | PackingStrategy](m map[K]V) map[V]K {
 	ret := make(map[V]K, len(m))
 	for k, v := range m {
 		ret[v] = k
@@ -1285,9 +1916,12 @@ func BindCobra(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("inventory-file", "", "Use the given inventory file to create the suitcase")
 	cmd.PersistentFlags().String("max-suitcase-size", "500GiB", "Maximum size for the set of suitcases generated. If no unit is specified, 'bytes' is assumed. 0 means no limit.")
 	cmd.PersistentFlags().String("internal-metadata-glob", "suitcase-meta*", "Glob pattern for internal metadata files. This should be directly under the top level directories of the targets that are being packaged up. Multiple matches will be included if found.")
-	cmd.PersistentFlags().StringArray("external-metadata-file", []string{}, "Additional files to include as metadata in the inventory. This should NOT be part of the suitcase target directories...use internal-metadata-glob for those")
+	cmd.PersistentFlags().StringArray("external-metadata-file", []string{}, "Additional files to include as metadata in the inventory. This should NOT be part of the suitcase target directories...use internal-metadata-glob for those. YAML and JSON files are also parsed in to metadata fields")
+	cmd.PersistentFlags().String("metadata-schema", "", "JSON schema file to validate the external metadata fields against")
+	cmd.PersistentFlags().StringArray("required-metadata", []string{}, "Metadata field that must be set in the external metadata files, such as pi, grant or retention. Nested fields use dots, like project.pi. Can be specified multiple times")
 	cmd.PersistentFlags().StringArray("ignore-glob", []string{}, "Ignore files matching this glob pattern. Can be specified multiple times")
 	cmd.PersistentFlags().Bool("hash-inner", false, "Create hashes for the inner contents of the suitcase")
+	cmd.PersistentFlags().String("hash-inner-algorithm", "", "Hash algorithms for --hash-inner, such as sha256, or md5,sha256 to write one hash file for each. Defaults to the inventory hash algorithm")
 	cmd.PersistentFlags().Bool("hash-outer", true, "Create hashes for the container and metadata files. Disable with --hash-outer=false")
 	cmd.PersistentFlags().Bool("encrypt-inner", false, "Encrypt files within the suitcase")
 	cmd.PersistentFlags().Bool("follow-symlinks", false, "Follow symlinks when traversing the target directories and files")
@@ -1296,13 +1930,39 @@ func BindCobra(cmd *cobra.Command) {
 	cmd.PersistentFlags().String("user", "", "Username to insert into the suitcase filename. If omitted, we'll try and detect from the current user")
 	cmd.PersistentFlags().String("prefix", "suitcase", "Prefix to insert into the suitcase filename")
 	cmd.PersistentFlags().StringArrayP("public-key", "p", []string{}, "Public keys to use for encryption")
+	cmd.PersistentFlags().Int("compression-level", 0, "Compression level for compressed suitcase formats, from 1 (fastest) to 9 (smallest). 0 uses the default for each format. For tar.xz, the level picks the dictionary size unless --compression-window is set")
+	cmd.PersistentFlags().Int("compression-concurrency", 0, "Number of cores each compressed suitcase may use. 0 uses all of them, as long as they fit in half of --memory-limit, shared between the suitcases written at once. tar.xz and tar.bz2 only ever use one")
+	cmd.PersistentFlags().String("compression-window", "", "Window, or block, size for compressed suitcase formats, like 8MiB. Larger windows compress better, but use more memory. Defaults to the size for each format. tar.bz2 ignores this, its block size comes from the level")
+	cmd.PersistentFlags().String("password-file", "", "File containing the password for aes.zip suitcases. Defaults to the CARGOSHIP_SUITCASE_PASSWORD environment variable")
 	cmd.PersistentFlags().Bool("exclude-systems-pubkeys", false, "By default, we will include the systems teams pubkeys, unless this option is specified")
 	cmd.PersistentFlags().Bool("only-inventory", false, "Only generate the inventory file, skip the actual suitcase archive creation")
 	cmd.PersistentFlags().Bool("archive-toc", false, "Also include the Table-of-Contents for supported archives, such as zip, tar, etc in the inventory")
 	cmd.PersistentFlags().Bool("archive-toc-deep", false, "Also include the Table-of-Contents for supported archives. This will look at any file, regardless of extension")
+	cmd.PersistentFlags().Int("archive-toc-depth", 0, "Also include the Table-of-Contents of archives nested inside archives, up to this many levels down. Nested archives over 1GiB are listed without their contents")
 	// cmd.PersistentFlags().String("transport-plugin", "", "Transport plugin to use (if any). Options: shell, rclone...")
 	cmd.PersistentFlags().String("cloud-destination", "", "Send files to this cloud destination after creation. Destination must be a valid rclone location.")
 	cmd.PersistentFlags().String("shell-destination", "", "Send files through this shell destination after creation.")
+	cmd.PersistentFlags().String("previous-inventory", "", "Compare against this previous inventory file, only including files that were added or changed since it was created")
+	cmd.PersistentFlags().Bool("compare-hash", false, "Also compare file hashes against the previous inventory, instead of just size and modification time")
+	cmd.PersistentFlags().Bool("xattrs", false, "Record extended attributes for each file in the inventory, and restore them with the files")
+	cmd.PersistentFlags().Bool("hash-files", false, "Record a hash of every file in the inventory, so it can be used as a fixity manifest")
+	cmd.PersistentFlags().Int("hash-concurrency", 0, "Number of files to hash at once when using --hash-files. 0 uses one per CPU")
+	cmd.PersistentFlags().String("packing-strategy", "first-fit", "How files are packed in to suitcases. One of: first-fit, best-fit, directory-locality")
+	cmd.PersistentFlags().Bool("split-large-files", false, "Split files bigger than --max-suitcase-size in to segments spread across suitcases, instead of failing")
+	cmd.PersistentFlags().Bool("no-ignore-files", false, "Don't read .cargoshipignore files while walking the target directories")
+	cmd.PersistentFlags().Bool("dedup", false, "Store files with identical content only once, restoring copies from the first one. Hashes every file, and compares matches byte for byte")
+	cmd.PersistentFlags().Bool("preserve", false, "Keep symlinks as links, hardlinks, empty directories, FIFOs and devices instead of only regular files")
+	cmd.PersistentFlags().String("min-size", "", "Only include files at least this big, such as 1MB")
+	cmd.PersistentFlags().String("max-size", "", "Only include files at most this big, such as 10GiB")
+	cmd.PersistentFlags().String("older-than", "", "Only include files last modified longer ago than this, such as 180d, 2w or 36h")
+	cmd.PersistentFlags().String("newer-than", "", "Only include files last modified more recently than this, such as 180d, 2w or 36h")
+	cmd.PersistentFlags().String("accessed-older-than", "", "Only include files last accessed longer ago than this, such as 180d")
+	cmd.PersistentFlags().String("accessed-newer-than", "", "Only include files last accessed more recently than this, such as 180d")
+	cmd.PersistentFlags().StringArray("file-type", []string{}, "Only include files of this type. One of: file, symlink, directory, fifo, socket, device. Can be specified multiple times")
+	cmd.PersistentFlags().StringArray("path-regex", []string{}, "Only include files whose full path matches this regular expression. Can be specified multiple times")
+	cmd.PersistentFlags().StringArray("exclude-path-regex", []string{}, "Leave out files whose full path matches this regular expression, such as '/cache/.*\\.tmp$'. Can be specified multiple times")
+	cmd.PersistentFlags().StringArray("owner", []string{}, "Only include files owned by this user name or uid. Can be specified multiple times")
+	cmd.PersistentFlags().Int("walk-concurrency", 0, "Number of directories to read at once while walking. Useful on parallel and network filesystems, where metadata lookups are slow. 0 or 1 walks one directory at a time")
 	cmd.PersistentFlags().Int("retry-count", 5, "Number of times to retry a failed operation.")
 	cmd.PersistentFlags().Duration("retry-interval", 1*time.Second, "How long to wait between retries.")
 }
@@ -1383,47 +2043,75 @@ type SearchResults struct {
 }
 
 // Search iterates through files inside of an inventory and returns a set of
-// results
+// results. p is a Query, such as "ext:.h5 size>1G raw". Its plain words also
+// match directory names, for files matching the rest of the query. Anything
+// that doesn't parse as a Query is searched for as plain text
 func (di Inventory) Search(p string) SearchResults {
+	q, err := ParseQuery(p)
+	if err != nil {
+		q = &Query{text: p, words: []string{p}}
+	}
 	r := SearchResults{}
-	// First check files
 	fm := SearchFileMatches{}
-	var possibleDirs []File
-	for _, f := range di.Files {
-		dirName, fileName := filepath.Split(f.Destination)
-		if strings.Contains(strings.ToLower(fileName), strings.ToLower(p)) {
+	possibleDirs := map[string][]File{}
+	if err := di.EachOfAllFiles(func(f *File) error {
+		if q.Matches(&di, f) {
 			fm = append(fm, *f)
 		}
-
-		// How about table of contents files?
-		for _, toc := range f.ArchiveTOC {
-			if strings.Contains(strings.ToLower(toc), strings.ToLower(p)) {
-				fm = append(fm, *f)
-				break
+		if !q.matchesTerms(&di, f) {
+			return nil
+		}
+		dirName, _ := filepath.Split(f.Destination)
+		for _, w := range q.words {
+			if strings.Contains(strings.ToLower(dirName), strings.ToLower(w)) {
+				possibleDirs[w] = append(possibleDirs[w], *f)
 			}
 		}
+		return nil
+	}); err != nil {
+		slog.Warn("could not search inventory", "error", err)
+	}
+	r.Files = fm
 
-		// Now look at dirs
-		if strings.Contains(strings.ToLower(dirName), strings.ToLower(p)) {
-			possibleDirs = append(possibleDirs, *f)
+	for _, w := range q.words {
+		for _, pos := range uniqDirsWithFiles(possibleDirs[w], w) {
+			size, suitcases := dirSummary(possibleDirs[w], pos)
+			r.Directories = append(r.Directories, SearchDirMatch{
+				Directory:   pos,
+				TotalSize:   size,
+				TotalSizeHR: humanize.Bytes(size),
+				Suitcases:   suitcases,
+			})
 		}
 	}
-	r.Files = fm
+	return r
+}
 
-	md := uniqDirsWithFiles(possibleDirs, p)
-	for _, pos := range md {
-		size, suitcases := dirSummary(possibleDirs, pos)
-		r.Directories = append(r.Directories, SearchDirMatch{
-			// Directory:   strings.TrimSuffix(pos[0:strings.Index(pos, p)+len(p)], "/"),
-			Directory:   pos,
-			TotalSize:   size,
-			TotalSizeHR: humanize.Bytes(size),
-			Suitcases:   suitcases,
-		})
-		humanize.Bytes(size)
+// FilesMatchingGlob returns the files whose Destination, or base Name, match
+// the given glob pattern, including any left unchanged in earlier suitcases
+func (di Inventory) FilesMatchingGlob(glob string) ([]*File, error) {
+	if _, err := filepath.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("invalid glob %v: %w", glob, err)
 	}
+	ret := []*File{}
+	if err := di.EachOfAllFiles(func(f *File) error {
+		if filenameMatchesGlobs(f.Destination, []string{glob}) || filenameMatchesGlobs(f.Name, []string{glob}) {
+			ret = append(ret, f)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
 
-	return r
+// SuitcaseNameForFile returns the name of the suitcase holding the given file,
+// falling back to the index for inventories written without suitcase names
+func (di Inventory) SuitcaseNameForFile(f *File) string {
+	if f.SuitcaseName != "" {
+		return f.SuitcaseName
+	}
+	return di.SuitcaseNameWithIndex(f.SuitcaseIndex)
 }
 
 // Return total size and suitcases for a given directory
@@ -1474,75 +2162,6 @@ func containsString(s []string, e string) bool {
 	return false
 }
 
-// ArchiveTOC is a v4 TOC generator for archiver
-func ArchiveTOC(fn string) ([]string, error) {
-	fsys, err := archiver.FileSystem(context.Background(), fn)
-	if err != nil {
-		return nil, err
-	}
-	ret := []string{}
-	log := slog.With("archive", fn)
-
-	// Track visited paths to prevent infinite recursion in self-referential archives
-	visitedPaths := make(map[string]bool)
-	maxDepth := 1000  // Conservative depth limit
-	maxFiles := 100000 // Maximum files to prevent runaway processing
-	fileCount := 0
-	
-	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, walkErr error) error {
-		if walkErr != nil {
-			return walkErr
-		}
-		
-		// Check file count limit
-		fileCount++
-		if fileCount > maxFiles {
-			log.Warn("maximum file count exceeded, stopping walk", "path", path, "count", fileCount)
-			return fmt.Errorf("archive contains too many files (>%d)", maxFiles)
-		}
-		
-		// Count directory depth
-		depth := strings.Count(path, "/")
-		if depth > maxDepth {
-			log.Warn("maximum depth exceeded, stopping walk", "path", path, "depth", depth)
-			return fs.SkipDir
-		}
-		
-		// Track visited paths to detect cycles
-		if visitedPaths[path] {
-			log.Warn("cycle detected, skipping path", "path", path)
-			return fs.SkipDir
-		}
-		visitedPaths[path] = true
-		
-		// Handle: https://github.com/mholt/archiver/issues/383
-		// Detect self-referential archives that cause infinite recursion
-		if (path == ".") && d.Name() == "." && strings.Contains(fn, ".tar") {
-			log.Debug("detected potentially problematic self-referential archive", "archive", fn)
-			// Continue with extra safety checks
-		}
-		
-		log.Debug("examining path", "path", path, "depth", depth)
-		if !d.IsDir() {
-			ret = append(ret, path)
-			return nil
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	// Junky way to check this...
-	if (len(ret) == 1) && (ret[0] == ".") {
-		return nil, errors.New("could not scan a non archive file")
-	}
-
-	// I think we want to do this...
-	sort.Strings(ret)
-	return ret, nil
-}
-
 func mustStat(path string) fs.FileInfo {
 	st, err := os.Stat(path)
 	panicIfErr(err)
@@ -1557,10 +2176,11 @@ func CollectionWithDirs(d []string) (*Collection, error) {
 	ret := Collection{}
 	for _, di := range d {
 		err := filepath.WalkDir(di, func(path string, _ fs.DirEntry, _ error) error {
-			if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") {
+			if strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml") || strings.HasSuffix(path, ".json") {
 				i, err := NewInventoryWithFilename(path)
 				if err != nil {
 					log.Debug("ignoring file as it did not load as an inventory", "file", path)
+					return nil
 				}
 				ret[path] = *i
 			}
@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -200,6 +201,10 @@ func TestNewInventoryerWithFilename(t *testing.T) {
 			filename:     "thing.yml",
 			expectedType: "*inventory.VAMLer",
 		},
+		{
+			filename:     "thing.json",
+			expectedType: "*inventory.JSONer",
+		},
 	}
 	for _, tt := range tests {
 		got, err := NewInventoryerWithFilename(tt.filename)
@@ -277,6 +282,13 @@ func TestWalkDirLimit(t *testing.T) {
 	require.EqualError(t, err, "halt")
 }
 
+// archiveTOC is the table of contents of testdata/archives/archive.tar.gz
+var archiveTOC = []ArchiveEntry{
+	{Name: "archives/file1.txt", ModTime: time.Date(2023, 2, 14, 14, 1, 12, 0, time.UTC)},
+	{Name: "archives/sub/file2.txt", ModTime: time.Date(2023, 2, 14, 14, 1, 24, 0, time.UTC)},
+	{Name: "archives/thing.png", ModTime: time.Date(2023, 2, 14, 14, 2, 9, 0, time.UTC)},
+}
+
 func TestWonkyTOC(t *testing.T) {
 	got, err := ArchiveTOC("../testdata/archives/archive.tar.gz")
 	require.NoError(t, err)
@@ -298,15 +310,11 @@ func TestWalkDirExpandArchives(t *testing.T) {
 		t,
 		i.Files,
 		&File{
-			Path:        "../testdata/archives/archive.tar.gz",
-			Destination: "/archive.tar.gz",
-			Name:        "archive.tar.gz",
-			Size:        193,
-			ArchiveTOC: []string{
-				"archives/file1.txt",
-				"archives/sub/file2.txt",
-				"archives/thing.png",
-			},
+			Path:          "../testdata/archives/archive.tar.gz",
+			Destination:   "/archive.tar.gz",
+			Name:          "archive.tar.gz",
+			Size:          193,
+			ArchiveTOC:    archiveTOC,
 			SuitcaseIndex: 0,
 			SuitcaseName:  "",
 		},
@@ -323,15 +331,11 @@ func TestWalkDirExpandArchivesDeep(t *testing.T) {
 		t,
 		i.Files,
 		&File{
-			Path:        "../testdata/archives/archive.tar.gz",
-			Destination: "/archive.tar.gz",
-			Name:        "archive.tar.gz",
-			Size:        193,
-			ArchiveTOC: []string{
-				"archives/file1.txt",
-				"archives/sub/file2.txt",
-				"archives/thing.png",
-			},
+			Path:          "../testdata/archives/archive.tar.gz",
+			Destination:   "/archive.tar.gz",
+			Name:          "archive.tar.gz",
+			Size:          193,
+			ArchiveTOC:    archiveTOC,
 			SuitcaseIndex: 0,
 			SuitcaseName:  "",
 		},
@@ -453,6 +457,55 @@ func TestInventorySearch(t *testing.T) {
 			},
 		},
 	})
+
+	// Searches are queries, and their plain words still match directories
+	got = i.Search("another size>2500")
+	require.Equal(t, 1, len(got.Files))
+	require.Equal(t, "bar/qux/another.txt", got.Files[0].Destination)
+	got = i.Search("baz/ size>1500")
+	require.Empty(t, got.Files)
+	require.Equal(t, SearchDirMatches{
+		{
+			Directory:   "bar/baz",
+			TotalSize:   2000,
+			TotalSizeHR: "2.0 kB",
+			Suitcases:   []string{"suitcase-foo-02-of-05.tar.tsz"},
+		},
+	}, got.Directories)
+	require.Equal(t, 2, len(i.Search("ext:txt size>=2000").Files))
+	require.Nil(t, i.Search("ext:txt size>=2000").Directories)
+
+	// Anything that isn't a valid query is plain text
+	require.Empty(t, i.Search("size>lots").Files)
+	require.Equal(t, 3, len(i.Search("txt").Files))
+}
+
+func TestFilesMatchingGlob(t *testing.T) {
+	i := Inventory{
+		Options: &Options{Prefix: "suitcase", User: "foo", SuitcaseFormat: "tar"},
+		Files: []*File{
+			{Destination: "bar/baz/thing.txt", Name: "thing.txt", SuitcaseName: "suitcase-foo-01-of-02.tar"},
+			{Destination: "bar/baz/another.txt", Name: "another.txt", SuitcaseIndex: 2},
+			{Destination: "bar/qux/another.dat", Name: "another.dat", SuitcaseIndex: 1},
+		},
+		TotalIndexes: 2,
+	}
+	got, err := i.FilesMatchingGlob("bar/baz/*")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+
+	got, err = i.FilesMatchingGlob("*.txt")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+
+	got, err = i.FilesMatchingGlob("another.dat")
+	require.NoError(t, err)
+	require.Equal(t, []*File{i.Files[2]}, got)
+	require.Equal(t, "suitcase-foo-01-of-02.tar", i.SuitcaseNameForFile(got[0]))
+	require.Equal(t, "suitcase-foo-01-of-02.tar", i.SuitcaseNameForFile(i.Files[0]))
+
+	_, err = i.FilesMatchingGlob("[")
+	require.EqualError(t, err, "invalid glob [: syntax error in pattern")
 }
 
 func TestUniqueDirs(t *testing.T) {
@@ -490,6 +543,7 @@ func TestCollectionWithDirs(t *testing.T) {
 	require.NotNil(t, got)
 	require.Contains(t, *got, "../testdata/inventories/inventory1.yaml")
 	require.Contains(t, *got, "../testdata/inventories/sub/inventory2.yaml")
+	require.Contains(t, *got, "../testdata/inventories/sub/inventory3.json")
 }
 
 func TestAnalysis(t *testing.T) {
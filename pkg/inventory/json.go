@@ -0,0 +1,118 @@
+package inventory
+
+/*
+Read and write the inventory as JSON. Files are encoded one at a time so that
+inventories with millions of entries don't need a second full copy in memory
+while writing.
+*/
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+)
+
+// JSONer is the JSON inventory operator
+type JSONer struct{}
+
+// Write will write the inventory out to an io.Writer, streaming each file entry
+func (r *JSONer) Write(w io.Writer, i *Inventory) error {
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if i == nil {
+		return errors.New("inventory is nil")
+	}
+
+	slog.Debug("About to encode inventory in to json file")
+	writer := bufio.NewWriterSize(w, 10240)
+	if err := writeJSONInventory(writer, i); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// writeJSONInventory writes out the same document json.Marshal would, but
+// encodes the Files one by one
+func writeJSONInventory(w io.Writer, i *Inventory) error {
+	sv, err := json.Marshal(i.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, `{"schema_version":`+string(sv)+`,"files":`); err != nil {
+		return err
+	}
+	if i.Files == nil {
+		if _, err := io.WriteString(w, "null"); err != nil {
+			return err
+		}
+	} else {
+		if err := writeJSONFiles(w, i.Files); err != nil {
+			return err
+		}
+	}
+
+	// Everything else goes through the usual encoding, so new fields come
+	// along without any changes here
+	rest, err := json.Marshal(inventoryFields{inventoryAlias: (*inventoryAlias)(i)})
+	if err != nil {
+		return err
+	}
+	if len(rest) > len("{}") {
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	if _, err := w.Write(rest[1:]); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
+
+// inventoryAlias has the fields of an Inventory without any of its methods
+type inventoryAlias Inventory
+
+// inventoryFields encodes every field of an Inventory but the schema version
+// and Files, which are left empty here so they shadow the real ones
+type inventoryFields struct {
+	*inventoryAlias
+	SchemaVersion string  `json:"schema_version,omitempty"`
+	Files         []*File `json:"files,omitempty"`
+}
+
+func writeJSONFiles(w io.Writer, files []*File) error {
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	for idx, f := range files {
+		if idx > 0 {
+			if _, err := io.WriteString(w, ","); err != nil {
+				return err
+			}
+		}
+		b, err := json.Marshal(f)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, "]")
+	return err
+}
+
+// Read will read bytes in to an inventory
+func (r JSONer) Read(b []byte) (*Inventory, error) {
+	var inventory Inventory
+	if len(b) == 0 {
+		return &inventory, nil
+	}
+	if err := json.Unmarshal(b, &inventory); err != nil {
+		return nil, err
+	}
+	return &inventory, nil
+}
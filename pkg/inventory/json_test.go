@@ -0,0 +1,75 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONerWriteNil(t *testing.T) {
+	j := &JSONer{}
+	require.EqualError(t, j.Write(nil, nil), "writer is nil")
+	require.EqualError(t, j.Write(io.Discard, nil), "inventory is nil")
+}
+
+func TestJSONerWrite(t *testing.T) {
+	j := &JSONer{}
+	var w bytes.Buffer
+	require.NoError(t, j.Write(&w, &Inventory{}))
+	require.Contains(t, w.String(), `"files":null`)
+	require.JSONEq(t, `{"schema_version":"","files":null,"options":null,"total_indexes":0,"index_summaries":null,"internal_metadata":null,"external_metadata":null}`, w.String())
+}
+
+func TestJSONerWriteAllFields(t *testing.T) {
+	// Fields written outside of Files must all survive the trip
+	i := &Inventory{
+		SchemaVersion:  "x",
+		Files:          []*File{{Path: "/a", Destination: "a"}},
+		Delta:          &Delta{PreviousInventory: "old.json", Unchanged: []*File{{Path: "/b", Destination: "b"}}},
+		IgnoreRules:    []IgnoreRule{{Source: "/.ignore", Pattern: "*.tmp"}},
+		MetadataFields: map[string]any{"pi": "Joe"},
+	}
+	j := &JSONer{}
+	var w bytes.Buffer
+	require.NoError(t, j.Write(&w, i))
+	expected, err := json.Marshal(i)
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), w.String())
+}
+
+func TestJSONerReadNil(t *testing.T) {
+	j := &JSONer{}
+	_, err := j.Read(nil)
+	require.NoError(t, err)
+}
+
+func TestJSONerReadBad(t *testing.T) {
+	j := &JSONer{}
+	i, err := j.Read([]byte(`{"files": [`))
+	require.Error(t, err)
+	require.Nil(t, i)
+}
+
+func TestJSONerRoundTrip(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithHashAlgorithms(MD5Hash),
+		WithInventoryFormat("json"),
+	))
+	require.NoError(t, err)
+
+	// The streamed output must be the same document json.Marshal gives
+	j := &JSONer{}
+	var w bytes.Buffer
+	require.NoError(t, j.Write(&w, i))
+	expected, err := i.JSONString()
+	require.NoError(t, err)
+	require.JSONEq(t, expected, w.String())
+
+	got, err := j.Read(w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, i, got)
+}
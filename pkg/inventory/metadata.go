@@ -0,0 +1,303 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"gopkg.in/yaml.v3"
+)
+
+// externalMetadata is everything read in from Options.ExternalMetadataFiles
+type externalMetadata struct {
+	// raw is the content of every file, keyed by the absolute path
+	raw map[string]string
+	// fields are the merged fields of any YAML or JSON files
+	fields map[string]any
+}
+
+// readExternalMetadata reads in the external metadata files. YAML and JSON
+// files are parsed and merged together in order, so later files win. Anything
+// else is kept as plain text only
+func readExternalMetadata(files []string) (*externalMetadata, error) {
+	raw, err := GetMetadataWithFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	ret := &externalMetadata{raw: raw}
+	for _, f := range files {
+		abs, err := filepath.Abs(f)
+		if err != nil {
+			return nil, err
+		}
+		fields, err := parseMetadataFields(abs, []byte(raw[abs]))
+		if err != nil {
+			return nil, err
+		}
+		if fields == nil {
+			continue
+		}
+		if ret.fields == nil {
+			ret.fields = map[string]any{}
+		}
+		for k, v := range fields {
+			ret.fields[k] = v
+		}
+	}
+	if ret.fields == nil {
+		return ret, nil
+	}
+	// Round trip through JSON, so YAML and JSON values end up as the same types
+	b, err := json.Marshal(ret.fields)
+	if err != nil {
+		return nil, err
+	}
+	ret.fields = nil
+	if err := json.Unmarshal(b, &ret.fields); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// parseMetadataFields returns the top level fields of a YAML or JSON metadata
+// file, or nil for plain text
+func parseMetadataFields(fn string, data []byte) (map[string]any, error) {
+	var ret map[string]any
+	switch strings.ToLower(filepath.Ext(fn)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &ret); err != nil {
+			return nil, fmt.Errorf("could not parse metadata file %v: %w", fn, err)
+		}
+	case ".json":
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return nil, fmt.Errorf("could not parse metadata file %v: %w", fn, err)
+		}
+	default:
+		return nil, nil
+	}
+	if ret == nil {
+		// Empty documents still count as structured
+		ret = map[string]any{}
+	}
+	return ret, nil
+}
+
+// checkRequiredMetadata makes sure every one of required is set to something
+// in fields. Nested fields are given with dots, such as project.pi
+func checkRequiredMetadata(fields map[string]any, required []string) error {
+	missing := []string{}
+	for _, k := range required {
+		if isEmptyMetadata(lookupMetadata(fields, k)) {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required metadata: %v", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// lookupMetadata returns the value at the dotted path k in fields
+func lookupMetadata(fields map[string]any, k string) any {
+	var cur any = fields
+	for _, part := range strings.Split(k, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil
+		}
+		cur = m[part]
+	}
+	return cur
+}
+
+func isEmptyMetadata(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(t) == ""
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	default:
+		return false
+	}
+}
+
+// readMetadataSchema loads up a JSON schema file
+func readMetadataSchema(fn string) (*jsonschema.Schema, error) {
+	data, err := os.ReadFile(fn) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	var s jsonschema.Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("invalid metadata schema %v: %w", fn, err)
+	}
+	return &s, nil
+}
+
+// validateMetadata checks fields against s, returning every problem found.
+// This covers the commonly used keywords: type, enum, const, required,
+// properties, additionalProperties, items, string lengths, patterns and
+// numeric bounds
+func validateMetadata(s *jsonschema.Schema, fields map[string]any) error {
+	var problems []string
+	validateValue(s, fields, "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("metadata does not match schema: %v", strings.Join(problems, "; "))
+}
+
+func validateValue(s *jsonschema.Schema, v any, at string, problems *[]string) {
+	if s == nil {
+		return
+	}
+	fail := func(format string, args ...any) {
+		name := at
+		if name == "" {
+			name = "(root)"
+		}
+		*problems = append(*problems, name+": "+fmt.Sprintf(format, args...))
+	}
+	if isFalseSchema(s) {
+		fail("is not allowed")
+		return
+	}
+	if s.Type != "" && !matchesSchemaType(s.Type, v) {
+		fail("should be %v", s.Type)
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return reflect.DeepEqual(e, v) }) {
+		fail("should be one of %v", s.Enum)
+	}
+	if s.Const != nil && !reflect.DeepEqual(s.Const, v) {
+		fail("should be %v", s.Const)
+	}
+	switch t := v.(type) {
+	case map[string]any:
+		validateObject(s, t, at, problems, fail)
+	case []any:
+		if s.MinItems != nil && uint64(len(t)) < *s.MinItems {
+			fail("should have at least %v items", *s.MinItems)
+		}
+		if s.MaxItems != nil && uint64(len(t)) > *s.MaxItems {
+			fail("should have at most %v items", *s.MaxItems)
+		}
+		for idx, item := range t {
+			validateValue(s.Items, item, fmt.Sprintf("%v[%v]", at, idx), problems)
+		}
+	case string:
+		n := uint64(len([]rune(t)))
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("should be at least %v characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("should be at most %v characters", *s.MaxLength)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			switch {
+			case err != nil:
+				fail("has an invalid pattern %v", s.Pattern)
+			case !re.MatchString(t):
+				fail("should match %v", s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != "" {
+			if m, err := s.Minimum.Float64(); err == nil && t < m {
+				fail("should be at least %v", s.Minimum)
+			}
+		}
+		if s.Maximum != "" {
+			if m, err := s.Maximum.Float64(); err == nil && t > m {
+				fail("should be at most %v", s.Maximum)
+			}
+		}
+	}
+}
+
+func validateObject(s *jsonschema.Schema, m map[string]any, at string, problems *[]string, fail func(string, ...any)) {
+	for _, k := range s.Required {
+		if _, ok := m[k]; !ok {
+			fail("missing required property %v", k)
+		}
+	}
+	for k, v := range m {
+		var prop *jsonschema.Schema
+		if s.Properties != nil {
+			prop, _ = s.Properties.Get(k)
+		}
+		if prop == nil {
+			prop = s.AdditionalProperties
+		}
+		validateValue(prop, v, strings.TrimPrefix(at+"."+k, "."), problems)
+	}
+}
+
+func matchesSchemaType(typ string, v any) bool {
+	switch typ {
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "number":
+		_, ok := v.(float64)
+		return ok
+	case "integer":
+		f, ok := v.(float64)
+		return ok && f == math.Trunc(f)
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "null":
+		return v == nil
+	default:
+		return true
+	}
+}
+
+func isFalseSchema(s *jsonschema.Schema) bool {
+	b, err := s.MarshalJSON()
+	return err == nil && bytes.Equal(b, []byte("false"))
+}
+
+// validateMetadataFields checks the external metadata fields against the
+// schema and required fields from the options
+func (di *Inventory) validateMetadataFields() error {
+	if di.Options.MetadataSchema == "" && len(di.Options.RequiredMetadata) == 0 {
+		return nil
+	}
+	if len(di.Options.ExternalMetadataFiles) > 0 && di.MetadataFields == nil {
+		return errors.New("metadata can only be checked in YAML or JSON external metadata files")
+	}
+	if di.Options.MetadataSchema != "" {
+		s, err := readMetadataSchema(di.Options.MetadataSchema)
+		if err != nil {
+			return err
+		}
+		if err := validateMetadata(s, di.MetadataFields); err != nil {
+			return err
+		}
+	}
+	return checkRequiredMetadata(di.MetadataFields, di.Options.RequiredMetadata)
+}
@@ -0,0 +1,142 @@
+package inventory
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/require"
+)
+
+func writeMetadataFiles(t *testing.T) (string, []string) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"project.yaml":   "pi: Jane Doe\ngrant: NSF-1234\nproject:\n  name: telescope\n  tags: [raw, 2023]\n",
+		"retention.json": `{"retention": "10y", "grant": "NSF-5678"}`,
+		"README.txt":     "Just some notes about the data\n",
+	}
+	ret := []string{}
+	for _, fn := range []string{"project.yaml", "retention.json", "README.txt"} {
+		ret = append(ret, path.Join(dir, fn))
+		require.NoError(t, os.WriteFile(path.Join(dir, fn), []byte(files[fn]), 0o644))
+	}
+	return dir, ret
+}
+
+func TestExternalMetadata(t *testing.T) {
+	dir, files := writeMetadataFiles(t)
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files...),
+		WithRequiredMetadata("pi", "grant", "retention", "project.name"),
+	))
+	require.NoError(t, err)
+	require.Equal(t, 3, len(i.ExternalMetadata))
+	require.Equal(t, "Just some notes about the data\n", i.ExternalMetadata[path.Join(dir, "README.txt")])
+	require.Equal(t, map[string]any{
+		"pi":        "Jane Doe",
+		"grant":     "NSF-5678",
+		"retention": "10y",
+		"project": map[string]any{
+			"name": "telescope",
+			"tags": []any{"raw", float64(2023)},
+		},
+	}, i.MetadataFields)
+
+	// Fields make it through a write and read
+	var buf bytes.Buffer
+	require.NoError(t, (&JSONer{}).Write(&buf, i))
+	got, err := (&JSONer{}).Read(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, i.MetadataFields, got.MetadataFields)
+}
+
+func TestRequiredMetadata(t *testing.T) {
+	_, files := writeMetadataFiles(t)
+	_, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files[0]),
+		WithRequiredMetadata("pi", "grant", "retention", "project.owner"),
+	))
+	require.EqualError(t, err, "missing required metadata: retention, project.owner")
+
+	// Nothing to look in at all
+	_, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithRequiredMetadata("pi"),
+	))
+	require.EqualError(t, err, "missing required metadata: pi")
+
+	_, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files[2]),
+		WithRequiredMetadata("pi"),
+	))
+	require.EqualError(t, err, "metadata can only be checked in YAML or JSON external metadata files")
+}
+
+func TestMetadataSchema(t *testing.T) {
+	dir, files := writeMetadataFiles(t)
+	schema := path.Join(dir, "schema.json")
+	require.NoError(t, os.WriteFile(schema, []byte(`{
+  "type": "object",
+  "required": ["pi", "grant", "retention"],
+  "properties": {
+    "pi": {"type": "string", "minLength": 1},
+    "grant": {"type": "string", "pattern": "^NSF-[0-9]+$"},
+    "retention": {"enum": ["1y", "5y", "10y"]},
+    "project": {
+      "type": "object",
+      "properties": {"tags": {"type": "array", "items": {"type": "string"}}},
+      "additionalProperties": {"type": "string"}
+    }
+  },
+  "additionalProperties": false
+}`), 0o644))
+
+	_, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files...),
+		WithMetadataSchema(schema),
+	))
+	require.EqualError(t, err, "metadata does not match schema: project.tags[1]: should be string")
+
+	extra := path.Join(dir, "extra.yaml")
+	require.NoError(t, os.WriteFile(extra, []byte("grant: ABC\nretention: forever\nproject: {tags: []}\ncolor: blue\n"), 0o644))
+	_, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files[0], extra),
+		WithMetadataSchema(schema),
+	))
+	require.EqualError(t, err, "metadata does not match schema: color: is not allowed; grant: should match ^NSF-[0-9]+$; retention: should be one of [1y 5y 10y]")
+
+	_, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(files[0]),
+		WithMetadataSchema(schema),
+	))
+	require.ErrorContains(t, err, "(root): missing required property retention")
+
+	good := path.Join(dir, "good.yaml")
+	require.NoError(t, os.WriteFile(good, []byte("pi: Jane\ngrant: NSF-1\nretention: 5y\nproject: {name: scope, tags: [a, b]}\n"), 0o644))
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{t.TempDir()}),
+		WithExternalMetadataFiles(good),
+		WithMetadataSchema(schema),
+	))
+	require.NoError(t, err)
+	require.Equal(t, "Jane", i.MetadataFields["pi"])
+}
+
+func TestMetadataOptionsWithViper(t *testing.T) {
+	v := viper.New()
+	v.Set("metadata-schema", "/tmp/schema.json")
+	v.Set("required-metadata", []string{"pi", "grant"})
+	o := &Options{}
+	setMetadataSchema(*v, o)
+	setRequiredMetadata(*v, o)
+	require.Equal(t, "/tmp/schema.json", o.MetadataSchema)
+	require.Equal(t, []string{"pi", "grant"}, o.RequiredMetadata)
+}
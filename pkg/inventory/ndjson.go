@@ -0,0 +1,450 @@
+package inventory
+
+/*
+Streaming inventories, written as newline delimited JSON. The first line is a
+header record with the options and metadata, followed by one line per file, and
+finally a trailer record with the index summaries. Nothing here needs the whole
+list of files in memory at once, which lets very large trees be inventoried and
+packed with bounded memory.
+*/
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/dustin/go-humanize"
+)
+
+const (
+	ndjsonHeader  = "header"
+	ndjsonFile    = "file"
+	ndjsonTrailer = "trailer"
+)
+
+// ndjsonRecord is a single line in an NDJSON inventory. Only the fields for
+// the given Type are set
+type ndjsonRecord struct {
+	Type             string                       `json:"type"`
+	SchemaVersion    string                       `json:"schema_version,omitempty"`
+	Options          *Options                     `json:"options,omitempty"`
+	InternalMetadata map[string]string            `json:"internal_metadata,omitempty"`
+	ExternalMetadata map[string]string            `json:"external_metadata,omitempty"`
+	MetadataFields   map[string]any               `json:"metadata_fields,omitempty"`
+	IgnoreRules      []IgnoreRule                 `json:"ignore_rules,omitempty"`
+	Excluded         map[string]*ExclusionSummary `json:"excluded,omitempty"`
+	EntryCounts      map[EntryType]int            `json:"entry_counts,omitempty"`
+	File             *File                        `json:"file,omitempty"`
+	TotalIndexes     int                          `json:"total_indexes,omitempty"`
+	IndexSummaries   map[int]*IndexSummary        `json:"index_summaries,omitempty"`
+}
+
+// IsNDJSONFilename returns true if the filename looks like a streaming inventory
+func IsNDJSONFilename(s string) bool {
+	switch filepath.Ext(s) {
+	case ".ndjson", ".jsonl":
+		return true
+	default:
+		return false
+	}
+}
+
+// NDJSONWriter writes a streaming inventory one record at a time
+type NDJSONWriter struct {
+	w   *bufio.Writer
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter returns a new NDJSONWriter writing to w
+func NewNDJSONWriter(w io.Writer) *NDJSONWriter {
+	bw := bufio.NewWriterSize(w, 10240)
+	return &NDJSONWriter{
+		w:   bw,
+		enc: json.NewEncoder(bw),
+	}
+}
+
+// WriteHeader writes the options and metadata of the inventory
+func (n *NDJSONWriter) WriteHeader(i *Inventory) error {
+	return n.enc.Encode(ndjsonRecord{
+		Type:             ndjsonHeader,
+		SchemaVersion:    i.SchemaVersion,
+		Options:          i.Options,
+		InternalMetadata: i.InternalMetadata,
+		ExternalMetadata: i.ExternalMetadata,
+		MetadataFields:   i.MetadataFields,
+		IgnoreRules:      i.IgnoreRules,
+		Excluded:         i.Excluded,
+		EntryCounts:      i.EntryCounts,
+	})
+}
+
+// WriteFile writes a single file record
+func (n *NDJSONWriter) WriteFile(f *File) error {
+	return n.enc.Encode(ndjsonRecord{
+		Type: ndjsonFile,
+		File: f,
+	})
+}
+
+// WriteTrailer writes the index summaries of the inventory, and flushes
+// everything out to the underlying writer
+func (n *NDJSONWriter) WriteTrailer(i *Inventory) error {
+	if err := n.enc.Encode(ndjsonRecord{
+		Type:           ndjsonTrailer,
+		TotalIndexes:   i.TotalIndexes,
+		IndexSummaries: i.IndexSummaries,
+	}); err != nil {
+		return err
+	}
+	return n.Flush()
+}
+
+// Flush writes any buffered records to the underlying writer
+func (n *NDJSONWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// NDJSONReader iterates through a streaming inventory one file at a time
+type NDJSONReader struct {
+	dec    *json.Decoder
+	closer io.Closer
+	header *Inventory
+}
+
+// NewNDJSONReader reads the header record from r and returns a reader
+// positioned at the first file
+func NewNDJSONReader(r io.Reader) (*NDJSONReader, error) {
+	ret := &NDJSONReader{
+		dec: json.NewDecoder(bufio.NewReaderSize(r, 10240)),
+	}
+	var rec ndjsonRecord
+	if err := ret.dec.Decode(&rec); err != nil {
+		return nil, fmt.Errorf("could not read inventory header: %w", err)
+	}
+	if rec.Type != ndjsonHeader {
+		return nil, fmt.Errorf("expected a header record but got: %v", rec.Type)
+	}
+	ret.header = &Inventory{
+		SchemaVersion:    rec.SchemaVersion,
+		Options:          rec.Options,
+		InternalMetadata: rec.InternalMetadata,
+		ExternalMetadata: rec.ExternalMetadata,
+		MetadataFields:   rec.MetadataFields,
+		IgnoreRules:      rec.IgnoreRules,
+		Excluded:         rec.Excluded,
+		EntryCounts:      rec.EntryCounts,
+	}
+	return ret, nil
+}
+
+// NewNDJSONReaderWithFilename opens up a streaming inventory file. Close the
+// reader when finished with it
+func NewNDJSONReaderWithFilename(s string) (*NDJSONReader, error) {
+	f, err := os.Open(s) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	ret, err := NewNDJSONReader(f)
+	if err != nil {
+		dclose(f)
+		return nil, err
+	}
+	ret.closer = f
+	return ret, nil
+}
+
+// Inventory returns the inventory described by the header, without any Files.
+// TotalIndexes and IndexSummaries are filled in once Next has reached the trailer
+func (n *NDJSONReader) Inventory() *Inventory {
+	return n.header
+}
+
+// Next returns the next file in the inventory, or io.EOF once the trailer
+// has been read
+func (n *NDJSONReader) Next() (*File, error) {
+	var rec ndjsonRecord
+	if err := n.dec.Decode(&rec); err != nil {
+		if err == io.EOF {
+			return nil, errors.New("inventory ended without a trailer record")
+		}
+		return nil, err
+	}
+	switch rec.Type {
+	case ndjsonFile:
+		if rec.File == nil {
+			return nil, errors.New("file record is missing the file")
+		}
+		return rec.File, nil
+	case ndjsonTrailer:
+		n.header.TotalIndexes = rec.TotalIndexes
+		n.header.IndexSummaries = rec.IndexSummaries
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("unexpected record type in inventory: %v", rec.Type)
+	}
+}
+
+// Close closes the underlying file, if the reader opened one
+func (n *NDJSONReader) Close() error {
+	if n.closer == nil {
+		return nil
+	}
+	return n.closer.Close()
+}
+
+// NDJSONer reads and writes whole inventories in the streaming format
+type NDJSONer struct{}
+
+// Write will write the inventory out to an io.Writer
+func (r *NDJSONer) Write(w io.Writer, i *Inventory) error {
+	if w == nil {
+		return errors.New("writer is nil")
+	}
+	if i == nil {
+		return errors.New("inventory is nil")
+	}
+	nw := NewNDJSONWriter(w)
+	if err := nw.WriteHeader(i); err != nil {
+		return err
+	}
+	for _, f := range i.Files {
+		if err := nw.WriteFile(f); err != nil {
+			return err
+		}
+	}
+	return nw.WriteTrailer(i)
+}
+
+// Read will read bytes in to an inventory, loading every file in to memory.
+// Use NDJSONReader to iterate instead
+func (r NDJSONer) Read(b []byte) (*Inventory, error) {
+	nr, err := NewNDJSONReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	ret := nr.Inventory()
+	for {
+		f, err := nr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		ret.Files = append(ret.Files, f)
+	}
+	ret.expandSuitcaseNames()
+	return ret, nil
+}
+
+// NewStreamingInventoryWithFilename reads the header and trailer of an NDJSON
+// inventory, without holding on to any of the files. Use EachFile to iterate
+// through them
+func NewStreamingInventoryWithFilename(s string) (*Inventory, error) {
+	nr, err := NewNDJSONReaderWithFilename(s)
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(nr)
+	for {
+		_, err := nr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	ret := nr.Inventory()
+	if err := ret.migrate(); err != nil {
+		return nil, err
+	}
+	ret.streamFile = s
+	return ret, nil
+}
+
+// EachFile calls fn for every file in the inventory. Streaming inventories
+// read the files back from disk one at a time instead of holding them in memory
+func (di Inventory) EachFile(fn func(*File) error) error {
+	if di.streamFile == "" {
+		for _, f := range di.Files {
+			if err := fn(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	nr, err := NewNDJSONReaderWithFilename(di.streamFile)
+	if err != nil {
+		return err
+	}
+	defer dclose(nr)
+	for {
+		f, err := nr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, m := range di.fileMigrations {
+			m(&di, f)
+		}
+		if f.SuitcaseName == "" {
+			f.SuitcaseName = di.SuitcaseNameWithIndex(f.SuitcaseIndex)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// NewDirectoryInventoryStream creates a new inventory using options, and
+// writes it to w as NDJSON. Files are spooled to a temporary file while
+// walking, then indexed as they are streamed back out, so the full list of
+// files is never held in memory. The returned Inventory has no Files
+func NewDirectoryInventoryStream(opts *Options, w io.Writer) (*Inventory, error) {
+	if opts.PreviousInventory != "" {
+		return nil, errors.New("incremental inventories can not be written as a stream")
+	}
+	ret, err := newInventoryWithMetadata(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	spool, err := os.CreateTemp("", "suitcase-inventory-*.ndjson")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		dclose(spool)
+		if rerr := os.Remove(spool.Name()); rerr != nil {
+			slog.Warn("could not remove inventory spool", "file", spool.Name(), "error", rerr)
+		}
+	}()
+
+	sw := NewNDJSONWriter(spool)
+	if err := sw.WriteHeader(ret); err != nil {
+		return nil, err
+	}
+	state, err := walkDirs(opts, sw.WriteFile)
+	if err != nil {
+		return nil, err
+	}
+	state.record(ret)
+	if err := sw.WriteTrailer(ret); err != nil {
+		return nil, err
+	}
+
+	if _, err := spool.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	sr, err := NewNDJSONReader(spool)
+	if err != nil {
+		return nil, err
+	}
+	if err := IndexNDJSON(sr, NewNDJSONWriter(w), ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// IndexNDJSON streams the files from r to w, assigning suitcase indexes based
+// on i.Options.MaxSuitcaseSize as it goes. Files can't be sorted by size
+// without loading them all, so this is a first-fit or best-fit in walk order.
+// The total number of suitcases isn't known until the end, so suitcase names
+// are left off the file records and filled in from the index when read back.
+// The TotalIndexes and IndexSummaries of i are filled in, and written as the
+// trailer
+func IndexNDJSON(r *NDJSONReader, w *NDJSONWriter, i *Inventory) error {
+	if i.Options.PackingStrategy == NullPacking {
+		i.Options.PackingStrategy = FirstFitPacking
+	}
+	idx, err := newStreamIndexer(i.Options.MaxSuitcaseSize, i.Options.PackingStrategy)
+	if err != nil {
+		return err
+	}
+	if err := w.WriteHeader(i); err != nil {
+		return err
+	}
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		files := []*File{f}
+		if i.Options.SplitLargeFiles {
+			if files, err = splitLargeFiles(files, i.Options.MaxSuitcaseSize, i.Options.HashAlgorithm); err != nil {
+				return err
+			}
+		}
+		for _, item := range files {
+			if err := idx.add(item); err != nil {
+				return err
+			}
+			if err := w.WriteFile(item); err != nil {
+				return err
+			}
+		}
+	}
+	i.TotalIndexes = idx.numCases()
+	i.IndexSummaries = idx.summaries
+	return w.WriteTrailer(i)
+}
+
+// streamIndexer assigns suitcase indexes one file at a time, only keeping
+// track of the free space left in each suitcase
+type streamIndexer struct {
+	bins      *bins
+	fit       func(*bins, int64) int
+	summaries map[int]*IndexSummary
+}
+
+func newStreamIndexer(maxSize int64, strategy PackingStrategy) (*streamIndexer, error) {
+	ret := &streamIndexer{
+		bins:      newBins(maxSize),
+		summaries: map[int]*IndexSummary{},
+	}
+	switch strategy {
+	case NullPacking, FirstFitPacking:
+		ret.fit = (*bins).firstFit
+	case BestFitPacking:
+		ret.fit = (*bins).bestFit
+	default:
+		return nil, fmt.Errorf("%v packing needs every file up front, and can not be used with streaming inventories", strategy)
+	}
+	return ret, nil
+}
+
+func (s *streamIndexer) numCases() int {
+	return len(s.bins.free)
+}
+
+func (s *streamIndexer) add(item *File) error {
+	if s.bins.maxSize == 0 {
+		item.SuitcaseIndex = 1
+	} else {
+		if err := checkItemSize(item, s.bins.maxSize); err != nil {
+			return err
+		}
+		item.SuitcaseIndex = s.bins.put(s.fit(s.bins, item.StoredSize()), item.StoredSize())
+	}
+	if _, ok := s.summaries[item.SuitcaseIndex]; !ok {
+		s.summaries[item.SuitcaseIndex] = &IndexSummary{}
+	}
+	sum := s.summaries[item.SuitcaseIndex]
+	sum.Count++
+	sum.Size += item.StoredSize()
+	sum.HumanSize = humanize.Bytes(int64ToUint64(sum.Size))
+	return nil
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNDJSONerRoundTrip(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithInventoryFormat("ndjson"),
+	))
+	require.NoError(t, err)
+
+	n := &NDJSONer{}
+	var w bytes.Buffer
+	require.NoError(t, n.Write(&w, i))
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	require.Equal(t, len(i.Files)+2, len(lines))
+	require.Contains(t, lines[0], `"type":"header"`)
+	require.Contains(t, lines[len(lines)-1], `"type":"trailer"`)
+
+	got, err := n.Read(w.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, i, got)
+}
+
+func TestNDJSONerWriteNil(t *testing.T) {
+	n := &NDJSONer{}
+	require.EqualError(t, n.Write(nil, nil), "writer is nil")
+	require.EqualError(t, n.Write(io.Discard, nil), "inventory is nil")
+}
+
+func TestNDJSONReaderBad(t *testing.T) {
+	_, err := NewNDJSONReader(strings.NewReader(`{"type":"file","file":{"name":"foo"}}`))
+	require.EqualError(t, err, "expected a header record but got: file")
+
+	_, err = NewNDJSONReader(strings.NewReader(""))
+	require.EqualError(t, err, "could not read inventory header: EOF")
+
+	r, err := NewNDJSONReader(strings.NewReader(`{"type":"header"}
+{"type":"file","file":{"name":"foo"}}`))
+	require.NoError(t, err)
+	f, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "foo", f.Name)
+	_, err = r.Next()
+	require.EqualError(t, err, "inventory ended without a trailer record")
+}
+
+func TestNewDirectoryInventoryStream(t *testing.T) {
+	fn := path.Join(t.TempDir(), "inventory.ndjson")
+	out, err := os.Create(fn)
+	require.NoError(t, err)
+	got, err := NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithMaxSuitcaseSize(64),
+	), out)
+	require.NoError(t, err)
+	require.NoError(t, out.Close())
+	require.Nil(t, got.Files)
+
+	expected, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithMaxSuitcaseSize(64),
+	))
+	require.NoError(t, err)
+
+	i, err := NewStreamingInventoryWithFilename(fn)
+	require.NoError(t, err)
+	require.Nil(t, i.Files)
+	require.Equal(t, got.TotalIndexes, i.TotalIndexes)
+	require.Equal(t, expected.Analyze().FileCount, func() uint {
+		var total uint
+		for _, s := range i.IndexSummaries {
+			total += s.Count
+		}
+		return total
+	}())
+
+	var seen []*File
+	require.NoError(t, i.EachFile(func(f *File) error {
+		require.LessOrEqual(t, f.Size, int64(64))
+		require.Equal(t, i.SuitcaseNameWithIndex(f.SuitcaseIndex), f.SuitcaseName)
+		seen = append(seen, f)
+		return nil
+	}))
+	require.Equal(t, len(expected.Files), len(seen))
+	matched, err := i.FilesMatchingGlob("*")
+	require.NoError(t, err)
+	require.Equal(t, len(expected.Files), len(matched))
+	require.NoError(t, i.ValidateAccess())
+}
+
+func TestIndexNDJSON(t *testing.T) {
+	var src bytes.Buffer
+	sw := NewNDJSONWriter(&src)
+	i := &Inventory{Options: &Options{MaxSuitcaseSize: 10}}
+	require.NoError(t, sw.WriteHeader(i))
+	for _, size := range []int64{6, 6, 4, 3} {
+		require.NoError(t, sw.WriteFile(&File{Size: size}))
+	}
+	require.NoError(t, sw.WriteTrailer(i))
+
+	r, err := NewNDJSONReader(&src)
+	require.NoError(t, err)
+	var dst bytes.Buffer
+	require.NoError(t, IndexNDJSON(r, NewNDJSONWriter(&dst), i))
+	require.Equal(t, 2, i.TotalIndexes)
+	require.Equal(t, uint(2), i.IndexSummaries[1].Count)
+	require.Equal(t, int64(10), i.IndexSummaries[1].Size)
+	require.Equal(t, int64(9), i.IndexSummaries[2].Size)
+
+	got, err := NDJSONer{}.Read(dst.Bytes())
+	require.NoError(t, err)
+	indexes := []int{}
+	for _, f := range got.Files {
+		indexes = append(indexes, f.SuitcaseIndex)
+	}
+	require.Equal(t, []int{1, 2, 1, 2}, indexes)
+
+	r, err = NewNDJSONReader(strings.NewReader(`{"type":"header"}
+{"type":"file","file":{"size":11}}`))
+	require.NoError(t, err)
+	require.Error(t, IndexNDJSON(r, NewNDJSONWriter(io.Discard), i))
+}
@@ -0,0 +1,283 @@
+package inventory
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/invopop/jsonschema"
+	"github.com/spf13/cobra"
+)
+
+// PackingStrategy decides which suitcase each file in an inventory goes in to
+type PackingStrategy int
+
+const (
+	// NullPacking is the unset value, and packs the same as FirstFitPacking
+	NullPacking PackingStrategy = iota
+	// FirstFitPacking puts each file, largest first, in the first suitcase with room
+	FirstFitPacking
+	// BestFitPacking puts each file, largest first, in the fullest suitcase it still fits in
+	BestFitPacking
+	// DirectoryLocalityPacking tries to keep files from the same directory together
+	DirectoryLocalityPacking
+)
+
+var packingMap = map[string]PackingStrategy{
+	"first-fit":          FirstFitPacking,
+	"best-fit":           BestFitPacking,
+	"directory-locality": DirectoryLocalityPacking,
+	"":                   NullPacking,
+}
+
+var packingHelp = map[string]string{
+	"first-fit":          "Largest files first, in to the first suitcase with room. Fast, and the default",
+	"best-fit":           "Largest files first, in to the fullest suitcase with room. Usually packs a little tighter",
+	"directory-locality": "Keep files from the same directory in the same suitcase where possible, which makes partial restores cheaper",
+}
+
+// PackingCompletion returns shell completion
+func PackingCompletion(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	help := []string{}
+	for _, strategy := range nonEmptyKeys(packingMap) {
+		if strings.Contains(strategy, toComplete) {
+			help = append(help, fmt.Sprintf("%v\t%v", strategy, packingHelp[strategy]))
+		}
+	}
+	return help, cobra.ShellCompDirectiveNoFileComp
+}
+
+// String satisfies the pflags interface
+func (p PackingStrategy) String() string {
+	m := reverseMap(packingMap)
+	if v, ok := m[p]; ok {
+		return v
+	}
+	panic("invalid packing strategy")
+}
+
+// Type satisfies part of the pflags.Value interface
+func (p PackingStrategy) Type() string {
+	return "PackingStrategy"
+}
+
+// Set helps fulfill the pflag.Value interface
+func (p *PackingStrategy) Set(v string) error {
+	if v, ok := packingMap[v]; ok {
+		*p = v
+		return nil
+	}
+	return fmt.Errorf("PackingStrategy should be one of: %v", nonEmptyKeys(packingMap))
+}
+
+// MarshalJSON ensures that json conversions use the string value here, not the int value
+func (p *PackingStrategy) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"%v\"", p.String())), nil
+}
+
+// UnmarshalJSON reads the string value written by MarshalJSON back in
+func (p *PackingStrategy) UnmarshalJSON(b []byte) error {
+	var v string
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	return p.Set(v)
+}
+
+// JSONSchema describes PackingStrategy as the string MarshalJSON writes
+func (PackingStrategy) JSONSchema() *jsonschema.Schema {
+	return &jsonschema.Schema{Type: "string", Enum: stringEnum(packingMap)}
+}
+
+// MarshalYAML writes out the string value, so inventories stay readable
+func (p PackingStrategy) MarshalYAML() (interface{}, error) {
+	return p.String(), nil
+}
+
+// UnmarshalYAML reads the string value written by MarshalYAML back in
+func (p *PackingStrategy) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v string
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return p.Set(v)
+}
+
+// Packer assigns a SuitcaseIndex to every file, returning the number of
+// suitcases used. Packers must be deterministic, so that the same set of files
+// always packs the same way
+type Packer interface {
+	Pack(files []*File, maxSize int64) (int, error)
+}
+
+// Packer returns the Packer implementing the strategy
+func (p PackingStrategy) Packer() Packer {
+	switch p {
+	case BestFitPacking:
+		return bestFitPacker{}
+	case DirectoryLocalityPacking:
+		return directoryLocalityPacker{}
+	default:
+		return firstFitPacker{}
+	}
+}
+
+// bins keeps track of the space left in each suitcase. Suitcase indexes start
+// at 1, so bin i is suitcase i+1
+type bins struct {
+	maxSize int64
+	free    []int64
+}
+
+func newBins(maxSize int64) *bins {
+	return &bins{
+		maxSize: maxSize,
+		free:    []int64{maxSize},
+	}
+}
+
+// firstFit returns the index of the first suitcase with room for size, or 0
+func (b *bins) firstFit(size int64) int {
+	for idx, left := range b.free {
+		if size <= left {
+			return idx + 1
+		}
+	}
+	return 0
+}
+
+// bestFit returns the index of the fullest suitcase with room for size, or 0
+func (b *bins) bestFit(size int64) int {
+	best := 0
+	for idx, left := range b.free {
+		if size <= left && (best == 0 || left < b.free[best-1]) {
+			best = idx + 1
+		}
+	}
+	return best
+}
+
+// put adds size to the suitcase at index, opening a new one when index is 0
+func (b *bins) put(index int, size int64) int {
+	if index == 0 {
+		b.free = append(b.free, b.maxSize)
+		index = len(b.free)
+	}
+	b.free[index-1] -= size
+	return index
+}
+
+// bySizeDescending sorts files largest first, falling back on the destination
+// and then the segment index so that equally sized files always end up in the
+// same order. Segments of a file share its path and destination
+func bySizeDescending(files []*File) {
+	sort.SliceStable(files, func(i, j int) bool {
+		if files[i].StoredSize() != files[j].StoredSize() {
+			return files[i].StoredSize() > files[j].StoredSize()
+		}
+		if files[i].Destination != files[j].Destination {
+			return files[i].Destination < files[j].Destination
+		}
+		return segmentIndex(files[i]) < segmentIndex(files[j])
+	})
+}
+
+// segmentIndex returns the index of the segment f is, or 0 for whole files
+func segmentIndex(f *File) int {
+	if f.Segment == nil {
+		return 0
+	}
+	return f.Segment.Index
+}
+
+// packEach sorts the files and places them one by one using fit
+func packEach(files []*File, maxSize int64, fit func(*bins, int64) int) (int, error) {
+	bySizeDescending(files)
+	if maxSize == 0 {
+		for _, item := range files {
+			item.SuitcaseIndex = 1
+		}
+		return 1, nil
+	}
+	b := newBins(maxSize)
+	for _, item := range files {
+		if err := checkItemSize(item, maxSize); err != nil {
+			return 0, err
+		}
+		item.SuitcaseIndex = b.put(fit(b, item.StoredSize()), item.StoredSize())
+	}
+	return len(b.free), nil
+}
+
+type firstFitPacker struct{}
+
+func (firstFitPacker) Pack(files []*File, maxSize int64) (int, error) {
+	return packEach(files, maxSize, (*bins).firstFit)
+}
+
+type bestFitPacker struct{}
+
+func (bestFitPacker) Pack(files []*File, maxSize int64) (int, error) {
+	return packEach(files, maxSize, (*bins).bestFit)
+}
+
+// directoryLocalityPacker places whole directories at a time, largest first,
+// in the first suitcase with room for all of it. Directories too big for any
+// one suitcase are spread out file by file
+type directoryLocalityPacker struct{}
+
+func (directoryLocalityPacker) Pack(files []*File, maxSize int64) (int, error) {
+	if maxSize == 0 {
+		return firstFitPacker{}.Pack(files, maxSize)
+	}
+	groups := map[string][]*File{}
+	totals := map[string]int64{}
+	for _, item := range files {
+		if err := checkItemSize(item, maxSize); err != nil {
+			return 0, err
+		}
+		dir := path.Dir(item.Destination)
+		groups[dir] = append(groups[dir], item)
+		totals[dir] += item.StoredSize()
+	}
+	dirs := make([]string, 0, len(groups))
+	for dir := range groups {
+		dirs = append(dirs, dir)
+	}
+	sort.Slice(dirs, func(i, j int) bool {
+		if totals[dirs[i]] != totals[dirs[j]] {
+			return totals[dirs[i]] > totals[dirs[j]]
+		}
+		return dirs[i] < dirs[j]
+	})
+
+	b := newBins(maxSize)
+	sorted := make([]*File, 0, len(files))
+	for _, dir := range dirs {
+		group := groups[dir]
+		bySizeDescending(group)
+		if totals[dir] <= maxSize {
+			index := b.put(b.firstFit(totals[dir]), totals[dir])
+			for _, item := range group {
+				item.SuitcaseIndex = index
+			}
+		} else {
+			for _, item := range group {
+				item.SuitcaseIndex = b.put(b.firstFit(item.StoredSize()), item.StoredSize())
+			}
+		}
+		sorted = append(sorted, group...)
+	}
+	copy(files, sorted)
+	return len(b.free), nil
+}
+
+func mustPackingStrategy(s string) PackingStrategy {
+	var p PackingStrategy
+	if err := p.Set(s); err != nil {
+		panic(err)
+	}
+	return p
+}
@@ -0,0 +1,152 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func packedIndexes(t *testing.T, files []*File, strategy PackingStrategy, maxSize int64) map[string]int {
+	i := &Inventory{
+		Files:   files,
+		Options: &Options{PackingStrategy: strategy},
+	}
+	require.NoError(t, i.IndexWithSize(maxSize))
+	ret := map[string]int{}
+	for _, f := range i.Files {
+		ret[f.Path] = f.SuitcaseIndex
+	}
+	return ret
+}
+
+func TestPackingStrategies(t *testing.T) {
+	files := func() []*File {
+		return []*File{
+			{Path: "one", Destination: "/a/one", Size: 1},
+			{Path: "three", Destination: "/b/three", Size: 3},
+			{Path: "six", Destination: "/a/six", Size: 6},
+			{Path: "eight", Destination: "/b/eight", Size: 8},
+		}
+	}
+	require.Equal(t,
+		map[string]int{"eight": 1, "six": 2, "three": 2, "one": 1},
+		packedIndexes(t, files(), FirstFitPacking, 10),
+	)
+	require.Equal(t,
+		map[string]int{"eight": 1, "six": 2, "three": 2, "one": 2},
+		packedIndexes(t, files(), BestFitPacking, 10),
+	)
+	require.Equal(t,
+		map[string]int{"eight": 1, "three": 1, "six": 2, "one": 2},
+		packedIndexes(t, files(), DirectoryLocalityPacking, 12),
+	)
+	// Unset packs the same as first-fit
+	require.Equal(t,
+		packedIndexes(t, files(), FirstFitPacking, 10),
+		packedIndexes(t, files(), NullPacking, 10),
+	)
+}
+
+func TestPackingDeterministic(t *testing.T) {
+	files := []*File{}
+	for _, size := range []int64{5, 5, 5, 3, 3, 2, 2, 2, 1, 1, 7, 9} {
+		files = append(files, &File{
+			Path:        string(rune('a'+len(files))) + ".txt",
+			Destination: []string{"/x/", "/y/", "/z/"}[len(files)%3] + string(rune('a'+len(files))),
+			Size:        size,
+		})
+	}
+	for _, strategy := range []PackingStrategy{FirstFitPacking, BestFitPacking, DirectoryLocalityPacking} {
+		expected := packedIndexes(t, append([]*File{}, files...), strategy, 10)
+		for n := 0; n < 20; n++ {
+			shuffled := append([]*File{}, files...)
+			rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			require.Equal(t, expected, packedIndexes(t, shuffled, strategy, 10), strategy.String())
+		}
+	}
+}
+
+func TestBySizeDescendingSegments(t *testing.T) {
+	files := []*File{{Path: "/src/small", Destination: "small", Size: 4}}
+	for idx := 1; idx <= 4; idx++ {
+		files = append(files, &File{
+			Path:        "/src/big",
+			Destination: "big",
+			Size:        4,
+			Segment:     &Segment{Index: idx, Count: 4},
+		})
+	}
+	for n := 0; n < 20; n++ {
+		shuffled := append([]*File{}, files...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		bySizeDescending(shuffled)
+		got := []int{}
+		for _, f := range shuffled {
+			got = append(got, segmentIndex(f))
+		}
+		require.Equal(t, []int{1, 2, 3, 4, 0}, got)
+	}
+}
+
+func TestPackingRecordedInInventory(t *testing.T) {
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithPackingStrategy(BestFitPacking),
+	))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, yaml.NewEncoder(&buf).Encode(i))
+	require.Contains(t, buf.String(), "packing_strategy: best-fit")
+	var gotYAML Inventory
+	require.NoError(t, yaml.Unmarshal(buf.Bytes(), &gotYAML))
+	require.Equal(t, BestFitPacking, gotYAML.Options.PackingStrategy)
+
+	b, err := json.Marshal(i)
+	require.NoError(t, err)
+	var gotJSON Inventory
+	require.NoError(t, json.Unmarshal(b, &gotJSON))
+	require.Equal(t, BestFitPacking, gotJSON.Options.PackingStrategy)
+
+	i, err = NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+	))
+	require.NoError(t, err)
+	require.Equal(t, FirstFitPacking, i.Options.PackingStrategy)
+}
+
+func TestPackingStrategySet(t *testing.T) {
+	var p PackingStrategy
+	require.NoError(t, p.Set("directory-locality"))
+	require.Equal(t, DirectoryLocalityPacking, p)
+	require.EqualError(t, p.Set("worst-fit"), "PackingStrategy should be one of: [best-fit directory-locality first-fit]")
+	require.Panics(t, func() { mustPackingStrategy("worst-fit") })
+}
+
+func TestStreamPackingStrategy(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithPackingStrategy(DirectoryLocalityPacking),
+	), &buf)
+	require.EqualError(t, err, "directory-locality packing needs every file up front, and can not be used with streaming inventories")
+
+	buf.Reset()
+	i, err := NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{"../testdata/fake-dir"}),
+		WithPackingStrategy(BestFitPacking),
+	), &buf)
+	require.NoError(t, err)
+	require.Equal(t, BestFitPacking, i.Options.PackingStrategy)
+}
+
+func TestPackingCompletion(t *testing.T) {
+	got, _ := PackingCompletion(&cobra.Command{}, []string{}, "best")
+	require.Len(t, got, 1)
+	require.Contains(t, got[0], "best-fit")
+}
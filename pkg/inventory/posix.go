@@ -0,0 +1,125 @@
+package inventory
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/xattr"
+)
+
+// PosixMetadata is the ownership, timestamp and inode information for a file,
+// used to faithfully restore it later on
+type PosixMetadata struct {
+	Mode       fs.FileMode       `yaml:"mode" json:"mode"`
+	UID        int               `yaml:"uid" json:"uid"`
+	GID        int               `yaml:"gid" json:"gid"`
+	Owner      string            `yaml:"owner,omitempty" json:"owner,omitempty"`
+	Group      string            `yaml:"group,omitempty" json:"group,omitempty"`
+	AccessTime time.Time         `yaml:"access_time,omitempty" json:"access_time,omitempty"`
+	ChangeTime time.Time         `yaml:"change_time,omitempty" json:"change_time,omitempty"`
+	Inode      uint64            `yaml:"inode,omitempty" json:"inode,omitempty"`
+	Device     uint64            `yaml:"device,omitempty" json:"device,omitempty"`
+	Links      uint64            `yaml:"links,omitempty" json:"links,omitempty"`
+	Rdev       uint64            `yaml:"rdev,omitempty" json:"rdev,omitempty"`
+	Xattrs     map[string][]byte `yaml:"xattrs,omitempty" json:"xattrs,omitempty"`
+}
+
+// posixStat is the platform specific bits of a stat call
+type posixStat struct {
+	uid, gid      int
+	atime, ctime  time.Time
+	inode, device uint64
+	nlink, rdev   uint64
+}
+
+// NewPosixMetadata returns the metadata for the file at path, described by st.
+// Extended attributes are only read when includeXattrs is set
+func NewPosixMetadata(path string, st fs.FileInfo, includeXattrs bool) (*PosixMetadata, error) {
+	ret := &PosixMetadata{
+		Mode: st.Mode(),
+	}
+	if ps, ok := statPosix(st); ok {
+		ret.UID = ps.uid
+		ret.GID = ps.gid
+		ret.Owner = lookupOwner(ps.uid)
+		ret.Group = lookupGroup(ps.gid)
+		ret.AccessTime = ps.atime.UTC()
+		ret.ChangeTime = ps.ctime.UTC()
+		ret.Inode = ps.inode
+		ret.Device = ps.device
+		ret.Links = ps.nlink
+		ret.Rdev = ps.rdev
+	}
+	if includeXattrs {
+		var err error
+		if ret.Xattrs, err = readXattrs(path); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// readXattrs returns all extended attributes of path. Filesystems without
+// xattr support just return nothing
+func readXattrs(path string) (map[string][]byte, error) {
+	names, err := xattr.LList(path)
+	if err != nil {
+		if errors.Is(err, xattr.ENOATTR) || errors.Is(err, syscall.ENOTSUP) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ret := make(map[string][]byte, len(names))
+	for _, name := range names {
+		v, err := xattr.LGet(path, name)
+		if err != nil {
+			return nil, err
+		}
+		ret[name] = v
+	}
+	return ret, nil
+}
+
+// Owner and group names are looked up once per id, as the same few show up
+// over and over again in a walk
+var (
+	ownerNames sync.Map
+	groupNames sync.Map
+)
+
+func lookupOwner(uid int) string {
+	if v, ok := ownerNames.Load(uid); ok {
+		return v.(string)
+	}
+	var name string
+	if u, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		name = u.Username
+	} else {
+		slog.Debug("could not look up owner name", "uid", uid)
+	}
+	ownerNames.Store(uid, name)
+	return name
+}
+
+func lookupGroup(gid int) string {
+	if v, ok := groupNames.Load(gid); ok {
+		return v.(string)
+	}
+	var name string
+	if g, err := user.LookupGroupId(strconv.Itoa(gid)); err == nil {
+		name = g.Name
+	} else {
+		slog.Debug("could not look up group name", "gid", gid)
+	}
+	groupNames.Store(gid, name)
+	return name
+}
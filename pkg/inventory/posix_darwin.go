@@ -0,0 +1,24 @@
+package inventory
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func statPosix(st fs.FileInfo) (*posixStat, bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, false
+	}
+	return &posixStat{
+		uid:    int(sys.Uid),
+		gid:    int(sys.Gid),
+		atime:  time.Unix(sys.Atimespec.Unix()),
+		ctime:  time.Unix(sys.Ctimespec.Unix()),
+		inode:  sys.Ino,
+		device: uint64(sys.Dev),   // nolint:gosec
+		nlink:  uint64(sys.Nlink), // nolint:gosec
+		rdev:   uint64(sys.Rdev),  // nolint:gosec
+	}, true
+}
@@ -0,0 +1,24 @@
+package inventory
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+)
+
+func statPosix(st fs.FileInfo) (*posixStat, bool) {
+	sys, ok := st.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil, false
+	}
+	return &posixStat{
+		uid:    int(sys.Uid),
+		gid:    int(sys.Gid),
+		atime:  time.Unix(sys.Atim.Unix()),
+		ctime:  time.Unix(sys.Ctim.Unix()),
+		inode:  sys.Ino,
+		device: uint64(sys.Dev),   // nolint:unconvert
+		nlink:  uint64(sys.Nlink), // nolint:unconvert
+		rdev:   uint64(sys.Rdev),  // nolint:unconvert
+	}, true
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package inventory
+
+import "io/fs"
+
+// statPosix has nothing beyond the mode and modification time to offer on
+// this platform
+func statPosix(_ fs.FileInfo) (*posixStat, bool) {
+	return nil, false
+}
@@ -0,0 +1,42 @@
+package inventory
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/xattr"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPosixMetadata(t *testing.T) {
+	st, err := os.Stat("../testdata/name.txt")
+	require.NoError(t, err)
+	got, err := NewPosixMetadata("../testdata/name.txt", st, false)
+	require.NoError(t, err)
+	require.Equal(t, st.Mode(), got.Mode)
+	require.Equal(t, os.Getuid(), got.UID)
+	require.NotEmpty(t, got.Owner)
+	require.NotZero(t, got.Inode)
+	require.False(t, got.AccessTime.IsZero())
+	require.Nil(t, got.Xattrs)
+}
+
+func TestInventoryWithXattrs(t *testing.T) {
+	dir := t.TempDir()
+	fn := filepath.Join(dir, "data.txt")
+	require.NoError(t, os.WriteFile(fn, []byte("hello"), 0o600))
+	if err := xattr.Set(fn, "user.project", []byte("cargoship")); err != nil {
+		t.Skipf("xattrs not supported here: %v", err)
+	}
+
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{dir}),
+		WithXattrs(),
+	))
+	require.NoError(t, err)
+	require.Len(t, i.Files, 1)
+	require.NotNil(t, i.Files[0].Posix)
+	require.Equal(t, os.FileMode(0o600), i.Files[0].Posix.Mode)
+	require.Equal(t, []byte("cargoship"), i.Files[0].Posix.Xattrs["user.project"])
+}
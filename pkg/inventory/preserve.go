@@ -0,0 +1,178 @@
+package inventory
+
+import (
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// EntryType is the kind of filesystem entry a File stands for. Anything other
+// than regular files is only recorded when Options.Preserve is set
+type EntryType string
+
+const (
+	// RegularEntry is a plain old file, with content
+	RegularEntry EntryType = ""
+	// SymlinkEntry is a symbolic link, pointing at LinkTarget
+	SymlinkEntry EntryType = "symlink"
+	// HardlinkEntry is another name for the file at the LinkTarget destination,
+	// so the content is only stored once
+	HardlinkEntry EntryType = "hardlink"
+	// DirectoryEntry is an empty directory
+	DirectoryEntry EntryType = "directory"
+	// FIFOEntry is a named pipe
+	FIFOEntry EntryType = "fifo"
+	// CharDeviceEntry is a character device
+	CharDeviceEntry EntryType = "char-device"
+	// BlockDeviceEntry is a block device
+	BlockDeviceEntry EntryType = "block-device"
+)
+
+// HasContent returns true if entries of this type have content to store
+func (e EntryType) HasContent() bool {
+	return e == RegularEntry
+}
+
+// isSpecial returns true for FIFOs and devices
+func (e EntryType) isSpecial() bool {
+	return e == FIFOEntry || e == CharDeviceEntry || e == BlockDeviceEntry
+}
+
+// holdsSpecialFiles returns false for the suitcase formats that have nowhere
+// to put FIFOs and devices
+func holdsSpecialFiles(format string) bool {
+	return format != "zip" && format != "aes.zip"
+}
+
+// entryTypeWithMode returns the EntryType for mode, and false for things that
+// can't be preserved at all, like sockets
+func entryTypeWithMode(mode fs.FileMode) (EntryType, bool) {
+	switch {
+	case mode&fs.ModeSymlink != 0:
+		return SymlinkEntry, true
+	case mode.IsDir():
+		return DirectoryEntry, true
+	case mode&fs.ModeNamedPipe != 0:
+		return FIFOEntry, true
+	case mode&fs.ModeCharDevice != 0:
+		return CharDeviceEntry, true
+	case mode&fs.ModeDevice != 0:
+		return BlockDeviceEntry, true
+	case mode&fs.ModeSocket != 0, mode&fs.ModeIrregular != 0:
+		return RegularEntry, false
+	default:
+		return RegularEntry, true
+	}
+}
+
+// newPreservedFile builds up the File for path without following symlinks,
+// keeping links and special files as they are
+func newPreservedFile(dir, path, name string, opts *Options, filters *fileFilters) (*File, error) {
+	st, err := os.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	if filenameMatchesGlobs(name, opts.IgnoreGlobs) {
+		filters.countExcluded("ignore-glob", st.Size())
+		return nil, nil
+	}
+	et, ok := entryTypeWithMode(st.Mode())
+	if ok && et.isSpecial() && !holdsSpecialFiles(opts.SuitcaseFormat) {
+		ok = false
+	}
+	if !ok {
+		slog.Warn("leaving out file that can not be preserved", "file", path, "mode", st.Mode().String())
+		filters.countExcluded("unpreservable", 0)
+		return nil, nil
+	}
+	invf := &File{
+		Path:        path,
+		Destination: strings.TrimPrefix(path, dir),
+		Name:        name,
+		ModTime:     st.ModTime().UTC(),
+		Type:        et,
+	}
+	switch et {
+	case RegularEntry:
+		invf.Size = st.Size()
+	case SymlinkEntry:
+		if invf.LinkTarget, err = os.Readlink(path); err != nil {
+			return nil, err
+		}
+	case DirectoryEntry:
+		invf.Destination += "/"
+	default:
+		slog.Warn("found special file", "file", path, "type", et)
+	}
+	if invf.Posix, err = NewPosixMetadata(path, st, opts.IncludeXattrs); err != nil {
+		return nil, err
+	}
+	if !filters.keep(invf, et == SymlinkEntry) {
+		return nil, nil
+	}
+	if et == RegularEntry && (opts.IncludeArchiveTOCDeep || (opts.IncludeArchiveTOC && isTOCAble(path))) {
+		var aerr error
+		if invf.ArchiveTOC, aerr = ArchiveContents(path, opts.ArchiveTOCDepth); aerr != nil {
+			slog.Debug("error attemping to look at table of contents in file", "file", path)
+		}
+	}
+	return invf, nil
+}
+
+// isEmptyDir returns true if path is a directory with nothing in it
+func isEmptyDir(path string) bool {
+	d, err := os.Open(path) // nolint:gosec
+	if err != nil {
+		return false
+	}
+	defer dclose(d)
+	_, err = d.Readdirnames(1)
+	return err == io.EOF
+}
+
+// preservedEntries tracks hardlinks and counts up the kinds of entries seen
+// while walking in preservation mode
+type preservedEntries struct {
+	inodes map[[2]uint64]string
+	counts map[EntryType]int
+}
+
+func newPreservedEntries() *preservedEntries {
+	return &preservedEntries{
+		inodes: map[[2]uint64]string{},
+		counts: map[EntryType]int{},
+	}
+}
+
+// wrap returns fn, turning any file already seen under another name in to a
+// hardlink to that first name. Files must come through in a deterministic
+// order, so the same name always ends up holding the content
+func (p *preservedEntries) wrap(fn func(*File) error) func(*File) error {
+	return func(f *File) error {
+		if f.Type == RegularEntry && f.Posix != nil && f.Posix.Links > 1 {
+			key := [2]uint64{f.Posix.Device, f.Posix.Inode}
+			if first, ok := p.inodes[key]; ok {
+				f.Type = HardlinkEntry
+				f.LinkTarget = first
+				f.Size = 0
+				f.ArchiveTOC = nil
+			} else {
+				p.inodes[key] = f.Destination
+			}
+		}
+		if f.Type != RegularEntry {
+			p.counts[f.Type]++
+		}
+		return fn(f)
+	}
+}
+
+// entryCounts returns the number of each non-regular entry type found
+func (p *preservedEntries) entryCounts() map[EntryType]int {
+	if len(p.counts) == 0 {
+		return nil
+	}
+	return p.counts
+}
@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"os"
+	"path"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func writePreserveTree(t *testing.T) string {
+	top := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(top, "empty"), 0o755))
+	require.NoError(t, os.MkdirAll(path.Join(top, "sub"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(top, "sub/data.txt"), []byte("some data"), 0o644))
+	require.NoError(t, os.Link(path.Join(top, "sub/data.txt"), path.Join(top, "other.txt")))
+	require.NoError(t, os.Symlink("sub/data.txt", path.Join(top, "link.txt")))
+	require.NoError(t, os.Symlink("sub", path.Join(top, "linkdir")))
+	require.NoError(t, os.Symlink("nowhere", path.Join(top, "dangling")))
+	require.NoError(t, syscall.Mkfifo(path.Join(top, "pipe"), 0o600))
+	return top
+}
+
+func TestPreserve(t *testing.T) {
+	top := writePreserveTree(t)
+	for _, workers := range []int{0, 4} {
+		i, err := NewDirectoryInventory(NewOptions(
+			WithDirectories([]string{top}),
+			WithWalkConcurrency(workers),
+			WithHashFiles(),
+			WithPreserve(),
+		))
+		require.NoError(t, err)
+		got := map[string]*File{}
+		for _, f := range i.Files {
+			got[f.Destination] = f
+		}
+		require.Equal(t, 7, len(got), "workers: %v", workers)
+
+		require.Equal(t, DirectoryEntry, got["empty/"].Type)
+		require.Equal(t, SymlinkEntry, got["link.txt"].Type)
+		require.Equal(t, "sub/data.txt", got["link.txt"].LinkTarget)
+		require.Equal(t, SymlinkEntry, got["linkdir"].Type)
+		require.Equal(t, "sub", got["linkdir"].LinkTarget)
+		require.Equal(t, SymlinkEntry, got["dangling"].Type)
+		require.Equal(t, FIFOEntry, got["pipe"].Type)
+		require.Empty(t, got["pipe"].Hash)
+
+		// Only one of the hardlinked names holds the content
+		data, other := got["sub/data.txt"], got["other.txt"]
+		if data.Type == HardlinkEntry {
+			data, other = other, data
+		}
+		require.Equal(t, RegularEntry, data.Type)
+		require.Equal(t, int64(9), data.Size)
+		require.NotEmpty(t, data.Hash)
+		require.Equal(t, HardlinkEntry, other.Type)
+		require.Equal(t, data.Destination, other.LinkTarget)
+		require.Equal(t, int64(0), other.Size)
+
+		require.Equal(t, map[EntryType]int{
+			DirectoryEntry: 1,
+			SymlinkEntry:   3,
+			HardlinkEntry:  1,
+			FIFOEntry:      1,
+		}, i.EntryCounts)
+	}
+}
+
+func TestPreserveZip(t *testing.T) {
+	top := writePreserveTree(t)
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{top}),
+		WithPreserve(),
+		WithSuitcaseFormat("zip"),
+	))
+	require.NoError(t, err)
+	for _, f := range i.Files {
+		require.NotEqual(t, "pipe", f.Destination)
+	}
+	require.Equal(t, 6, len(i.Files))
+	require.NotContains(t, i.EntryCounts, FIFOEntry)
+	require.Equal(t, 1, i.Excluded["unpreservable"].Count)
+}
+
+func TestPreserveOff(t *testing.T) {
+	top := writePreserveTree(t)
+	require.NoError(t, os.Remove(path.Join(top, "pipe")))
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{top}),
+		WithFollowSymlinks(),
+	))
+	require.NoError(t, err)
+	got := map[string]*File{}
+	for _, f := range i.Files {
+		got[f.Destination] = f
+		require.Equal(t, RegularEntry, f.Type)
+	}
+	// Symlinks are followed, empty directories and dangling links dropped
+	require.Equal(t, 4, len(got))
+	require.Contains(t, got, "linkdir/data.txt")
+	require.Equal(t, path.Join(top, "sub/data.txt"), got["link.txt"].Path)
+	require.Nil(t, i.EntryCounts)
+}
+
+func TestEntryTypeWithMode(t *testing.T) {
+	for mode, expect := range map[os.FileMode]EntryType{
+		0o644:                             RegularEntry,
+		os.ModeDir | 0o755:                DirectoryEntry,
+		os.ModeSymlink | 0o777:            SymlinkEntry,
+		os.ModeNamedPipe:                  FIFOEntry,
+		os.ModeDevice | os.ModeCharDevice: CharDeviceEntry,
+		os.ModeDevice:                     BlockDeviceEntry,
+	} {
+		got, ok := entryTypeWithMode(mode)
+		require.True(t, ok, mode.String())
+		require.Equal(t, expect, got, mode.String())
+	}
+	_, ok := entryTypeWithMode(os.ModeSocket)
+	require.False(t, ok)
+}
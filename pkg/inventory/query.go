@@ -0,0 +1,359 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/dustin/go-humanize"
+)
+
+// Query is a parsed search query, made up of terms that must all match a file.
+// Terms look like key:value, or key followed by one of >, >=, <, <= or = for
+// keys that can be compared:
+//
+//	ext:.h5          file extension, with or without the dot
+//	name:run-*.h5    file name, exact or a glob
+//	path:~/raw/      source path or destination, containing the value, or a glob
+//	size>1G          file size, using human units like 500MiB or 1G
+//	mtime<2022-01-01 modification time, as YYYY-MM-DD for a whole day, or RFC3339
+//	suitcase:3       suitcase index, or the suitcase name containing the value
+//	hash:abc123      file hash
+//	type:symlink     entry type (file, directory, symlink, hardlink...)
+//
+// Anything else is a plain word, matched against the file name and archive
+// table of contents. Values with spaces can be quoted, as in path:"my data/"
+type Query struct {
+	text  string
+	terms []queryTerm
+	words []string
+}
+
+// queryTerm returns true if a file matches a single term of a query
+type queryTerm func(di *Inventory, f *File) bool
+
+var queryTermRE = regexp.MustCompile(`^([a-z]+)(:|>=|<=|>|<|=)(.*)$`)
+
+// ParseQuery parses a query string like "ext:.h5 size>1G mtime<2022-01-01"
+func ParseQuery(s string) (*Query, error) {
+	words, err := queryWords(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return nil, errors.New("query is empty")
+	}
+	q := &Query{text: s}
+	for _, w := range words {
+		if !queryTermRE.MatchString(w) {
+			q.words = append(q.words, w)
+			continue
+		}
+		t, err := parseQueryTerm(w)
+		if err != nil {
+			return nil, err
+		}
+		q.terms = append(q.terms, t)
+	}
+	return q, nil
+}
+
+// String returns the query as it was given
+func (q Query) String() string {
+	return q.text
+}
+
+// Matches returns true if every term and plain word in the query matches the
+// file
+func (q Query) Matches(di *Inventory, f *File) bool {
+	if !q.matchesTerms(di, f) {
+		return false
+	}
+	for _, w := range q.words {
+		if !fileMatchesText(f, strings.ToLower(w)) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesTerms returns true if every key:value term in the query matches the
+// file, leaving out the plain words
+func (q Query) matchesTerms(di *Inventory, f *File) bool {
+	for _, t := range q.terms {
+		if !t(di, f) {
+			return false
+		}
+	}
+	return true
+}
+
+// queryWords splits a query on spaces, keeping quoted values together
+func queryWords(s string) ([]string, error) {
+	var words []string
+	var cur strings.Builder
+	var quoted, inWord bool
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inWord = true
+		case unicode.IsSpace(r) && !quoted:
+			if inWord {
+				words = append(words, cur.String())
+				cur.Reset()
+				inWord = false
+			}
+		default:
+			cur.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("query has an unterminated quote")
+	}
+	if inWord {
+		words = append(words, cur.String())
+	}
+	return words, nil
+}
+
+func parseQueryTerm(w string) (queryTerm, error) {
+	m := queryTermRE.FindStringSubmatch(w)
+	if m == nil {
+		return nil, fmt.Errorf("invalid query term %v", w)
+	}
+	key, op, value := m[1], m[2], m[3]
+	if value == "" {
+		return nil, fmt.Errorf("query term %v is missing a value", w)
+	}
+	var t queryTerm
+	switch key {
+	case "size":
+		size, err := humanize.ParseBytes(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid size in %v: %w", w, err)
+		}
+		n := uint64ToInt64(size)
+		t = func(_ *Inventory, f *File) bool {
+			return compareQuery(op, f.Size, n)
+		}
+		return t, nil
+	case "mtime":
+		when, isDate, err := parseQueryTime(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time in %v: %w", w, err)
+		}
+		t = func(_ *Inventory, f *File) bool {
+			if f.ModTime.IsZero() {
+				return false
+			}
+			// A plain date covers the whole day, so comparisons with it
+			// use the start or the end of the day as fits
+			if isDate {
+				end := when.AddDate(0, 0, 1)
+				switch op {
+				case ":", "=":
+					return !f.ModTime.Before(when) && f.ModTime.Before(end)
+				case ">":
+					return !f.ModTime.Before(end)
+				case "<=":
+					return f.ModTime.Before(end)
+				}
+			}
+			return compareQuery(op, f.ModTime.UnixNano(), when.UnixNano())
+		}
+		return t, nil
+	}
+
+	if op != ":" && op != "=" {
+		return nil, fmt.Errorf("%v can only be matched with ':', not '%v'", key, op)
+	}
+	switch key {
+	case "ext":
+		ext := strings.ToLower(value)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		t = func(_ *Inventory, f *File) bool {
+			return strings.HasSuffix(strings.ToLower(f.Name), ext)
+		}
+	case "name":
+		name := strings.ToLower(value)
+		t = func(_ *Inventory, f *File) bool {
+			ok, _ := filepath.Match(name, strings.ToLower(f.Name))
+			return ok
+		}
+	case "path":
+		p := expandHome(value)
+		t = func(_ *Inventory, f *File) bool {
+			return queryPathMatches(p, f.Path) || queryPathMatches(p, f.Destination)
+		}
+	case "suitcase":
+		idx, err := strconv.Atoi(value)
+		name := strings.ToLower(value)
+		t = func(di *Inventory, f *File) bool {
+			if err == nil {
+				return f.SuitcaseIndex == idx
+			}
+			return strings.Contains(strings.ToLower(di.SuitcaseNameForFile(f)), name)
+		}
+	case "hash":
+		t = func(_ *Inventory, f *File) bool {
+			return strings.EqualFold(f.Hash, value)
+		}
+	case "type":
+		et := EntryType(strings.ToLower(value))
+		if et == "file" {
+			et = RegularEntry
+		}
+		t = func(_ *Inventory, f *File) bool {
+			return f.Type == et
+		}
+	default:
+		return nil, fmt.Errorf("unknown query key: %v", key)
+	}
+	return t, nil
+}
+
+func compareQuery(op string, got, want int64) bool {
+	switch op {
+	case ">":
+		return got > want
+	case ">=":
+		return got >= want
+	case "<":
+		return got < want
+	case "<=":
+		return got <= want
+	default:
+		return got == want
+	}
+}
+
+// parseQueryTime parses either a plain date or a full RFC3339 timestamp,
+// noting which one it was
+func parseQueryTime(s string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	return t, false, err
+}
+
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return home + strings.TrimPrefix(p, "~")
+}
+
+func queryPathMatches(pattern, s string) bool {
+	if !strings.ContainsAny(pattern, `*?[\`) {
+		return strings.Contains(s, pattern)
+	}
+	ok, _ := filepath.Match(pattern, s)
+	return ok
+}
+
+// fileMatchesText is the plain substring match used by Search, against the
+// file name and anything in its archive table of contents. p should already
+// be lower case
+func fileMatchesText(f *File, p string) bool {
+	if strings.Contains(strings.ToLower(filepath.Base(f.Destination)), p) {
+		return true
+	}
+	for _, toc := range f.ArchiveTOC {
+		if toc.matches(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// QueryMatch is a file matching a Query, along with where it can be found
+type QueryMatch struct {
+	Inventory string `json:"inventory,omitempty"`
+	Suitcase  string `json:"suitcase"`
+	File      *File  `json:"file"`
+}
+
+// QueryMatches are all the files matching a Query
+type QueryMatches []QueryMatch
+
+// Find returns every file in the inventory matching the query
+func (di Inventory) Find(q *Query) (QueryMatches, error) {
+	ret := QueryMatches{}
+	err := di.EachOfAllFiles(func(f *File) error {
+		if q.Matches(&di, f) {
+			ret = append(ret, QueryMatch{Suitcase: di.SuitcaseNameForFile(f), File: f})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// Find returns every file matching the query across all the inventories in
+// the collection, ordered by inventory
+func (c Collection) Find(q *Query) (QueryMatches, error) {
+	fns := make([]string, 0, len(c))
+	for fn := range c {
+		fns = append(fns, fn)
+	}
+	sort.Strings(fns)
+	ret := QueryMatches{}
+	for _, fn := range fns {
+		got, err := c[fn].Find(q)
+		if err != nil {
+			return nil, fmt.Errorf("could not search %v: %w", fn, err)
+		}
+		for _, m := range got {
+			m.Inventory = fn
+			ret = append(ret, m)
+		}
+	}
+	return ret, nil
+}
+
+// WriteCSV writes the matches out as CSV, with a header row
+func (m QueryMatches) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"inventory", "suitcase", "destination", "path", "size", "mod_time", "hash"}); err != nil {
+		return err
+	}
+	for _, item := range m {
+		var mtime string
+		if !item.File.ModTime.IsZero() {
+			mtime = item.File.ModTime.Format(time.RFC3339)
+		}
+		if err := cw.Write([]string{
+			item.Inventory,
+			item.Suitcase,
+			item.File.Destination,
+			item.File.Path,
+			strconv.FormatInt(item.File.Size, 10),
+			mtime,
+			item.File.Hash,
+		}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,113 @@
+package inventory
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func queryTestInventory() Inventory {
+	home, _ := os.UserHomeDir()
+	return Inventory{
+		Options:      &Options{Prefix: "demo", User: "joe", SuitcaseFormat: "tar.zst"},
+		TotalIndexes: 3,
+		Files: []*File{
+			{
+				Path: home + "/raw/run1.h5", Destination: "raw/run1.h5", Name: "run1.h5",
+				Size: 2_000_000_000, ModTime: time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC), SuitcaseIndex: 3, Hash: "aaa",
+			},
+			{
+				Path: home + "/raw/run2.H5", Destination: "raw/run2.H5", Name: "run2.H5",
+				Size: 500, ModTime: time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), SuitcaseIndex: 3,
+			},
+			{
+				Path: "/data/notes/my notes.txt", Destination: "notes/my notes.txt", Name: "my notes.txt",
+				Size: 10, ModTime: time.Date(2021, 12, 31, 23, 0, 0, 0, time.UTC), SuitcaseIndex: 1,
+			},
+			{
+				Path: "/data/bundle.tar", Destination: "bundle.tar", Name: "bundle.tar",
+				Size: 4096, SuitcaseIndex: 2, ArchiveTOC: []ArchiveEntry{{Name: "inner/calibration.dat"}},
+			},
+			{
+				Path: "/data/latest", Destination: "latest", Name: "latest",
+				Type: SymlinkEntry, LinkTarget: "raw/run2.H5", SuitcaseIndex: 1,
+			},
+		},
+	}
+}
+
+func TestInventoryFind(t *testing.T) {
+	inv := queryTestInventory()
+	tests := map[string][]string{
+		"ext:.h5 size>1G suitcase:3 path:~/raw/ mtime<2022-01-01": {"raw/run1.h5"},
+		"ext:h5":                      {"raw/run1.h5", "raw/run2.H5"},
+		"size<=500":                   {"raw/run2.H5", "notes/my notes.txt", "latest"},
+		"size=10":                     {"notes/my notes.txt"},
+		"mtime:2021-12-31":            {"notes/my notes.txt"},
+		"mtime>2021-12-31":            {"raw/run2.H5"},
+		"mtime>=2021-12-31":           {"raw/run2.H5", "notes/my notes.txt"},
+		"mtime<2021-12-31":            {"raw/run1.h5"},
+		"mtime<=2021-12-31":           {"raw/run1.h5", "notes/my notes.txt"},
+		"mtime>=2021-12-31T00:00:00Z": {"raw/run2.H5", "notes/my notes.txt"},
+		"name:run?.h5":                {"raw/run1.h5", "raw/run2.H5"},
+		`path:"notes/my notes"`:       {"notes/my notes.txt"},
+		"path:/data/*":                {"bundle.tar", "latest"},
+		"suitcase:02-of-03":           {"bundle.tar"},
+		"hash:AAA":                    {"raw/run1.h5"},
+		"type:symlink":                {"latest"},
+		"type:file suitcase:1":        {"notes/my notes.txt"},
+		"calibration":                 {"bundle.tar"},
+		"run2 ext:.h5":                {"raw/run2.H5"},
+		"nothing-matches":             {},
+	}
+	for query, expect := range tests {
+		q, err := ParseQuery(query)
+		require.NoError(t, err, query)
+		got, err := inv.Find(q)
+		require.NoError(t, err, query)
+		dests := []string{}
+		for _, m := range got {
+			dests = append(dests, m.File.Destination)
+		}
+		require.Equal(t, expect, dests, query)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for query, expect := range map[string]string{
+		"":                   "query is empty",
+		"size>lots":          "invalid size in size>lots",
+		"mtime<yesterday":    "invalid time in mtime<yesterday",
+		"ext>.h5":            "ext can only be matched with ':', not '>'",
+		"colour:blue":        "unknown query key: colour",
+		"path:":              "query term path: is missing a value",
+		`path:"unterminated`: "query has an unterminated quote",
+	} {
+		_, err := ParseQuery(query)
+		require.ErrorContains(t, err, expect, query)
+	}
+}
+
+func TestCollectionFind(t *testing.T) {
+	c := Collection{
+		"b/inventory.yaml": queryTestInventory(),
+		"a/inventory.yaml": queryTestInventory(),
+	}
+	q, err := ParseQuery("name:run1.h5")
+	require.NoError(t, err)
+	got, err := c.Find(q)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got))
+	require.Equal(t, "a/inventory.yaml", got[0].Inventory)
+	require.Equal(t, "b/inventory.yaml", got[1].Inventory)
+	require.Equal(t, "demo-joe-03-of-03.tar.zst", got[0].Suitcase)
+
+	var buf bytes.Buffer
+	require.NoError(t, got[:1].WriteCSV(&buf))
+	require.Equal(t, "inventory,suitcase,destination,path,size,mod_time,hash\n"+
+		"a/inventory.yaml,demo-joe-03-of-03.tar.zst,raw/run1.h5,"+got[0].File.Path+",2000000000,2021-06-01T12:00:00Z,aaa\n",
+		buf.String())
+}
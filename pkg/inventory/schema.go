@@ -0,0 +1,277 @@
+package inventory
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dustin/go-humanize"
+	"github.com/invopop/jsonschema"
+)
+
+const (
+	// SchemaVersion is the version of the inventory format written out by this
+	// version of cargoship, described by pkg/static/schemas/<SchemaVersion>.json.
+	// Bump it, add a migration from the previous version and check in the new
+	// JSONSchema whenever a change to the format would trip up older readers or
+	// needs older inventories fixed up
+	SchemaVersion = "2026-10-16"
+	// LegacySchemaVersion is the version of inventories written before a
+	// version was recorded, described by pkg/static/schemas/2023-01-24.json
+	LegacySchemaVersion = "2023-01-24"
+)
+
+// migration upgrades an inventory from one schema version to the next. The
+// file function, if set, is run on every file, including those read back by
+// EachFile for streaming inventories
+type migration struct {
+	from      string
+	to        string
+	inventory func(*Inventory) error
+	file      func(*Inventory, *File)
+}
+
+// migrations are applied in order, starting with the one matching the version
+// of the inventory being read
+var migrations = []migration{
+	// Archive table of contents entries went from plain names to objects
+	// with sizes and nested contents along the way, but ArchiveEntry still
+	// reads plain names, so the files need no fixing up for that
+	{
+		from:      LegacySchemaVersion,
+		to:        SchemaVersion,
+		inventory: migrateLegacyInventory,
+		file:      migrateLegacyFile,
+	},
+}
+
+// JSONSchema describes the inventory format at SchemaVersion
+func JSONSchema() *jsonschema.Schema {
+	return new(jsonschema.Reflector).Reflect(&Inventory{})
+}
+
+// stringEnum returns the keys of m as the values a JSON schema enum allows
+func stringEnum[V any](m map[string]V) []any {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make([]any, len(keys))
+	for idx, k := range keys {
+		ret[idx] = k
+	}
+	return ret
+}
+
+// migrateLegacyInventory fills in the bits that older inventories could be
+// missing, but that everything now expects to be there
+func migrateLegacyInventory(di *Inventory) error {
+	if di.Options == nil {
+		di.Options = &Options{}
+	}
+	for _, s := range di.IndexSummaries {
+		if s != nil && s.HumanSize == "" {
+			s.HumanSize = humanize.Bytes(int64ToUint64(s.Size))
+		}
+	}
+	return nil
+}
+
+// migrateLegacyFile fills in the suitcase name for older files that only
+// recorded the index
+func migrateLegacyFile(di *Inventory, f *File) {
+	if f.SuitcaseName == "" && di.TotalIndexes > 0 {
+		f.SuitcaseName = di.SuitcaseNameWithIndex(f.SuitcaseIndex)
+	}
+}
+
+// migrate upgrades the inventory in memory to the current SchemaVersion
+func (di *Inventory) migrate() error {
+	if di.SchemaVersion == "" {
+		di.SchemaVersion = LegacySchemaVersion
+	}
+	di.migratedFrom = di.SchemaVersion
+	for di.SchemaVersion != SchemaVersion {
+		m, ok := migrationFrom(di.SchemaVersion)
+		if !ok {
+			if di.SchemaVersion > SchemaVersion {
+				return fmt.Errorf("inventory schema version %v is newer than this version of cargoship supports (%v)", di.SchemaVersion, SchemaVersion)
+			}
+			return fmt.Errorf("unknown inventory schema version: %v", di.SchemaVersion)
+		}
+		if m.inventory != nil {
+			if err := m.inventory(di); err != nil {
+				return fmt.Errorf("could not migrate inventory from schema version %v to %v: %w", m.from, m.to, err)
+			}
+		}
+		if m.file != nil {
+			for _, f := range di.Files {
+				m.file(di, f)
+			}
+			// Streaming inventories read their files back later on
+			di.fileMigrations = append(di.fileMigrations, m.file)
+		}
+		di.SchemaVersion = m.to
+	}
+	return nil
+}
+
+func migrationFrom(v string) (migration, bool) {
+	for _, m := range migrations {
+		if m.from == v {
+			return m, true
+		}
+	}
+	return migration{}, false
+}
+
+// Validate checks that the inventory is at the current schema version and is
+// internally consistent, returning every problem found
+func (di Inventory) Validate() error {
+	var problems []string
+	if di.SchemaVersion != SchemaVersion {
+		problems = append(problems, fmt.Sprintf("schema version is %q instead of %v", di.SchemaVersion, SchemaVersion))
+	}
+	if di.Options == nil {
+		problems = append(problems, "options are missing")
+	}
+	summaries := map[int]*IndexSummary{}
+	if err := di.EachFile(func(f *File) error {
+		name := f.Destination
+		if name == "" {
+			name = f.Path
+		}
+		if f.Destination == "" {
+			problems = append(problems, fmt.Sprintf("%v: destination is missing", name))
+		}
+		if f.Size < 0 {
+			problems = append(problems, fmt.Sprintf("%v: size is negative", name))
+		}
+		if (f.Type == SymlinkEntry || f.Type == HardlinkEntry) && f.LinkTarget == "" {
+			problems = append(problems, fmt.Sprintf("%v: %v is missing a link target", name, f.Type))
+		}
+		if f.SuitcaseIndex < 0 || f.SuitcaseIndex > di.TotalIndexes {
+			problems = append(problems, fmt.Sprintf("%v: suitcase index %v is out of range", name, f.SuitcaseIndex))
+		}
+		if _, ok := summaries[f.SuitcaseIndex]; !ok {
+			summaries[f.SuitcaseIndex] = &IndexSummary{}
+		}
+		summaries[f.SuitcaseIndex].Count++
+		summaries[f.SuitcaseIndex].Size += f.StoredSize()
+		return nil
+	}); err != nil {
+		return err
+	}
+	if di.IndexSummaries != nil {
+		for idx, got := range summaries {
+			s, ok := di.IndexSummaries[idx]
+			switch {
+			case !ok || s == nil:
+				problems = append(problems, fmt.Sprintf("suitcase %v is missing from the index summaries", idx))
+			case s.Count != got.Count || s.Size != got.Size:
+				problems = append(problems, fmt.Sprintf("suitcase %v summary has %v files and %v bytes, but the files add up to %v and %v", idx, s.Count, s.Size, got.Count, got.Size))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid inventory: %v", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// RewriteInventory reads the inventory at src, migrates it to the current
+// schema version and writes it out to dst, in the format matching the dst
+// extension. The migrated inventory is validated, and the new file is read
+// back and compared before it is put in place. When dst is the same as src,
+// the original is kept alongside with a .bak extension. The schema version src
+// was migrated from is returned
+func RewriteInventory(src, dst string) (string, error) {
+	inv, err := NewInventoryWithFilename(src)
+	if err != nil {
+		return "", err
+	}
+	if err := inv.Validate(); err != nil {
+		return "", err
+	}
+	ir, err := NewInventoryerWithFilename(dst)
+	if err != nil {
+		return "", err
+	}
+
+	ext := filepath.Ext(dst)
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+strings.TrimSuffix(filepath.Base(dst), ext)+"-*"+ext)
+	if err != nil {
+		return "", err
+	}
+	defer func() {
+		// Only left around if something went wrong
+		_ = os.Remove(tmp.Name())
+	}()
+	if err := ir.Write(tmp, inv); err != nil {
+		dclose(tmp)
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := compareRewritten(inv, tmp.Name()); err != nil {
+		return "", err
+	}
+
+	if same, err := sameFile(src, dst); err != nil {
+		return "", err
+	} else if same {
+		if err := os.Rename(src, src+".bak"); err != nil {
+			return "", err
+		}
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return "", err
+	}
+	return inv.migratedFrom, nil
+}
+
+// compareRewritten makes sure the inventory in fn reads back the same as inv
+func compareRewritten(inv *Inventory, fn string) error {
+	got, err := NewInventoryWithFilename(fn)
+	if err != nil {
+		return fmt.Errorf("could not read back rewritten inventory: %w", err)
+	}
+	if err := got.Validate(); err != nil {
+		return fmt.Errorf("rewritten inventory is not valid: %w", err)
+	}
+	// Depending on the format, suitcase names may or may not be filled in
+	inv.expandSuitcaseNames()
+	got.expandSuitcaseNames()
+	expected, err := inv.JSONString()
+	if err != nil {
+		return err
+	}
+	actual, err := got.JSONString()
+	if err != nil {
+		return err
+	}
+	if expected != actual {
+		return errors.New("rewritten inventory does not match the original")
+	}
+	return nil
+}
+
+func sameFile(a, b string) (bool, error) {
+	ast, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bst, err := os.Stat(b)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ast, bst), nil
+}
@@ -0,0 +1,178 @@
+package inventory
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const legacyInventory = `files:
+    - path: /data/raw/run1.h5
+      destination: raw/run1.h5
+      name: run1.h5
+      size: 2000
+      suitcase_index: 1
+    - path: /data/notes.txt
+      destination: notes.txt
+      name: notes.txt
+      size: 10
+      suitcase_index: 1
+      suitcase_name: demo-joe-01-of-01.tar.zst
+options:
+    user: joe
+    prefix: demo
+    top_level_directories:
+        - /data/
+    size_considered_large: 0
+    max_suitcase_size: 536870912000
+    encrypt_inner: false
+    hash_inner: false
+    limit_file_count: 0
+    suitcase_format: tar.zst
+    inventory_format: yaml
+    follow_symlinks: false
+total_indexes: 1
+index_summaries:
+    1:
+        count: 2
+        size: 2010
+internal_metadata: {}
+external_metadata: {}
+cli_meta:
+    date: 2023-09-26T13:31:36.327445-04:00
+    version: dev
+`
+
+func writeLegacyInventory(t *testing.T, name string) string {
+	fn := path.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(fn, []byte(legacyInventory), 0o600))
+	return fn
+}
+
+// unquoted strips out the quotes and spaces, so YAML and JSON look the same
+func unquoted(b []byte) string {
+	return strings.NewReplacer(`"`, "", " ", "").Replace(string(b))
+}
+
+func TestMigrateLegacy(t *testing.T) {
+	got, err := NewInventoryWithFilename(writeLegacyInventory(t, "inventory.yaml"))
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, got.SchemaVersion)
+	require.Equal(t, LegacySchemaVersion, got.migratedFrom)
+	require.Equal(t, "demo-joe-01-of-01.tar.zst", got.Files[0].SuitcaseName)
+	require.Equal(t, "2.0 kB", got.IndexSummaries[1].HumanSize)
+	require.NoError(t, got.Validate())
+}
+
+func TestMigrateStreaming(t *testing.T) {
+	legacy, err := NewInventoryWithFilename(writeLegacyInventory(t, "inventory.yaml"))
+	require.NoError(t, err)
+	// Write it back out as a streaming inventory from before versions were recorded
+	legacy.SchemaVersion = ""
+	for _, f := range legacy.Files {
+		f.SuitcaseName = ""
+	}
+	fn := path.Join(t.TempDir(), "inventory.ndjson")
+	out, err := os.Create(fn)
+	require.NoError(t, err)
+	require.NoError(t, (&NDJSONer{}).Write(out, legacy))
+	require.NoError(t, out.Close())
+
+	got, err := NewStreamingInventoryWithFilename(fn)
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, got.SchemaVersion)
+	require.NoError(t, got.EachFile(func(f *File) error {
+		require.Equal(t, "demo-joe-01-of-01.tar.zst", f.SuitcaseName)
+		return nil
+	}))
+}
+
+func TestMigrateUnknown(t *testing.T) {
+	for version, expect := range map[string]string{
+		"2999-01-01": "inventory schema version 2999-01-01 is newer than this version of cargoship supports (" + SchemaVersion + ")",
+		"2020-01-01": "unknown inventory schema version: 2020-01-01",
+	} {
+		fn := path.Join(t.TempDir(), "inventory.yaml")
+		require.NoError(t, os.WriteFile(fn, []byte("schema_version: "+version+"\n"+legacyInventory), 0o600))
+		_, err := NewInventoryWithFilename(fn)
+		require.EqualError(t, err, expect)
+	}
+}
+
+func TestSchemaVersionWritten(t *testing.T) {
+	for _, format := range []string{"yaml", "json", "ndjson"} {
+		fn := path.Join(t.TempDir(), "inventory."+format)
+		out, err := os.Create(fn)
+		require.NoError(t, err)
+		ir, err := NewInventoryerWithFilename(fn)
+		require.NoError(t, err)
+		i, err := NewDirectoryInventory(NewOptions(WithDirectories([]string{"../testdata/fake-dir"})))
+		require.NoError(t, err)
+		require.NoError(t, ir.Write(out, i))
+		require.NoError(t, out.Close())
+
+		b, err := os.ReadFile(fn)
+		require.NoError(t, err)
+		require.Contains(t, unquoted(b), "schema_version:"+SchemaVersion, format)
+	}
+}
+
+func TestSchemaFile(t *testing.T) {
+	// The checked in schema for the current version must match the code
+	b, err := os.ReadFile(path.Join("../static/schemas", SchemaVersion+".json"))
+	require.NoError(t, err)
+	expected, err := json.MarshalIndent(JSONSchema(), "", "  ")
+	require.NoError(t, err)
+	require.JSONEq(t, string(expected), string(b))
+}
+
+func TestValidate(t *testing.T) {
+	got, err := NewInventoryWithFilename("../testdata/inventories/example-inventory.yaml")
+	require.NoError(t, err)
+	require.EqualError(t, got.Validate(), "invalid inventory: suitcase 1 summary has 15 files and 10187619 bytes, but the files add up to 1 and 3154432")
+
+	i := Inventory{
+		TotalIndexes: 1,
+		Files: []*File{
+			{Name: "a", Size: 1, SuitcaseIndex: 1},
+			{Name: "b", Destination: "b", Type: SymlinkEntry, SuitcaseIndex: 2},
+		},
+	}
+	require.EqualError(t, i.Validate(), `invalid inventory: schema version is "" instead of `+SchemaVersion+`; options are missing; : destination is missing; b: symlink is missing a link target; b: suitcase index 2 is out of range`)
+}
+
+func TestRewriteInventory(t *testing.T) {
+	src := writeLegacyInventory(t, "inventory.yaml")
+
+	// Rewrite in place, keeping the original
+	from, err := RewriteInventory(src, src)
+	require.NoError(t, err)
+	require.Equal(t, LegacySchemaVersion, from)
+	bak, err := os.ReadFile(src + ".bak")
+	require.NoError(t, err)
+	require.Equal(t, legacyInventory, string(bak))
+	b, err := os.ReadFile(src)
+	require.NoError(t, err)
+	require.Contains(t, unquoted(b), "schema_version:"+SchemaVersion)
+	require.NotContains(t, string(b), "cli_meta")
+
+	// Already current, and in to a different format
+	dst := path.Join(t.TempDir(), "inventory.json")
+	from, err = RewriteInventory(src, dst)
+	require.NoError(t, err)
+	require.Equal(t, SchemaVersion, from)
+	got, err := NewInventoryWithFilename(dst)
+	require.NoError(t, err)
+	require.Equal(t, 2, len(got.Files))
+	entries, err := os.ReadDir(path.Dir(dst))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(entries), "temporary files should be cleaned up")
+
+	// Invalid inventories are left alone
+	_, err = RewriteInventory("../testdata/inventories/example-inventory.yaml", path.Join(t.TempDir(), "bad.yaml"))
+	require.ErrorContains(t, err, "invalid inventory")
+}
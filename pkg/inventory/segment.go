@@ -0,0 +1,103 @@
+package inventory
+
+import (
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+)
+
+// Segment describes one piece of a file too large to fit in a single
+// suitcase. Each segment is its own entry in the inventory Files, sharing the
+// Path and Destination of the whole file, with Size set to the length of the
+// segment. The Hash of the File is still the hash of the whole file
+type Segment struct {
+	Index     int    `yaml:"index" json:"index"`
+	Count     int    `yaml:"count" json:"count"`
+	Offset    int64  `yaml:"offset" json:"offset"`
+	TotalSize int64  `yaml:"total_size" json:"total_size"`
+	Hash      string `yaml:"hash" json:"hash"`
+	// Mode is the permissions of the whole file. Segments are written with
+	// the owner able to write, and this is only applied once they are all in
+	Mode fs.FileMode `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// splitLargeFiles replaces any file bigger than maxSize with its segments
+func splitLargeFiles(files []*File, maxSize int64, alg HashAlgorithm) ([]*File, error) {
+	if maxSize == 0 {
+		return files, nil
+	}
+	ret := make([]*File, 0, len(files))
+	for _, f := range files {
+		if f.StoredSize() <= maxSize {
+			ret = append(ret, f)
+			continue
+		}
+		segments, err := splitFile(f, maxSize, alg)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, segments...)
+	}
+	return ret, nil
+}
+
+// splitFile breaks f up in to segments of at most maxSize bytes, hashing each
+// segment, and the whole file too if it doesn't have a hash yet, in one read
+func splitFile(f *File, maxSize int64, alg HashAlgorithm) ([]*File, error) {
+	count := int((f.Size + maxSize - 1) / maxSize)
+	slog.Info("splitting large file in to segments", "path", f.Path, "size", f.Size, "segments", count)
+	fh, err := os.Open(f.Path) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(fh)
+	info, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+	mode := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+
+	var whole hash.Hash
+	if f.Hash == "" {
+		if whole, err = alg.NewHasher(); err != nil {
+			return nil, err
+		}
+	}
+	ret := make([]*File, count)
+	for i := range ret {
+		offset := int64(i) * maxSize
+		length := min(maxSize, f.Size-offset)
+		h, err := alg.NewHasher()
+		if err != nil {
+			return nil, err
+		}
+		w := io.Writer(h)
+		if whole != nil {
+			w = io.MultiWriter(h, whole)
+		}
+		if _, err := io.CopyN(w, fh, length); err != nil {
+			return nil, fmt.Errorf("could not read segment %v of %v: %w", i+1, f.Path, err)
+		}
+		seg := *f
+		seg.Size = length
+		seg.Segment = &Segment{
+			Index:     i + 1,
+			Count:     count,
+			Offset:    offset,
+			TotalSize: f.Size,
+			Hash:      fmt.Sprintf("%x", h.Sum(nil)),
+			Mode:      mode,
+		}
+		ret[i] = &seg
+	}
+	if whole != nil {
+		sum := fmt.Sprintf("%x", whole.Sum(nil))
+		for _, seg := range ret {
+			seg.Hash = sum
+		}
+	}
+	return ret, nil
+}
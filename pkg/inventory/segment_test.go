@@ -0,0 +1,112 @@
+package inventory
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitLargeFiles(t *testing.T) {
+	src := t.TempDir()
+	big := strings.Repeat("0123456789", 2) + "abcde"
+	require.NoError(t, os.WriteFile(path.Join(src, "big.dat"), []byte(big), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(src, "small.txt"), []byte("small"), 0o644))
+
+	_, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithMaxSuitcaseSize(10),
+	))
+	require.EqualError(t, err, "index contains at least one file that is too large")
+
+	i, err := NewDirectoryInventory(NewOptions(
+		WithDirectories([]string{src}),
+		WithMaxSuitcaseSize(10),
+		WithSplitLargeFiles(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, 4, len(i.Files))
+	require.Equal(t, 3, i.TotalIndexes)
+
+	whole, err := HashFile(path.Join(src, "big.dat"), MD5Hash)
+	require.NoError(t, err)
+	segments := map[int]*File{}
+	suitcases := map[int]bool{}
+	for _, f := range i.Files {
+		if f.Segment == nil {
+			require.Equal(t, "small.txt", f.Name)
+			continue
+		}
+		require.Equal(t, "big.dat", f.Destination)
+		require.Equal(t, 3, f.Segment.Count)
+		require.Equal(t, int64(25), f.Segment.TotalSize)
+		require.Equal(t, os.FileMode(0o644), f.Segment.Mode)
+		require.Equal(t, whole, f.Hash)
+		expected, err := HashReader(strings.NewReader(big[f.Segment.Offset:f.Segment.Offset+f.Size]), MD5Hash)
+		require.NoError(t, err)
+		require.Equal(t, expected, f.Segment.Hash)
+		segments[f.Segment.Index] = f
+		require.False(t, suitcases[f.SuitcaseIndex], "segments should each get their own suitcase")
+		suitcases[f.SuitcaseIndex] = true
+	}
+	require.Equal(t, int64(0), segments[1].Segment.Offset)
+	require.Equal(t, int64(10), segments[2].Segment.Offset)
+	require.Equal(t, int64(20), segments[3].Segment.Offset)
+	require.Equal(t, int64(5), segments[3].Size)
+}
+
+func TestSplitLargeFilesStream(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(src, "big.dat"), bytes.Repeat([]byte("x"), 25), 0o644))
+
+	var buf bytes.Buffer
+	i, err := NewDirectoryInventoryStream(NewOptions(
+		WithDirectories([]string{src}),
+		WithMaxSuitcaseSize(10),
+		WithSplitLargeFiles(),
+	), &buf)
+	require.NoError(t, err)
+	require.Equal(t, 3, i.TotalIndexes)
+
+	nr, err := NewNDJSONReader(&buf)
+	require.NoError(t, err)
+	var got []int64
+	for {
+		f, err := nr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		require.NotNil(t, f.Segment)
+		got = append(got, f.Segment.Offset)
+	}
+	require.Equal(t, []int64{0, 10, 20}, got)
+}
+
+func TestIncrementalWithSegments(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(src, "big.dat"), bytes.Repeat([]byte("x"), 25), 0o644))
+	opts := func(extra ...func(*Options)) *Options {
+		return NewOptions(append([]func(*Options){
+			WithDirectories([]string{src}),
+			WithMaxSuitcaseSize(10),
+			WithSplitLargeFiles(),
+		}, extra...)...)
+	}
+	first, err := NewDirectoryInventory(opts())
+	require.NoError(t, err)
+
+	second, err := NewDirectoryInventory(opts(WithPreviousInventory(writeTestInventory(t, first))))
+	require.NoError(t, err)
+	require.Empty(t, second.Files)
+	require.Empty(t, second.Delta.Changed)
+	require.Equal(t, 3, len(second.Delta.Unchanged))
+	for _, f := range second.Delta.Unchanged {
+		require.NotNil(t, f.Segment)
+		require.Equal(t, first.SuitcaseNameWithIndex(f.Segment.Index), f.SuitcaseName)
+	}
+}
@@ -0,0 +1,269 @@
+package inventory
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// StatsBucket is a count and total size of files falling in to some group,
+// such as an extension, size range or age range
+type StatsBucket struct {
+	Name      string `yaml:"name" json:"name"`
+	Count     uint   `yaml:"count" json:"count"`
+	Size      int64  `yaml:"size" json:"size"`
+	HumanSize string `yaml:"human_size" json:"human_size"`
+}
+
+func (b *StatsBucket) add(size int64) {
+	b.Count++
+	b.Size += size
+}
+
+// SuitcaseFill is how full a single suitcase is, compared to the max suitcase
+// size. FillPercent is 0 when there is no max suitcase size
+type SuitcaseFill struct {
+	Index       int     `yaml:"index" json:"index"`
+	Name        string  `yaml:"name" json:"name"`
+	Count       uint    `yaml:"count" json:"count"`
+	Size        int64   `yaml:"size" json:"size"`
+	HumanSize   string  `yaml:"human_size" json:"human_size"`
+	FillPercent float64 `yaml:"fill_percent" json:"fill_percent"`
+}
+
+// Stats is a report on what makes up an inventory
+type Stats struct {
+	FileCount     uint            `yaml:"file_count" json:"file_count"`
+	TotalSize     int64           `yaml:"total_size" json:"total_size"`
+	TotalSizeHR   string          `yaml:"total_size_hr" json:"total_size_hr"`
+	Extensions    []*StatsBucket  `yaml:"extensions" json:"extensions"`
+	SizeHistogram []*StatsBucket  `yaml:"size_histogram" json:"size_histogram"`
+	AgeHistogram  []*StatsBucket  `yaml:"age_histogram" json:"age_histogram"`
+	TopDirs       []*StatsBucket  `yaml:"top_directories" json:"top_directories"`
+	Suitcases     []*SuitcaseFill `yaml:"suitcases" json:"suitcases"`
+}
+
+// sizeBuckets are the upper bounds (exclusive) of the size histogram buckets
+var sizeBuckets = []struct {
+	name string
+	max  int64
+}{
+	{"< 1 KB", 1000},
+	{"1 KB - 1 MB", 1000 * 1000},
+	{"1 MB - 100 MB", 100 * 1000 * 1000},
+	{"100 MB - 1 GB", 1000 * 1000 * 1000},
+	{"1 GB - 10 GB", 10 * 1000 * 1000 * 1000},
+	{">= 10 GB", -1},
+}
+
+// ageBuckets are the upper bounds (exclusive) of the modification time age
+// histogram buckets
+var ageBuckets = []struct {
+	name string
+	max  time.Duration
+}{
+	{"< 30 days", 30 * day},
+	{"30 - 90 days", 90 * day},
+	{"90 days - 1 year", 365 * day},
+	{"1 - 3 years", 3 * 365 * day},
+	{"3 - 5 years", 5 * 365 * day},
+	{">= 5 years", -1},
+}
+
+const day = 24 * time.Hour
+
+// Stats returns a report of the bytes and counts per extension, size and age
+// histograms, the topN directories by size and how full each suitcase is. A
+// topN of 0 or less includes every directory
+func (di Inventory) Stats(topN int) (*Stats, error) {
+	return di.statsAt(topN, time.Now())
+}
+
+func (di Inventory) statsAt(topN int, now time.Time) (*Stats, error) {
+	s := &Stats{}
+	exts := map[string]*StatsBucket{}
+	dirs := map[string]*StatsBucket{}
+	sizes := make([]*StatsBucket, len(sizeBuckets))
+	for idx, b := range sizeBuckets {
+		sizes[idx] = &StatsBucket{Name: b.name}
+	}
+	ages := make([]*StatsBucket, len(ageBuckets))
+	for idx, b := range ageBuckets {
+		ages[idx] = &StatsBucket{Name: b.name}
+	}
+
+	if err := di.EachFile(func(f *File) error {
+		s.FileCount++
+		s.TotalSize += f.Size
+
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext == "" {
+			ext = "(none)"
+		}
+		bucketFor(exts, ext).add(f.Size)
+
+		// Directory entries carry a trailing slash, so they count as themselves
+		bucketFor(dirs, path.Dir(strings.TrimSuffix(f.Destination, "/"))).add(f.Size)
+
+		for idx, b := range sizeBuckets {
+			if b.max < 0 || f.Size < b.max {
+				sizes[idx].add(f.Size)
+				break
+			}
+		}
+
+		age := now.Sub(f.ModTime)
+		for idx, b := range ageBuckets {
+			if b.max < 0 || age < b.max {
+				ages[idx].add(f.Size)
+				break
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	s.TotalSizeHR = humanize.Bytes(int64ToUint64(s.TotalSize))
+	s.Extensions = sortedBuckets(exts, 0)
+	s.TopDirs = sortedBuckets(dirs, topN)
+	s.SizeHistogram = withHumanSizes(sizes)
+	s.AgeHistogram = withHumanSizes(ages)
+	s.Suitcases = di.suitcaseFills()
+	return s, nil
+}
+
+func bucketFor(m map[string]*StatsBucket, name string) *StatsBucket {
+	b, ok := m[name]
+	if !ok {
+		b = &StatsBucket{Name: name}
+		m[name] = b
+	}
+	return b
+}
+
+// sortedBuckets returns the buckets in m from biggest to smallest, keeping
+// only the first n if n is greater than 0
+func sortedBuckets(m map[string]*StatsBucket, n int) []*StatsBucket {
+	ret := make([]*StatsBucket, 0, len(m))
+	for _, b := range m {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Size != ret[j].Size {
+			return ret[i].Size > ret[j].Size
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return withHumanSizes(ret)
+}
+
+func withHumanSizes(buckets []*StatsBucket) []*StatsBucket {
+	for _, b := range buckets {
+		b.HumanSize = humanize.Bytes(int64ToUint64(b.Size))
+	}
+	return buckets
+}
+
+// suitcaseFills returns how full each suitcase is, in index order
+func (di Inventory) suitcaseFills() []*SuitcaseFill {
+	idxs := make([]int, 0, len(di.IndexSummaries))
+	for k := range di.IndexSummaries {
+		idxs = append(idxs, k)
+	}
+	sort.Ints(idxs)
+	ret := make([]*SuitcaseFill, len(idxs))
+	for n, k := range idxs {
+		sum := di.IndexSummaries[k]
+		fill := &SuitcaseFill{
+			Index:     k,
+			Count:     sum.Count,
+			Size:      sum.Size,
+			HumanSize: humanize.Bytes(int64ToUint64(sum.Size)),
+		}
+		if di.Options != nil {
+			fill.Name = di.SuitcaseNameWithIndex(k)
+			if di.Options.MaxSuitcaseSize > 0 {
+				fill.FillPercent = float64(sum.Size) / float64(di.Options.MaxSuitcaseSize) * 100
+			}
+		}
+		ret[n] = fill
+	}
+	return ret
+}
+
+// StatsTable is a titled table of values, used to render Stats out as text
+type StatsTable struct {
+	Title  string
+	Header []string
+	Rows   [][]string
+}
+
+// Tables returns the report as a set of tables, ready to be rendered
+func (s Stats) Tables() []StatsTable {
+	bucketTable := func(title, name string, buckets []*StatsBucket) StatsTable {
+		t := StatsTable{Title: title, Header: []string{name, "Files", "Size"}}
+		for _, b := range buckets {
+			t.Rows = append(t.Rows, []string{b.Name, fmt.Sprint(b.Count), b.HumanSize})
+		}
+		return t
+	}
+	suitcases := StatsTable{Title: "Suitcase Fill", Header: []string{"Suitcase", "Files", "Size", "Fill"}}
+	for _, f := range s.Suitcases {
+		name := f.Name
+		if name == "" {
+			name = fmt.Sprint(f.Index)
+		}
+		suitcases.Rows = append(suitcases.Rows, []string{name, fmt.Sprint(f.Count), f.HumanSize, fmt.Sprintf("%.1f%%", f.FillPercent)})
+	}
+	return []StatsTable{
+		{
+			Title:  "Summary",
+			Header: []string{"Files", "Size"},
+			Rows:   [][]string{{fmt.Sprint(s.FileCount), s.TotalSizeHR}},
+		},
+		bucketTable("Extensions", "Extension", s.Extensions),
+		bucketTable("File Sizes", "Size Range", s.SizeHistogram),
+		bucketTable("Modification Ages", "Age", s.AgeHistogram),
+		bucketTable("Top Directories", "Directory", s.TopDirs),
+		suitcases,
+	}
+}
+
+// WriteMarkdown writes the report out as a set of markdown tables
+func (s Stats) WriteMarkdown(w io.Writer) error {
+	var b strings.Builder
+	for idx, t := range s.Tables() {
+		if idx > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "## %v\n\n", t.Title)
+		b.WriteString(markdownRow(t.Header))
+		seps := make([]string, len(t.Header))
+		for i := range seps {
+			seps[i] = "---"
+		}
+		b.WriteString(markdownRow(seps))
+		for _, row := range t.Rows {
+			b.WriteString(markdownRow(row))
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for idx, c := range cells {
+		escaped[idx] = strings.ReplaceAll(c, "|", `\|`)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |\n"
+}
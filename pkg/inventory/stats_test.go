@@ -0,0 +1,74 @@
+package inventory
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	i := Inventory{
+		Options: &Options{Prefix: "snap", User: "joe", SuitcaseFormat: "tar", MaxSuitcaseSize: 10000},
+		Files: []*File{
+			{Name: "a.h5", Destination: "raw/a.h5", Size: 4000, ModTime: now.Add(-10 * day)},
+			{Name: "b.H5", Destination: "raw/b.H5", Size: 2000, ModTime: now.Add(-100 * day)},
+			{Name: "notes.txt", Destination: "notes.txt", Size: 10, ModTime: now.Add(-4 * 365 * day)},
+			{Name: "README", Destination: "docs/README", Size: 2_000_000, ModTime: now.Add(-6 * 365 * day)},
+		},
+		TotalIndexes: 2,
+		IndexSummaries: map[int]*IndexSummary{
+			2: {Count: 1, Size: 2_000_000},
+			1: {Count: 3, Size: 6010},
+		},
+	}
+	got, err := i.statsAt(2, now)
+	require.NoError(t, err)
+	require.Equal(t, uint(4), got.FileCount)
+	require.Equal(t, int64(2_006_010), got.TotalSize)
+	require.Equal(t, "2.0 MB", got.TotalSizeHR)
+
+	require.Equal(t, []*StatsBucket{
+		{Name: "(none)", Count: 1, Size: 2_000_000, HumanSize: "2.0 MB"},
+		{Name: ".h5", Count: 2, Size: 6000, HumanSize: "6.0 kB"},
+		{Name: ".txt", Count: 1, Size: 10, HumanSize: "10 B"},
+	}, got.Extensions)
+
+	require.Equal(t, []*StatsBucket{
+		{Name: "docs", Count: 1, Size: 2_000_000, HumanSize: "2.0 MB"},
+		{Name: "raw", Count: 2, Size: 6000, HumanSize: "6.0 kB"},
+	}, got.TopDirs)
+
+	counts := func(buckets []*StatsBucket) []uint {
+		ret := make([]uint, len(buckets))
+		for idx, b := range buckets {
+			ret[idx] = b.Count
+		}
+		return ret
+	}
+	require.Equal(t, []uint{1, 2, 1, 0, 0, 0}, counts(got.SizeHistogram))
+	require.Equal(t, []uint{1, 0, 1, 0, 1, 1}, counts(got.AgeHistogram))
+
+	require.Equal(t, 2, len(got.Suitcases))
+	require.Equal(t, 1, got.Suitcases[0].Index)
+	require.Equal(t, "snap-joe-01-of-02.tar", got.Suitcases[0].Name)
+	require.InDelta(t, 60.1, got.Suitcases[0].FillPercent, 0.001)
+	require.InDelta(t, 20000.0, got.Suitcases[1].FillPercent, 0.001)
+}
+
+func TestStatsMarkdown(t *testing.T) {
+	i := Inventory{
+		Files: []*File{
+			{Name: "a|b.txt", Destination: "a|b.txt", Size: 5},
+		},
+	}
+	got, err := i.Stats(10)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	require.NoError(t, got.WriteMarkdown(&b))
+	require.Contains(t, b.String(), "## Summary\n\n| Files | Size |\n| --- | --- |\n| 1 | 5 B |\n")
+	require.Contains(t, b.String(), "| . | 1 | 5 B |\n")
+	require.Contains(t, b.String(), "## Suitcase Fill\n\n| Suitcase | Files | Size | Fill |\n| --- | --- | --- | --- |\n")
+}
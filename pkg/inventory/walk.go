@@ -0,0 +1,229 @@
+package inventory
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// walkState is shared by everything walking the top level directories of a
+// single inventory
+type walkState struct {
+	mu         sync.Mutex
+	rules      []*ignoreRules
+	filters    *fileFilters
+	preserved  *preservedEntries
+	duplicates *duplicates
+}
+
+func newWalkState(opts *Options) (*walkState, error) {
+	filters, err := newFileFilters(opts.Filters)
+	if err != nil {
+		return nil, err
+	}
+	return &walkState{
+		filters:    filters,
+		preserved:  newPreservedEntries(),
+		duplicates: newDuplicates(),
+	}, nil
+}
+
+// wrap returns fn, resolving hardlinks first when preserving them
+func (s *walkState) wrap(opts *Options, fn func(*File) error) func(*File) error {
+	if !opts.Preserve {
+		return fn
+	}
+	return s.preserved.wrap(fn)
+}
+
+// ignoreRules returns the ignore rules for the top level directory dir. Each
+// top level directory gets its own, since patterns are anchored to it
+func (s *walkState) ignoreRules(dir string) *ignoreRules {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.rules {
+		if r.top == dir {
+			return r
+		}
+	}
+	r := newIgnoreRules(dir)
+	s.rules = append(s.rules, r)
+	return r
+}
+
+// record fills in what was learned while walking on the inventory
+func (s *walkState) record(i *Inventory) {
+	s.mu.Lock()
+	i.IgnoreRules = nil
+	for _, r := range s.rules {
+		i.IgnoreRules = append(i.IgnoreRules, r.effective()...)
+	}
+	s.mu.Unlock()
+	i.Excluded = s.filters.excluded()
+	i.EntryCounts = s.preserved.entryCounts()
+}
+
+// walkAheadPerWorker is how many directory listings each worker may have read
+// ahead of the files being handed out. Past that, directories are only read as
+// they come up, so memory stays bounded no matter how big the tree is
+var walkAheadPerWorker = 16
+
+// parallelWalker reads directories with a bounded number of workers, but
+// hands files back out in a fixed order: sorted by name within a directory,
+// descending in to each subdirectory as it comes up
+type parallelWalker struct {
+	dir      string
+	opts     *Options
+	state    *walkState
+	rules    *ignoreRules
+	sem      chan struct{}
+	ahead    chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// dirListing is a single directory read by the parallel walker. done is
+// closed once entries (or err) are filled in
+type dirListing struct {
+	path    string
+	start   sync.Once
+	ahead   bool
+	done    chan struct{}
+	entries []walkEntry
+	err     error
+}
+
+// walkEntry is either a file or a subdirectory, in the order they appear
+type walkEntry struct {
+	file *File
+	sub  *dirListing
+}
+
+// walkDirParallel walks dir with opts.WalkConcurrency workers, calling fn for
+// each file in a deterministic order
+func walkDirParallel(dir string, opts *Options, state *walkState, fn func(*File) error) error {
+	w := &parallelWalker{
+		dir:   dir,
+		opts:  opts,
+		state: state,
+		rules: state.ignoreRules(dir),
+		sem:   make(chan struct{}, opts.WalkConcurrency),
+		ahead: make(chan struct{}, opts.WalkConcurrency*walkAheadPerWorker),
+		stop:  make(chan struct{}),
+	}
+	var addedCount int
+	err := w.emit(w.list(filepath.Clean(dir)), func(f *File) error {
+		if err := fn(f); err != nil {
+			return err
+		}
+		addedCount++
+		return haltIfLimit(opts, addedCount)
+	})
+	w.stopOnce.Do(func() { close(w.stop) })
+	w.wg.Wait()
+	return err
+}
+
+// list returns a listing for path. It is read in the background right away
+// when there is room to read ahead, otherwise emit reads it once it gets there
+func (w *parallelWalker) list(path string) *dirListing {
+	l := &dirListing{path: path, done: make(chan struct{})}
+	select {
+	case w.ahead <- struct{}{}:
+		l.ahead = true
+		w.start(l)
+	default:
+	}
+	return l
+}
+
+// start reads l in the background, if it isn't already being read
+func (w *parallelWalker) start(l *dirListing) {
+	l.start.Do(func() {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			defer close(l.done)
+			select {
+			case w.sem <- struct{}{}:
+			case <-w.stop:
+				return
+			}
+			defer func() { <-w.sem }()
+			l.entries, l.err = w.read(l.path)
+		}()
+	})
+}
+
+// read lists a single directory, building up Files and listing any
+// subdirectories that aren't ignored
+func (w *parallelWalker) read(path string) ([]walkEntry, error) {
+	if !w.opts.NoIgnoreFiles {
+		// Loaded before any subdirectories are listed, so they see these rules
+		if err := w.rules.load(path); err != nil {
+			return nil, err
+		}
+	}
+	des, err := os.ReadDir(path)
+	if err != nil {
+		// Same as the serial walk, unreadable directories are skipped
+		slog.Debug("skipping unreadable directory", "directory", path, "error", err)
+		return nil, nil
+	}
+	ret := make([]walkEntry, 0, len(des))
+	for _, de := range des {
+		select {
+		case <-w.stop:
+			return nil, nil
+		default:
+		}
+		full := filepath.Join(path, de.Name())
+		isSymlink := de.Type()&os.ModeSymlink != 0
+		isDir := de.IsDir() || (isSymlink && w.opts.followSymlinks() && isDirectory(full))
+		if w.rules.ignored(full, isDir) {
+			continue
+		}
+		if isDir && !(w.opts.Preserve && isEmptyDir(full)) {
+			ret = append(ret, walkEntry{sub: w.list(full)})
+			continue
+		}
+		f, err := newWalkedFile(w.dir, full, de.Name(), isSymlink, w.opts, w.state.filters)
+		if err != nil {
+			return nil, err
+		}
+		if f != nil {
+			ret = append(ret, walkEntry{file: f})
+		}
+	}
+	return ret, nil
+}
+
+// emit waits on each listing in turn, calling fn for every file. Entries are
+// let go of as soon as they are handed out, and the listing's read ahead room
+// is given back once it is done
+func (w *parallelWalker) emit(l *dirListing, fn func(*File) error) error {
+	w.start(l)
+	<-l.done
+	if l.err != nil {
+		return l.err
+	}
+	for idx, e := range l.entries {
+		l.entries[idx] = walkEntry{}
+		if e.sub != nil {
+			if err := w.emit(e.sub, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(e.file); err != nil {
+			return err
+		}
+	}
+	l.entries = nil
+	if l.ahead {
+		<-w.ahead
+	}
+	return nil
+}
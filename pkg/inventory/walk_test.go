@@ -0,0 +1,97 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func walkedDestinations(t *testing.T, dir string, opts *Options) []string {
+	got := []string{}
+	err := walkDirWithFunc(dir, opts, func(f *File) error {
+		got = append(got, f.Destination)
+		return nil
+	})
+	if err != nil {
+		require.EqualError(t, err, "halt")
+	}
+	return got
+}
+
+func TestWalkDirParallel(t *testing.T) {
+	serial := walkedDestinations(t, "../testdata/fake-dir", NewOptions(WithFollowSymlinks()))
+	sort.Strings(serial)
+
+	var first []string
+	for _, workers := range []int{2, 4, 16} {
+		got := walkedDestinations(t, "../testdata/fake-dir", NewOptions(
+			WithFollowSymlinks(),
+			WithWalkConcurrency(workers),
+		))
+		if first == nil {
+			first = append([]string{}, got...)
+		}
+		require.Equal(t, first, got, "parallel walk order should not depend on the workers")
+		sort.Strings(got)
+		require.Equal(t, serial, got, "parallel walk should find the same files as the serial one")
+	}
+}
+
+func TestWalkDirParallelOptions(t *testing.T) {
+	got := walkedDestinations(t, "../testdata/fake-dir", NewOptions(
+		WithWalkConcurrency(4),
+		WithIgnoreGlobs([]string{"*.out"}),
+	))
+	require.NotEmpty(t, got)
+	for _, item := range got {
+		require.NotEqual(t, ".out", filepath.Ext(item))
+		require.NotContains(t, item, "external-symlink")
+	}
+
+	all := walkedDestinations(t, "../testdata/limit-dir", NewOptions(WithWalkConcurrency(4)))
+	limited := walkedDestinations(t, "../testdata/limit-dir", NewOptions(
+		WithWalkConcurrency(4),
+		WithLimitFileCount(10),
+	))
+	require.Equal(t, all[:10], limited)
+}
+
+func TestNewDirectoryInventoryParallel(t *testing.T) {
+	tocs := func(opts ...func(*Options)) map[string][]ArchiveEntry {
+		i, err := NewDirectoryInventory(NewOptions(append(opts,
+			WithDirectories([]string{"../testdata/archives"}),
+			WithArchiveTOC(),
+		)...))
+		require.NoError(t, err)
+		ret := map[string][]ArchiveEntry{}
+		for _, f := range i.Files {
+			ret[f.Destination] = f.ArchiveTOC
+		}
+		return ret
+	}
+	require.Equal(t, tocs(), tocs(WithWalkConcurrency(4)))
+}
+
+func TestWalkDirParallelReadAhead(t *testing.T) {
+	// A tree with far more directories than the walker may read ahead
+	dir := t.TempDir()
+	for i := range 20 {
+		sub := filepath.Join(dir, fmt.Sprintf("d%02d", i), "inner", "deeper")
+		require.NoError(t, os.MkdirAll(sub, 0o750))
+		for _, d := range []string{filepath.Dir(filepath.Dir(sub)), filepath.Dir(sub), sub} {
+			require.NoError(t, os.WriteFile(filepath.Join(d, "file.txt"), []byte("hi"), 0o600))
+		}
+	}
+	unbounded := walkedDestinations(t, dir, NewOptions(WithWalkConcurrency(4)))
+
+	orig := walkAheadPerWorker
+	defer func() { walkAheadPerWorker = orig }()
+	walkAheadPerWorker = 1
+	got := walkedDestinations(t, dir, NewOptions(WithWalkConcurrency(2)))
+	require.Len(t, got, 60)
+	require.Equal(t, unbounded, got, "reading ahead less should not change the order")
+}
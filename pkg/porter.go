@@ -342,7 +342,11 @@ func (p *Porter) CreateOrReadInventory(inventoryFile string) (*inventory.Invento
 		// Set this in porter so we can look at it later
 		p.InventoryFilePath = inventoryFile
 		var err error
-		inventoryD, err = inventory.NewInventoryWithFilename(inventoryFile)
+		if inventory.IsNDJSONFilename(inventoryFile) {
+			inventoryD, err = inventory.NewStreamingInventoryWithFilename(inventoryFile)
+		} else {
+			inventoryD, err = inventory.NewInventoryWithFilename(inventoryFile)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -405,6 +409,12 @@ func (p *Porter) getUserOverrides() *viper.Viper {
 
 // WriteInventory writes out an inventory file, and returns it, along with the actual Inventory
 func (p *Porter) WriteInventory() (*inventory.Inventory, *os.File, error) {
+	if p.UserOverrides == nil {
+		panic("must pass UserOverrides")
+	}
+	if opts := p.inventoryOptions(); opts.InventoryFormat == "ndjson" {
+		return p.writeStreamingInventory(opts)
+	}
 	i, f, ir, err := p.inventoryerGeneration()
 	if err != nil {
 		return nil, nil, err
@@ -431,8 +441,38 @@ func (p *Porter) inventoryerGeneration() (*inventory.Inventory, *os.File, invent
 	return i, f, ir, nil
 }
 
-// inventoryGeneration generates appropriate inventory pieces...
-func (p *Porter) inventoryGeneration() (*inventory.Inventory, *os.File, error) {
+// writeStreamingInventory walks the directories straight in to an NDJSON
+// inventory file, so the files are never all held in memory
+func (p *Porter) writeStreamingInventory(opts *inventory.Options) (*inventory.Inventory, *os.File, error) {
+	outF, err := p.createInventoryFile(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := inventory.NewDirectoryInventoryStream(opts, outF); err != nil {
+		return nil, nil, err
+	}
+	i, err := inventory.NewStreamingInventoryWithFilename(outF.Name())
+	if err != nil {
+		return nil, nil, err
+	}
+	if verr := i.ValidateAccess(); verr != nil {
+		return nil, nil, verr
+	}
+	return i, outF, nil
+}
+
+// createInventoryFile creates the file the inventory will be written to
+func (p *Porter) createInventoryFile(opts *inventory.Options) (*os.File, error) {
+	// If aren't using a specific inventory file path, go ahead and set it to the default location
+	if p.InventoryFilePath == "" {
+		p.InventoryFilePath = path.Join(p.Destination, fmt.Sprintf("inventory.%v", opts.InventoryFormat))
+	}
+	return os.Create(p.InventoryFilePath) // nolint:gosec
+}
+
+// inventoryOptions builds the inventory options from the command line, user
+// overrides and wizard
+func (p *Porter) inventoryOptions() *inventory.Options {
 	iopts := []func(*inventory.Options){}
 	if p.Cmd != nil {
 		iopts = append(iopts, inventory.WithCobra(p.Cmd, p.Args))
@@ -443,20 +483,19 @@ func (p *Porter) inventoryGeneration() (*inventory.Inventory, *os.File, error) {
 	if p.WizardForm != nil {
 		iopts = append(iopts, inventory.WithWizardForm(*p.WizardForm))
 	}
-	i, err := inventory.NewDirectoryInventory(
-		inventory.NewOptions(iopts...),
-	)
+	return inventory.NewOptions(iopts...)
+}
+
+// inventoryGeneration generates appropriate inventory pieces...
+func (p *Porter) inventoryGeneration() (*inventory.Inventory, *os.File, error) {
+	i, err := inventory.NewDirectoryInventory(p.inventoryOptions())
 	if err != nil {
 		return nil, nil, err
 	}
 	if verr := i.ValidateAccess(); verr != nil {
 		return nil, nil, verr
 	}
-	// If aren't using a specific inventory file path, go ahead and set it to the default location
-	if p.InventoryFilePath == "" {
-		p.InventoryFilePath = path.Join(p.Destination, fmt.Sprintf("inventory.%v", i.Options.InventoryFormat))
-	}
-	outF, err := os.Create(p.InventoryFilePath) // nolint:gosec
+	outF, err := p.createInventoryFile(i.Options)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -764,9 +803,22 @@ func (p *Porter) processSuitcases() ([]string, error) {
 // Run does the actual suitcase creation
 func (p *Porter) Run() error {
 	if p.SuitcaseOpts != nil {
+		// Catch an unknown format before any suitcases are written
+		if err := suitcase.ValidateFormat(p.SuitcaseOpts.Format); err != nil {
+			return err
+		}
 		if err := p.SuitcaseOpts.EncryptToCobra(p.Cmd); err != nil {
 			return err
 		}
+		if err := p.SuitcaseOpts.PasswordCobra(p.Cmd); err != nil {
+			return err
+		}
+		if err := p.SuitcaseOpts.CompressionCobra(p.Cmd); err != nil {
+			return err
+		}
+		if err := p.SuitcaseOpts.HashAlgorithmCobra(p.Cmd); err != nil {
+			return err
+		}
 	}
 
 	createdFiles, err := p.processSuitcases()
@@ -808,13 +860,27 @@ func (p *Porter) WriteSuitcaseFile(index int, stateC chan FillState) (string, er
 		}
 	}()
 
-	s, err := suitcase.New(target, p.SuitcaseOpts)
+	opts := *p.SuitcaseOpts
+	if opts.HashAlgorithm == "" && p.Inventory.Options.HashAlgorithm != inventory.NullHash {
+		// Inner hashes match the inventory, unless asked for something else
+		opts.HashAlgorithm = p.Inventory.Options.HashAlgorithm.String()
+	}
+	if opts.ParallelSuitcases == 0 {
+		// processSuitcases writes this many at once, all sharing the memory limit
+		opts.ParallelSuitcases = max(min(p.concurrency, p.Inventory.TotalIndexes), 1)
+	}
+	algs, err := suitcase.HashAlgorithms(&opts)
+	if err != nil {
+		return "", err
+	}
+
+	s, err := suitcase.New(target, &opts)
 	if err != nil {
 		return "", err
 	}
 	defer dclose(s)
 
-	log.Debug("Filling suitcase", "destination", targetFn, "format", p.SuitcaseOpts.Format, "encrypt-inner", p.SuitcaseOpts.EncryptInner)
+	log.Debug("Filling suitcase", "destination", targetFn, "format", opts.Format, "encrypt-inner", opts.EncryptInner)
 	hashes, err := p.Fill(s, index, stateC)
 	if err != nil {
 		return "", err
@@ -825,8 +891,8 @@ func (p *Porter) WriteSuitcaseFile(index int, stateC chan FillState) (string, er
 		stateC <- newCompleteFillState(index)
 	}
 
-	if p.SuitcaseOpts.HashInner {
-		if err := hashInner(targetFn, p.Inventory.Options.HashAlgorithm, hashes); err != nil {
+	if opts.HashInner {
+		if err := hashInner(targetFn, algs, hashes); err != nil {
 			return "", err
 		}
 	}
@@ -856,12 +922,14 @@ func (p *Porter) Fill(s suitcase.Suitcase, index int, stateC chan FillState) ([]
 	cur := uint(0)
 	var suitcaseHashes []config.HashSet
 
-	for _, f := range p.Inventory.Files {
+	// Streaming inventories read files back one at a time, so memory use stays
+	// bounded no matter how many files there are
+	if err := p.Inventory.EachFile(func(f *inventory.File) error {
 		l := slog.With(
 			"path", f.Path,
 			"index", index)
 		if f.SuitcaseIndex != index {
-			continue
+			return nil
 		}
 
 		l.Debug("Adding file to suitcase",
@@ -872,14 +940,15 @@ func (p *Porter) Fill(s suitcase.Suitcase, index int, stateC chan FillState) ([]
 		if s.Config().EncryptInner {
 			err = s.AddEncrypt(*f)
 			if err != nil {
-				return nil, fmt.Errorf("encountered error adding file to suitcase: %v", err)
+				return fmt.Errorf("encountered error adding file to suitcase: %v", err)
 			}
 		} else {
 			hs, err := s.Add(*f)
 			if err != nil {
-				return nil, fmt.Errorf("encountered error adding file to suitcase: %v", err)
+				return fmt.Errorf("encountered error adding file to suitcase: %v", err)
 			}
-			if s.Config().HashInner {
+			// Entries without content, like links and duplicates, have no hash
+			if s.Config().HashInner && hs != nil {
 				suitcaseHashes = append(suitcaseHashes, *hs)
 			}
 		}
@@ -888,6 +957,9 @@ func (p *Porter) Fill(s suitcase.Suitcase, index int, stateC chan FillState) ([]
 		if stateC != nil {
 			stateC <- newInProgressFillState(cur, total, index)
 		}
+		return nil
+	}); err != nil {
+		return nil, err
 	}
 	return suitcaseHashes, nil
 }
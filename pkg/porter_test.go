@@ -95,6 +95,89 @@ func TestWriteInventoryFile(t *testing.T) {
 	require.NotNil(t, i)
 }
 
+func TestWriteInventoryFileJSON(t *testing.T) {
+	f := t.TempDir()
+	cmd := inventory.NewInventoryCmd()
+	_ = cmd.Execute() // Test helper
+	v := viper.New()
+	v.Set("inventory-format", "json")
+	ptr := New(
+		WithDestination(f),
+		WithCmdArgs(cmd, []string{"./testdata/fake-dir"}),
+		WithUserOverrides(v),
+	)
+	i, gf, err := ptr.WriteInventory()
+	require.NoError(t, err)
+	require.Equal(t, path.Join(f, "inventory.json"), gf.Name())
+	require.NoError(t, gf.Close())
+
+	got, err := inventory.NewInventoryWithFilename(gf.Name())
+	require.NoError(t, err)
+	require.Equal(t, len(i.Files), len(got.Files))
+	require.Equal(t, i.Files[0], got.Files[0])
+	require.Equal(t, "json", got.Options.InventoryFormat)
+}
+
+func TestWriteInventoryFileNDJSON(t *testing.T) {
+	f := t.TempDir()
+	cmd := inventory.NewInventoryCmd()
+	_ = cmd.Execute() // Test helper
+	v := viper.New()
+	v.Set("inventory-format", "ndjson")
+	v.Set("suitcase-format", "tar")
+	ptr := New(
+		WithDestination(f),
+		WithCmdArgs(cmd, []string{"./testdata/limit-dir"}),
+		WithUserOverrides(v),
+	)
+	i, gf, err := ptr.WriteInventory()
+	require.NoError(t, err)
+	require.Equal(t, path.Join(f, "inventory.ndjson"), gf.Name())
+	require.Nil(t, i.Files)
+	require.NoError(t, gf.Close())
+
+	// Suitcases are filled by streaming the inventory back off of disk
+	got, err := ptr.CreateOrReadInventory(gf.Name())
+	require.NoError(t, err)
+	require.Nil(t, got.Files)
+	ptr.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar"}
+	fn, err := ptr.WriteSuitcaseFile(1, nil)
+	require.NoError(t, err)
+	require.FileExists(t, fn)
+
+	target := t.TempDir()
+	require.NoError(t, ptr.Restore(f, target))
+}
+
+func TestWriteInventoryFileIncremental(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(src, "old.txt"), []byte("old"), 0o644))
+	cmd := inventory.NewInventoryCmd()
+	_ = cmd.Execute() // Test helper
+	first := New(
+		WithDestination(t.TempDir()),
+		WithCmdArgs(cmd, []string{src}),
+		WithUserOverrides(viper.New()),
+	)
+	_, prevF, err := first.WriteInventory()
+	require.NoError(t, err)
+	require.NoError(t, prevF.Close())
+
+	require.NoError(t, os.WriteFile(path.Join(src, "new.txt"), []byte("new"), 0o644))
+	v := viper.New()
+	v.Set("previous-inventory", prevF.Name())
+	second := New(
+		WithDestination(t.TempDir()),
+		WithCmdArgs(cmd, []string{src}),
+		WithUserOverrides(v),
+	)
+	i, _, err := second.WriteInventory()
+	require.NoError(t, err)
+	require.Equal(t, 1, len(i.Files))
+	require.Equal(t, "new.txt", i.Files[0].Name)
+	require.Equal(t, 1, len(i.Delta.Unchanged))
+}
+
 func TestPorterNew(t *testing.T) {
 	got := New(
 		WithVersion("0.1.2"),
@@ -609,3 +692,59 @@ func TestFillWithInventoryIndex(t *testing.T) {
 	require.NoError(t, err)
 }
 */
+
+func TestFillHashInnerSymlink(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(src, "data.txt"), []byte("data"), 0o644))
+	require.NoError(t, os.Symlink("data.txt", path.Join(src, "link.txt")))
+
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar"),
+		inventory.WithPreserve(),
+	))
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	p := New(
+		WithInventory(i),
+		WithDestination(dest),
+	)
+	p.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar", HashInner: true, HashAlgorithm: "md5"}
+	fn, err := p.WriteSuitcaseFile(1, nil)
+	require.NoError(t, err)
+
+	// Only the regular file has any content to hash
+	got, err := os.ReadFile(fn + ".md5")
+	require.NoError(t, err)
+	require.Equal(t, 1, bytes.Count(got, []byte("\n")))
+	require.Contains(t, string(got), "data.txt")
+}
+
+func TestFillHashInnerDuplicates(t *testing.T) {
+	src := t.TempDir()
+	for _, fn := range []string{"a.dat", "b.dat", "c.dat"} {
+		require.NoError(t, os.WriteFile(path.Join(src, fn), []byte("same content"), 0o644))
+	}
+
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar"),
+		inventory.WithDedup(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, uint(2), i.Analyze().DuplicateCount)
+
+	p := New(
+		WithInventory(i),
+		WithDestination(t.TempDir()),
+	)
+	p.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar", HashInner: true}
+	fn, err := p.WriteSuitcaseFile(1, nil)
+	require.NoError(t, err)
+
+	// Duplicates are stored header only, so only the canonical file is hashed
+	got, err := os.ReadFile(fn + "." + i.Options.HashAlgorithm.String())
+	require.NoError(t, err)
+	require.Equal(t, 1, bytes.Count(got, []byte("\n")))
+}
@@ -0,0 +1,210 @@
+package porter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase"
+)
+
+// Restore unpacks every suitcase in the inventory from suitcaseDir, writing
+// the files back out to their inventory Destination underneath target. Files an
+// incremental inventory left unchanged are picked out of the earlier suitcases
+// holding them, which must be in suitcaseDir too
+func (p *Porter) Restore(suitcaseDir, target string) error {
+	if p.Inventory == nil {
+		return errors.New("must have set Inventory")
+	}
+	if target == "" {
+		return errors.New("must set a target directory to restore in to")
+	}
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	restored := map[string]bool{}
+	record := func(got []string) {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, item := range got {
+			restored[item] = true
+		}
+	}
+	pl := newPool(p.concurrency)
+	for i := 1; i <= p.Inventory.TotalIndexes; i++ {
+		pl.Go(func() error {
+			got, err := p.RestoreSuitcase(path.Join(suitcaseDir, p.Inventory.SuitcaseNameWithIndex(i)), target)
+			if err != nil {
+				return err
+			}
+			record(got)
+			return nil
+		})
+	}
+	for name, names := range p.unchangedBySuitcase() {
+		pl.Go(func() error {
+			got, err := p.retrieveFromSuitcase(suitcaseDir, name, target, names)
+			if err != nil {
+				return err
+			}
+			record(got)
+			return nil
+		})
+	}
+	if err := pl.Wait(); err != nil {
+		return err
+	}
+
+	missing := []string{}
+	segments := []*inventory.File{}
+	references := []*inventory.File{}
+	if err := p.Inventory.EachOfAllFiles(func(f *inventory.File) error {
+		if !restored[f.Destination] {
+			missing = append(missing, f.Destination)
+		}
+		if f.Segment != nil {
+			segments = append(segments, f)
+		}
+		if f.Type == inventory.HardlinkEntry || f.DuplicateOf != "" {
+			references = append(references, f)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("the following files were not found in the suitcases: %v", strings.Join(missing, ","))
+	}
+	if err := p.verifySegments(segments, target); err != nil {
+		return err
+	}
+	if err := restoreReferences(references, target); err != nil {
+		return err
+	}
+	p.Logger.Info("restored files", "count", len(restored), "target", target)
+	return nil
+}
+
+// unchangedBySuitcase groups the destinations of the files an incremental
+// inventory left unchanged by the earlier suitcase holding them
+func (p *Porter) unchangedBySuitcase() map[string][]string {
+	ret := map[string][]string{}
+	if p.Inventory.Delta == nil {
+		return ret
+	}
+	for _, f := range p.Inventory.Delta.Unchanged {
+		name := p.Inventory.SuitcaseNameForFile(f)
+		ret[name] = append(ret[name], f.Destination)
+	}
+	return ret
+}
+
+// RestoreSuitcase unpacks a single suitcase file underneath target, returning
+// the names of the files restored
+func (p *Porter) RestoreSuitcase(fn, target string) ([]string, error) {
+	if p.Inventory == nil {
+		return nil, errors.New("must have set Inventory")
+	}
+	log := p.Logger.With("suitcase", fn)
+	f, err := os.Open(fn) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(f)
+
+	r, err := suitcase.NewReader(f, p.readerOpts())
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(r)
+
+	log.Debug("unpacking suitcase", "target", target)
+	got, err := suitcase.Unpack(r, target)
+	if err != nil {
+		return nil, fmt.Errorf("could not restore %v: %w", fn, err)
+	}
+	log.Info("restored suitcase", "file-count", len(got))
+	return got, nil
+}
+
+// readerOpts builds the suitcase options needed to read the inventory's suitcases back
+func (p *Porter) readerOpts() *config.SuitCaseOpts {
+	opts := &config.SuitCaseOpts{
+		Format:       p.Inventory.Options.SuitcaseFormat,
+		EncryptInner: p.Inventory.Options.EncryptInner,
+	}
+	if p.SuitcaseOpts != nil {
+		opts.DecryptWith = p.SuitcaseOpts.DecryptWith
+		opts.Password = p.SuitcaseOpts.Password
+	}
+	return opts
+}
+
+// verifySegments checks that the segments of any split files made it back in
+// to place intact, along with the whole file when its hash is known. Segments
+// can be written in any order, so the mode, ownership and times of the whole
+// file are only applied at the end
+func (p *Porter) verifySegments(files []*inventory.File, target string) error {
+	alg := p.Inventory.Options.HashAlgorithm
+	wholes := map[string]*inventory.File{}
+	for _, f := range files {
+		if f.Segment == nil {
+			continue
+		}
+		fn := filepath.Join(target, f.Destination)
+		got, err := hashSection(fn, f.Segment.Offset, f.Size, alg)
+		if err != nil {
+			return err
+		}
+		if got != f.Segment.Hash {
+			return fmt.Errorf("segment %v of %v does not match, expected %v %v but got %v", f.Segment.Index, f.Destination, alg, f.Segment.Hash, got)
+		}
+		wholes[f.Destination] = f
+	}
+	for dest, f := range wholes {
+		fn := filepath.Join(target, dest)
+		if f.Hash != "" {
+			got, err := inventory.HashFile(fn, alg)
+			if err != nil {
+				return err
+			}
+			if got != f.Hash {
+				return fmt.Errorf("reassembled %v does not match, expected %v %v but got %v", dest, alg, f.Hash, got)
+			}
+		}
+		if err := suitcase.RestoreSegmentedMetadata(fn, f); err != nil {
+			return err
+		}
+		p.Logger.Debug("verified reassembled file", "file", dest, "segments", f.Segment.Count)
+	}
+	return nil
+}
+
+// restoreReferences fills in the hardlinks and duplicates in files, once the
+// files they point at are all in place
+func restoreReferences(files []*inventory.File, target string) error {
+	if err := suitcase.LinkHardlinks(files, target); err != nil {
+		return err
+	}
+	return suitcase.CopyDuplicates(files, target)
+}
+
+func hashSection(fn string, offset, length int64, alg inventory.HashAlgorithm) (string, error) {
+	f, err := os.Open(fn) // nolint:gosec
+	if err != nil {
+		return "", err
+	}
+	defer dclose(f)
+	return inventory.HashReader(io.NewSectionReader(f, offset, length), alg)
+}
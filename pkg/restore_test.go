@@ -0,0 +1,269 @@
+package porter
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestore(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(src, "sub", "dir"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(src, "top.txt"), []byte("top level"), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(src, "sub", "dir", "deep.txt"), []byte("deeper level"), 0o600))
+
+	for _, tt := range []struct {
+		format       string
+		encryptInner bool
+	}{
+		{format: "tar"},
+		{format: "tar.gz"},
+		{format: "tar.zst"},
+		{format: "tar.gz", encryptInner: true},
+		{format: "tar.gpg"},
+		{format: "tar.gz.gpg"},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+				inventory.WithDirectories([]string{src}),
+				inventory.WithSuitcaseFormat(tt.format),
+				inventory.WithMaxSuitcaseSize(12),
+			))
+			require.NoError(t, err)
+			i.Options.EncryptInner = tt.encryptInner
+			require.Equal(t, 2, i.TotalIndexes)
+
+			dest := t.TempDir()
+			p := New(
+				WithInventory(i),
+				WithDestination(dest),
+			)
+			p.SuitcaseOpts = &config.SuitCaseOpts{
+				Format:       tt.format,
+				EncryptInner: tt.encryptInner,
+				EncryptTo:    &openpgp.EntityList{pubKey},
+				DecryptWith:  privKeys,
+			}
+			for idx := 1; idx <= i.TotalIndexes; idx++ {
+				_, err := p.WriteSuitcaseFile(idx, nil)
+				require.NoError(t, err)
+			}
+
+			target := t.TempDir()
+			require.NoError(t, p.Restore(dest, target))
+			got, err := os.ReadFile(path.Join(target, "top.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "top level", string(got))
+			got, err = os.ReadFile(path.Join(target, "sub", "dir", "deep.txt"))
+			require.NoError(t, err)
+			require.Equal(t, "deeper level", string(got))
+			st, err := os.Stat(path.Join(target, "sub", "dir", "deep.txt"))
+			require.NoError(t, err)
+			require.Equal(t, os.FileMode(0o600), st.Mode().Perm())
+		})
+	}
+}
+
+func TestRestoreMissing(t *testing.T) {
+	p := New()
+	require.EqualError(t, p.Restore(t.TempDir(), t.TempDir()), "must have set Inventory")
+
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{"testdata/limit-dir"}),
+	))
+	require.NoError(t, err)
+	p = New(WithInventory(i))
+	require.EqualError(t, p.Restore(t.TempDir(), ""), "must set a target directory to restore in to")
+	require.Error(t, p.Restore(t.TempDir(), t.TempDir()))
+}
+
+func TestRestoreSplitFile(t *testing.T) {
+	src := t.TempDir()
+	big := []byte(strings.Repeat("abcdefghij", 3) + "xyz")
+	// Read only, so restoring later segments depends on the mode waiting until the end
+	require.NoError(t, os.WriteFile(path.Join(src, "big.dat"), big, 0o440))
+	require.NoError(t, os.WriteFile(path.Join(src, "small.txt"), []byte("small"), 0o644))
+	mtime := time.Date(2020, 2, 3, 4, 5, 6, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path.Join(src, "big.dat"), mtime, mtime))
+
+	for _, format := range []string{"tar", "tar.gz"} {
+		t.Run(format, func(t *testing.T) {
+			i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+				inventory.WithDirectories([]string{src}),
+				inventory.WithSuitcaseFormat(format),
+				inventory.WithMaxSuitcaseSize(10),
+				inventory.WithSplitLargeFiles(),
+			))
+			require.NoError(t, err)
+			require.Equal(t, 4, i.TotalIndexes)
+
+			dest := t.TempDir()
+			p := New(
+				WithInventory(i),
+				WithDestination(dest),
+			)
+			p.SuitcaseOpts = &config.SuitCaseOpts{Format: format}
+			for idx := 1; idx <= i.TotalIndexes; idx++ {
+				_, err := p.WriteSuitcaseFile(idx, nil)
+				require.NoError(t, err)
+			}
+
+			target := t.TempDir()
+			// Leftovers from an earlier restore should not survive
+			require.NoError(t, os.WriteFile(path.Join(target, "big.dat"), bytes.Repeat([]byte("!"), 100), 0o600))
+			require.NoError(t, p.Restore(dest, target))
+			got, err := os.ReadFile(path.Join(target, "big.dat"))
+			require.NoError(t, err)
+			require.Equal(t, big, got)
+			st, err := os.Stat(path.Join(target, "big.dat"))
+			require.NoError(t, err)
+			require.True(t, mtime.Equal(st.ModTime()))
+			require.Equal(t, os.FileMode(0o440), st.Mode().Perm())
+
+			retrieved := t.TempDir()
+			names, err := p.Retrieve(dest, "big.dat", retrieved)
+			require.NoError(t, err)
+			require.Equal(t, []string{"big.dat"}, names)
+			got, err = os.ReadFile(path.Join(retrieved, "big.dat"))
+			require.NoError(t, err)
+			require.Equal(t, big, got)
+
+			// Tampered segments are caught
+			for _, f := range i.Files {
+				if f.Segment != nil && f.Segment.Index == 2 {
+					f.Segment.Hash = "bad"
+				}
+			}
+			require.ErrorContains(t, p.Restore(dest, t.TempDir()), "segment 2 of big.dat does not match")
+		})
+	}
+}
+
+func TestRestoreDuplicates(t *testing.T) {
+	src := t.TempDir()
+	cal := []byte(strings.Repeat("calibration", 10))
+	for _, fn := range []string{"run1/cal.dat", "run2/cal.dat", "run3/cal.dat"} {
+		require.NoError(t, os.MkdirAll(path.Join(src, path.Dir(fn)), 0o755))
+		require.NoError(t, os.WriteFile(path.Join(src, fn), cal, 0o640))
+	}
+	require.NoError(t, os.WriteFile(path.Join(src, "other.txt"), []byte("other"), 0o644))
+
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar"),
+		inventory.WithMaxSuitcaseSize(120),
+		inventory.WithDedup(),
+	))
+	require.NoError(t, err)
+	require.Equal(t, uint(2), i.Analyze().DuplicateCount)
+
+	dest := t.TempDir()
+	p := New(
+		WithInventory(i),
+		WithDestination(dest),
+	)
+	p.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar"}
+	for idx := 1; idx <= i.TotalIndexes; idx++ {
+		_, err := p.WriteSuitcaseFile(idx, nil)
+		require.NoError(t, err)
+	}
+
+	target := t.TempDir()
+	require.NoError(t, p.Restore(dest, target))
+	for _, fn := range []string{"run1/cal.dat", "run2/cal.dat", "run3/cal.dat"} {
+		got, err := os.ReadFile(path.Join(target, fn))
+		require.NoError(t, err)
+		require.Equal(t, cal, got, fn)
+		st, err := os.Stat(path.Join(target, fn))
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o640), st.Mode().Perm(), fn)
+	}
+
+	// Retrieving a duplicate pulls in the file holding its content
+	var dup string
+	for _, f := range i.Files {
+		if f.DuplicateOf != "" {
+			dup = f.Destination
+			break
+		}
+	}
+	retrieved := t.TempDir()
+	_, err = p.Retrieve(dest, dup, retrieved)
+	require.NoError(t, err)
+	got, err := os.ReadFile(path.Join(retrieved, dup))
+	require.NoError(t, err)
+	require.Equal(t, cal, got)
+}
+
+func TestRestoreIncremental(t *testing.T) {
+	src := t.TempDir()
+	for _, fn := range []string{"static.txt", "changes.txt"} {
+		require.NoError(t, os.WriteFile(path.Join(src, fn), []byte("original"), 0o644))
+	}
+	dest := t.TempDir()
+	writeSuitcases := func(i *inventory.Inventory) {
+		p := New(WithInventory(i), WithDestination(dest))
+		p.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar"}
+		for idx := 1; idx <= i.TotalIndexes; idx++ {
+			_, err := p.WriteSuitcaseFile(idx, nil)
+			require.NoError(t, err)
+		}
+	}
+
+	first, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar"),
+		inventory.WithPrefix("first"),
+	))
+	require.NoError(t, err)
+	writeSuitcases(first)
+	prevFn := path.Join(t.TempDir(), "inventory.yaml")
+	f, err := os.Create(prevFn)
+	require.NoError(t, err)
+	require.NoError(t, (&inventory.VAMLer{}).Write(f, first))
+	require.NoError(t, f.Close())
+
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.WriteFile(path.Join(src, "changes.txt"), []byte("changed"), 0o644))
+	require.NoError(t, os.Chtimes(path.Join(src, "changes.txt"), later, later))
+	second, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar"),
+		inventory.WithPrefix("second"),
+		inventory.WithPreviousInventory(prevFn),
+	))
+	require.NoError(t, err)
+	require.Equal(t, 1, len(second.Delta.Unchanged))
+	writeSuitcases(second)
+
+	// The unchanged file comes out of the first suitcase, without the old
+	// version of the changed one that is in there too
+	p := New(WithInventory(second))
+	target := t.TempDir()
+	require.NoError(t, p.Restore(dest, target))
+	for fn, expect := range map[string]string{"static.txt": "original", "changes.txt": "changed"} {
+		got, err := os.ReadFile(path.Join(target, fn))
+		require.NoError(t, err)
+		require.Equal(t, expect, string(got), fn)
+	}
+
+	retrieved := t.TempDir()
+	got, err := p.Retrieve(dest, "static.txt", retrieved)
+	require.NoError(t, err)
+	require.Equal(t, []string{"static.txt"}, got)
+	require.FileExists(t, path.Join(retrieved, "static.txt"))
+}
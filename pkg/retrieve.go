@@ -0,0 +1,189 @@
+package porter
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/rclone"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase"
+)
+
+// Retrieve restores only the files in the inventory matching glob underneath
+// target. Only the suitcases holding those files are opened, and they are
+// pulled from source, which may be a local directory or an rclone remote
+// (such as a transporter destination)
+func (p *Porter) Retrieve(source, glob, target string) ([]string, error) {
+	if p.Inventory == nil {
+		return nil, errors.New("must have set Inventory")
+	}
+	if target == "" {
+		return nil, errors.New("must set a target directory to restore in to")
+	}
+	files, err := p.Inventory.FilesMatchingGlob(glob)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files in the inventory match %v", glob)
+	}
+	if files, err = p.withReferencedFiles(files); err != nil {
+		return nil, err
+	}
+
+	// Group up the wanted files by the suitcase they live in
+	wanted := map[string][]string{}
+	for _, f := range files {
+		name := p.Inventory.SuitcaseNameForFile(f)
+		wanted[name] = append(wanted[name], f.Destination)
+	}
+	suitcases := make([]string, 0, len(wanted))
+	for name := range wanted {
+		suitcases = append(suitcases, name)
+	}
+	sort.Strings(suitcases)
+	p.Logger.Info("retrieving files", "file-count", len(files), "suitcases", suitcases)
+
+	if err := os.MkdirAll(target, 0o750); err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	ret := []string{}
+	pl := newPool(p.concurrency)
+	for _, name := range suitcases {
+		pl.Go(func() error {
+			got, err := p.retrieveFromSuitcase(source, name, target, wanted[name])
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			ret = append(ret, got...)
+			return nil
+		})
+	}
+	if err := pl.Wait(); err != nil {
+		return nil, err
+	}
+	sort.Strings(ret)
+	// Segments of a split file come back once from each of their suitcases
+	ret = slices.Compact(ret)
+
+	got := map[string]bool{}
+	for _, item := range ret {
+		got[item] = true
+	}
+	missing := []string{}
+	for _, f := range files {
+		if !got[f.Destination] {
+			missing = append(missing, f.Destination)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return ret, fmt.Errorf("the following files were not found in the suitcases: %v", strings.Join(slices.Compact(missing), ","))
+	}
+	if err := p.verifySegments(files, target); err != nil {
+		return nil, err
+	}
+	if err := restoreReferences(files, target); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// withReferencedFiles adds on the files that any hardlinks or duplicates in
+// files need to be restored from
+func (p *Porter) withReferencedFiles(files []*inventory.File) ([]*inventory.File, error) {
+	have := make(map[string]bool, len(files))
+	for _, f := range files {
+		have[f.Destination] = true
+	}
+	need := map[string]bool{}
+	for _, f := range files {
+		ref := f.DuplicateOf
+		if f.Type == inventory.HardlinkEntry {
+			ref = f.LinkTarget
+		}
+		if ref != "" && !have[ref] {
+			need[ref] = true
+		}
+	}
+	if len(need) == 0 {
+		return files, nil
+	}
+	err := p.Inventory.EachOfAllFiles(func(f *inventory.File) error {
+		if need[f.Destination] {
+			files = append(files, f)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// retrieveFromSuitcase fetches a single suitcase if needed, and streams out
+// only the named files
+func (p *Porter) retrieveFromSuitcase(source, name, target string, names []string) ([]string, error) {
+	fn, cleanup, err := fetchSuitcase(source, name)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	f, err := os.Open(fn) // nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(f)
+
+	r, err := suitcase.NewReader(f, p.readerOpts())
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(r)
+
+	got, err := suitcase.UnpackNames(r, target, names)
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve files from %v: %w", name, err)
+	}
+	p.Logger.Info("retrieved files from suitcase", "suitcase", name, "file-count", len(got))
+	return got, nil
+}
+
+// fetchSuitcase returns a local path to the named suitcase. Suitcases in a
+// local directory are used in place, anything else is treated as an rclone
+// remote and copied in to a temporary directory, which is removed by the
+// returned cleanup function
+func fetchSuitcase(source, name string) (string, func(), error) {
+	if isLocalDir(source) {
+		return path.Join(source, name), func() {}, nil
+	}
+	tmp, err := os.MkdirTemp("", "suitcase-retrieve")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() {
+		if err := os.RemoveAll(tmp); err != nil {
+			slog.Warn("could not remove temporary suitcase directory", "dir", tmp, "error", err)
+		}
+	}
+	remote := strings.TrimSuffix(source, "/") + "/" + name
+	if err := rclone.Copy(remote, tmp, nil); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("could not fetch %v: %w", remote, err)
+	}
+	return path.Join(tmp, name), cleanup, nil
+}
+
+func isLocalDir(s string) bool {
+	st, err := os.Stat(s)
+	return err == nil && st.IsDir()
+}
@@ -0,0 +1,51 @@
+package porter
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieve(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(src, "raw"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(src, "top.txt"), []byte("top level"), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(src, "raw", "one.dat"), []byte("one"), 0o644))
+	require.NoError(t, os.WriteFile(path.Join(src, "raw", "two.dat"), []byte("two"), 0o644))
+
+	i, err := inventory.NewDirectoryInventory(inventory.NewOptions(
+		inventory.WithDirectories([]string{src}),
+		inventory.WithSuitcaseFormat("tar.gz"),
+		inventory.WithMaxSuitcaseSize(10),
+	))
+	require.NoError(t, err)
+
+	dest := t.TempDir()
+	p := New(
+		WithInventory(i),
+		WithDestination(dest),
+	)
+	p.SuitcaseOpts = &config.SuitCaseOpts{Format: "tar.gz"}
+	for idx := 1; idx <= i.TotalIndexes; idx++ {
+		_, err := p.WriteSuitcaseFile(idx, nil)
+		require.NoError(t, err)
+	}
+
+	target := t.TempDir()
+	got, err := p.Retrieve(dest, "raw/*.dat", target)
+	require.NoError(t, err)
+	require.Equal(t, []string{"raw/one.dat", "raw/two.dat"}, got)
+	require.FileExists(t, path.Join(target, "raw", "one.dat"))
+	require.FileExists(t, path.Join(target, "raw", "two.dat"))
+	require.NoFileExists(t, path.Join(target, "top.txt"))
+
+	_, err = p.Retrieve(dest, "nope-*", target)
+	require.EqualError(t, err, "no files in the inventory match nope-*")
+
+	_, err = p.Retrieve(t.TempDir(), "top.txt", target)
+	require.Error(t, err)
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package suitcase
+
+import (
+	"fmt"
+
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
+)
+
+// mknod can't make special files on this platform
+func mknod(target string, _ *tar.Header) error {
+	return fmt.Errorf("special files are not supported on this platform: %v", target)
+}
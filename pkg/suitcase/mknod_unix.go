@@ -0,0 +1,24 @@
+//go:build unix
+
+package suitcase
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
+)
+
+// mknod makes the FIFO or device file described by header at target
+func mknod(target string, header *tar.Header) error {
+	mode := uint32(header.Mode & 0o7777) // nolint:gosec
+	switch header.Typeflag {
+	case tar.TypeFifo:
+		mode |= unix.S_IFIFO
+	case tar.TypeChar:
+		mode |= unix.S_IFCHR
+	case tar.TypeBlock:
+		mode |= unix.S_IFBLK
+	}
+	dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor)) // nolint:gosec
+	return unix.Mknod(target, mode, int(dev))                           // nolint:gosec
+}
@@ -0,0 +1,164 @@
+/*
+Package registry keeps track of the suitcase formats that can be written and
+read. Each format package registers itself when it is imported, so importing
+the suitcase package makes every format available
+*/
+package registry
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+// Format identifies a suitcase format, such as tar, tar.gz, etc
+type Format int
+
+const (
+	// NullFormat is the unset value for this type
+	NullFormat Format = iota
+	// TarFormat is for tar
+	TarFormat
+	// TarGzFormat is for tar.gz
+	TarGzFormat
+	// TarGzGpgFormat is for encrypted tar.gz (tar.gz.gpg)
+	TarGzGpgFormat
+	// TarGpgFormat is for encrypted tar.gz (tar.gpg)
+	TarGpgFormat
+	// TarZstFormat uses the zstd compression engine (tar.zst)
+	TarZstFormat
+	// TarZstGpgFormat uses the zstd compression engine with Gpg (tar.zst.gpg)
+	TarZstGpgFormat
+	// TarBz2Format uses the bzip2 compression engine (tar.bz2)
+	TarBz2Format
+	// ZipFormat is for zip, for anyone without tar tooling
+	ZipFormat
+	// ZipAESFormat is for zip with every member encrypted by a password (aes.zip)
+	ZipAESFormat
+	// TarLz4Format uses the lz4 compression engine (tar.lz4)
+	TarLz4Format
+	// TarLz4GpgFormat uses the lz4 compression engine with Gpg (tar.lz4.gpg)
+	TarLz4GpgFormat
+	// TarS2Format uses the s2 compression engine (tar.s2)
+	TarS2Format
+	// TarS2GpgFormat uses the s2 compression engine with Gpg (tar.s2.gpg)
+	TarS2GpgFormat
+	// TarXzFormat uses the xz compression engine (tar.xz)
+	TarXzFormat
+	// TarXzGpgFormat uses the xz compression engine with Gpg (tar.xz.gpg)
+	TarXzGpgFormat
+)
+
+// Writer is what every format writes a suitcase with
+type Writer interface {
+	Close() error
+	Add(inventory.File) (*config.HashSet, error)
+	AddEncrypt(f inventory.File) error
+	Config() *config.SuitCaseOpts
+}
+
+// Reader is what every format reads a suitcase back out with
+type Reader interface {
+	Close() error
+	Next() (*tar.Header, io.Reader, error)
+	Config() *config.SuitCaseOpts
+}
+
+// Entry is everything needed to write and read a single suitcase format
+type Entry struct {
+	Format    Format
+	Name      string
+	NewWriter func(w io.Writer, opts *config.SuitCaseOpts) (Writer, error)
+	NewReader func(r io.Reader, opts *config.SuitCaseOpts) (Reader, error)
+}
+
+var (
+	mu      sync.RWMutex
+	entries = map[string]Entry{}
+)
+
+// Register makes a suitcase format available. Registering the same name or
+// Format twice panics
+func Register(e Entry) {
+	mu.Lock()
+	defer mu.Unlock()
+	if e.Name == "" || e.Format == NullFormat {
+		panic("suitcase formats must have a name and a Format")
+	}
+	for _, existing := range entries {
+		if existing.Name == e.Name || existing.Format == e.Format {
+			panic(fmt.Sprintf("suitcase format registered twice: %v", e.Name))
+		}
+	}
+	entries[e.Name] = e
+}
+
+// Lookup returns the registered format with the given name
+func Lookup(name string) (Entry, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := entries[name]
+	return e, ok
+}
+
+// Names returns the names of every registered format, sorted
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	ret := make([]string, 0, len(entries))
+	for name := range entries {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// Validate returns an error if name is not a registered format
+func Validate(name string) error {
+	if _, ok := Lookup(name); !ok {
+		return fmt.Errorf("invalid archive format: %s", name)
+	}
+	return nil
+}
+
+func (f Format) String() string {
+	if f == NullFormat {
+		return ""
+	}
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, e := range entries {
+		if e.Format == f {
+			return e.Name
+		}
+	}
+	panic("invalid format")
+}
+
+// Type satisfies part of the pflags.Value interface
+func (f Format) Type() string {
+	return "Format"
+}
+
+// Set helps fulfill the pflag.Value interface
+func (f *Format) Set(v string) error {
+	if v == "" {
+		*f = NullFormat
+		return nil
+	}
+	if e, ok := Lookup(v); ok {
+		*f = e.Format
+		return nil
+	}
+	return fmt.Errorf("ProductionLevel should be one of: %v", Names())
+}
+
+// MarshalJSON ensures that json conversions use the string value here, not the int value
+func (f *Format) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf("\"%v\"", f.String())), nil
+}
@@ -10,55 +10,72 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"os"
 	"path"
-	"sort"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"github.com/pkg/xattr"
 	"github.com/spf13/cobra"
 	"github.com/scttfrdmn/cargoship/pkg/config"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
-	"github.com/scttfrdmn/cargoship/pkg/suitcase/tarbz2"
-	"github.com/scttfrdmn/cargoship/pkg/suitcase/targpg"
-	"github.com/scttfrdmn/cargoship/pkg/suitcase/targz"
-	"github.com/scttfrdmn/cargoship/pkg/suitcase/targzgpg"
-	"github.com/scttfrdmn/cargoship/pkg/suitcase/tarzstd"
+
+	// Formats register themselves with the registry
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/tarbz2"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/tarcompress"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/targpg"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/targz"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/targzgpg"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/tarzstd"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/tarzstdgpg"
+	_ "github.com/scttfrdmn/cargoship/pkg/suitcase/zip"
 )
 
-// Format is the format the inventory will use, such as yaml, json, etc
-type Format int
+// Format is the format the suitcase will use, such as tar, tar.gz, etc
+type Format = registry.Format
 
 const (
 	// NullFormat is the unset value for this type
-	NullFormat = iota
+	NullFormat = registry.NullFormat
 	// TarFormat is for tar
-	TarFormat
+	TarFormat = registry.TarFormat
 	// TarGzFormat is for tar.gz
-	TarGzFormat
+	TarGzFormat = registry.TarGzFormat
 	// TarGzGpgFormat is for encrypted tar.gz (tar.gz.gpg)
-	TarGzGpgFormat
+	TarGzGpgFormat = registry.TarGzGpgFormat
 	// TarGpgFormat is for encrypted tar.gz (tar.gpg)
-	TarGpgFormat
+	TarGpgFormat = registry.TarGpgFormat
 	// TarZstFormat uses the zstd compression engine (tar.zst)
-	TarZstFormat
+	TarZstFormat = registry.TarZstFormat
 	// TarZstGpgFormat uses the zstd compression engine with Gpg (tar.zst.gpg)
-	TarZstGpgFormat
+	TarZstGpgFormat = registry.TarZstGpgFormat
+	// TarBz2Format uses the bzip2 compression engine (tar.bz2)
+	TarBz2Format = registry.TarBz2Format
+	// ZipFormat is for zip
+	ZipFormat = registry.ZipFormat
+	// ZipAESFormat is for zip encrypted with a password (aes.zip)
+	ZipAESFormat = registry.ZipAESFormat
+	// TarLz4Format uses the lz4 compression engine (tar.lz4)
+	TarLz4Format = registry.TarLz4Format
+	// TarLz4GpgFormat uses the lz4 compression engine with Gpg (tar.lz4.gpg)
+	TarLz4GpgFormat = registry.TarLz4GpgFormat
+	// TarS2Format uses the s2 compression engine (tar.s2)
+	TarS2Format = registry.TarS2Format
+	// TarS2GpgFormat uses the s2 compression engine with Gpg (tar.s2.gpg)
+	TarS2GpgFormat = registry.TarS2GpgFormat
+	// TarXzFormat uses the xz compression engine (tar.xz)
+	TarXzFormat = registry.TarXzFormat
+	// TarXzGpgFormat uses the xz compression engine with Gpg (tar.xz.gpg)
+	TarXzGpgFormat = registry.TarXzGpgFormat
 )
 
-var formatMap = map[string]Format{
-	"tar":         TarFormat,
-	"tar.gpg":     TarGpgFormat,
-	"tar.gz":      TarGzFormat,
-	"tar.gz.gpg":  TarGzGpgFormat,
-	"tar.zst":     TarZstFormat,
-	"tar.zst.gpg": TarZstGpgFormat,
-	"":            NullFormat,
-}
-
 // FormatCompletion returns shell completion
 func FormatCompletion(_ *cobra.Command, _ []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 	ret := []string{}
-	for _, item := range nonEmptyKeys(formatMap) {
+	for _, item := range registry.Names() {
 		if strings.Contains(item, toComplete) {
 			ret = append(ret, item)
 		}
@@ -66,43 +83,21 @@ func FormatCompletion(_ *cobra.Command, _ []string, toComplete string) ([]string
 	return ret, cobra.ShellCompDirectiveNoFileComp
 }
 
-func (f Format) String() string {
-	m := reverseMap(formatMap)
-	if v, ok := m[f]; ok {
-		return v
-	}
-	panic("invalid format")
-}
-
-// Type satisfies part of the pflags.Value interface
-func (f Format) Type() string {
-	return "Format"
-}
-
-// Set helps fulfill the pflag.Value interface
-func (f *Format) Set(v string) error {
-	if v, ok := formatMap[v]; ok {
-		*f = v
-		return nil
-	}
-	return fmt.Errorf("ProductionLevel should be one of: %v", nonEmptyKeys(formatMap))
-}
-
-// MarshalJSON ensures that json conversions use the string value here, not the int value
-func (f *Format) MarshalJSON() ([]byte, error) {
-	return []byte(fmt.Sprintf("\"%v\"", f.String())), nil
+// ValidateFormat returns an error if there is no suitcase format with the
+// given name
+func ValidateFormat(name string) error {
+	return registry.Validate(name)
 }
 
 // Suitcase is the interface that describes what a Suitcase does
-type Suitcase interface {
-	Close() error
-	Add(inventory.File) (*config.HashSet, error)
-	AddEncrypt(f inventory.File) error
-	Config() *config.SuitCaseOpts
-}
+type Suitcase = registry.Writer
 
 // New Create a new suitcase
 func New(w io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
+	e, ok := registry.Lookup(opts.Format)
+	if !ok {
+		return nil, fmt.Errorf("invalid archive format: %s", opts.Format)
+	}
 	// Decide if we are encrypting the whole shebang or not
 	if strings.HasSuffix(opts.Format, ".gpg") {
 		opts.EncryptOuter = true
@@ -115,21 +110,455 @@ func New(w io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
 	if (opts.EncryptInner || opts.EncryptOuter) && opts.EncryptTo == nil {
 		return nil, fmt.Errorf("cannot encrypt without EncryptTo")
 	}
-	switch opts.Format {
-	case "tar":
-		return tar.New(w, opts), nil
-	case "tar.gpg":
-		return targpg.New(w, opts), nil
-	case "tar.gz":
-		return targz.New(w, opts), nil
-	case "tar.gz.gpg":
-		return targzgpg.New(w, opts), nil
-	case "tar.zst":
-		return tarzstd.New(w, opts), nil
-	case "tar.bz2":
-		return tarbz2.New(w, opts), nil
+	return e.NewWriter(w, opts)
+}
+
+// Reader is the interface that describes how a Suitcase is read back out
+type Reader = registry.Reader
+
+// NewReader opens an existing suitcase for reading
+func NewReader(r io.Reader, opts *config.SuitCaseOpts) (Reader, error) {
+	e, ok := registry.Lookup(opts.Format)
+	if !ok {
+		return nil, fmt.Errorf("invalid archive format: %s", opts.Format)
+	}
+	// Decide if the whole shebang was encrypted or not
+	if strings.HasSuffix(opts.Format, ".gpg") {
+		opts.EncryptOuter = true
+	}
+	if opts.EncryptInner && opts.EncryptOuter {
+		return nil, fmt.Errorf("cannot decrypt inner and outer")
+	}
+	// If we are decrypting something, be sure decryptWith is set
+	if (opts.EncryptInner || opts.EncryptOuter) && opts.DecryptWith == nil {
+		return nil, fmt.Errorf("cannot decrypt without DecryptWith")
+	}
+	return e.NewReader(r, opts)
+}
+
+// Unpack writes every file in a suitcase out underneath dest, returning the
+// archive names that were written
+func Unpack(r Reader, dest string) ([]string, error) {
+	var ret []string
+	for {
+		header, content, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := unpackEntry(header, content, dest); err != nil {
+			return nil, err
+		}
+		ret = append(ret, header.Name)
+	}
+	return ret, nil
+}
+
+// UnpackNames streams through a suitcase, writing out only the entries whose
+// names are in names. Reading stops as soon as every requested name has been
+// found, so the rest of the suitcase is never decompressed
+func UnpackNames(r Reader, dest string, names []string) ([]string, error) {
+	want := make(map[string]bool, len(names))
+	for _, name := range names {
+		want[name] = true
+	}
+	var ret []string
+	for len(want) > 0 {
+		header, content, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !want[header.Name] {
+			continue
+		}
+		if err := unpackEntry(header, content, dest); err != nil {
+			return nil, err
+		}
+		delete(want, header.Name)
+		ret = append(ret, header.Name)
+	}
+	return ret, nil
+}
+
+// unpackEntry writes a single suitcase entry underneath dest, applying the
+// mode and modification time from the header
+func unpackEntry(header *tar.Header, content io.Reader, dest string) error {
+	target, err := safeJoin(dest, header.Name)
+	if err != nil {
+		return err
+	}
+	slog.Debug("restoring file", "name", header.Name, "target", target)
+	if header.Typeflag == tar.TypeDir {
+		if err := removeSymlink(target); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(target, 0o750); err != nil {
+			return err
+		}
+		return restoreMetadata(target, header)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	if canonical, ok := header.PAXRecords[tar.DuplicateOfPAXRecord]; ok {
+		// The canonical file may still be on its way out of another suitcase
+		slog.Debug("leaving duplicate for CopyDuplicates", "file", target, "duplicate-of", canonical)
+		return nil
+	}
+	switch header.Typeflag {
+	case tar.TypeSymlink:
+		return restoreSymlink(target, header)
+	case tar.TypeLink:
+		return restoreHardlink(dest, target, header)
+	case tar.TypeFifo, tar.TypeChar, tar.TypeBlock:
+		return restoreSpecial(target, header)
+	}
+	offset, totalSize, isSegment, err := segmentFromHeader(header)
+	if err != nil {
+		return err
+	}
+	flags := os.O_CREATE | os.O_TRUNC | os.O_WRONLY
+	perm := header.FileInfo().Mode().Perm()
+	if isSegment {
+		// Other segments of the same file may be written at the same time,
+		// and they all need to be able to open it, so the real mode waits for
+		// RestoreSegmentedMetadata
+		flags = os.O_CREATE | os.O_WRONLY
+		perm |= 0o200
+	}
+	if err := removeSymlink(target); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(target, flags, perm) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	if isSegment {
+		if err := placeSegment(f, offset, totalSize); err != nil {
+			dclose(f)
+			return err
+		}
+	}
+	if _, err := io.Copy(f, content); err != nil { // nolint:gosec
+		dclose(f)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if isSegment {
+		return nil
+	}
+	return restoreMetadata(target, header)
+}
+
+// restoreSymlink recreates a symlink, replacing anything already at target.
+// Only the ownership of the link itself can be set
+func restoreSymlink(target string, header *tar.Header) error {
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	if err := os.Symlink(header.Linkname, target); err != nil {
+		return err
+	}
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+		slog.Debug("could not restore ownership", "file", target, "uid", header.Uid, "gid", header.Gid, "error", err)
+	}
+	return nil
+}
+
+// restoreHardlink links target to the file it was a hardlink of. That file
+// may live in a different suitcase that hasn't been unpacked yet, in which case
+// the link is left for LinkHardlinks to make once everything is in place
+func restoreHardlink(dest, target string, header *tar.Header) error {
+	source, err := safeJoin(dest, header.Linkname)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(source); err != nil {
+		slog.Debug("hardlink source not restored yet", "file", target, "source", source)
+		return nil
+	}
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	return os.Link(source, target)
+}
+
+// LinkHardlinks makes any of the hardlinks in files that couldn't be made while
+// unpacking, because the file they link to was in another suitcase
+func LinkHardlinks(files []*inventory.File, dest string) error {
+	for _, f := range files {
+		if f.Type != inventory.HardlinkEntry {
+			continue
+		}
+		target, err := safeJoin(dest, f.Destination)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Lstat(target); err == nil {
+			continue
+		}
+		source, err := safeJoin(dest, f.LinkTarget)
+		if err != nil {
+			return err
+		}
+		if err := os.Link(source, target); err != nil {
+			return fmt.Errorf("could not link %v to %v: %w", f.Destination, f.LinkTarget, err)
+		}
+	}
+	return nil
+}
+
+// CopyDuplicates writes out every duplicate in files as a copy of the file it
+// has the same content as, which must already be restored underneath dest
+func CopyDuplicates(files []*inventory.File, dest string) error {
+	for _, f := range files {
+		if f.DuplicateOf == "" {
+			continue
+		}
+		target, err := safeJoin(dest, f.Destination)
+		if err != nil {
+			return err
+		}
+		source, err := safeJoin(dest, f.DuplicateOf)
+		if err != nil {
+			return err
+		}
+		if err := copyDuplicate(source, target, f); err != nil {
+			return fmt.Errorf("could not copy %v to %v: %w", f.DuplicateOf, f.Destination, err)
+		}
+	}
+	return nil
+}
+
+func copyDuplicate(source, target string, f *inventory.File) error {
+	info, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%v is not a regular file", source)
+	}
+	src, err := os.Open(source) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	defer dclose(src)
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return err
+	}
+	perm := os.FileMode(0o640)
+	if f.Posix != nil {
+		perm = f.Posix.Mode.Perm()
+	}
+	if err := removeSymlink(target); err != nil {
+		return err
+	}
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm) // nolint:gosec
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dclose(dst)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	atime := f.ModTime
+	if f.Posix != nil {
+		if err := os.Lchown(target, f.Posix.UID, f.Posix.GID); err != nil {
+			slog.Debug("could not restore ownership", "file", target, "uid", f.Posix.UID, "gid", f.Posix.GID, "error", err)
+		}
+		if err := os.Chmod(target, f.Posix.Mode); err != nil {
+			return err
+		}
+		if !f.Posix.AccessTime.IsZero() {
+			atime = f.Posix.AccessTime
+		}
+	}
+	if f.ModTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(target, atime, f.ModTime)
+}
+
+// restoreSpecial recreates a FIFO or device file. Only privileged users can
+// make devices, so failing to is logged instead of returned
+func restoreSpecial(target string, header *tar.Header) error {
+	if err := removeExisting(target); err != nil {
+		return err
+	}
+	if err := mknod(target, header); err != nil {
+		if header.Typeflag == tar.TypeFifo {
+			return err
+		}
+		slog.Warn("could not restore device", "file", target, "error", err)
+		return nil
+	}
+	return restoreMetadata(target, header)
+}
+
+// removeExisting clears out whatever is at target, so it can be replaced
+func removeExisting(target string) error {
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// removeSymlink clears a symlink out of the way of target, so that writing a
+// file or directory there can't follow it somewhere else
+func removeSymlink(target string) error {
+	info, err := os.Lstat(target)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return nil
+	}
+	return os.Remove(target)
+}
+
+// segmentFromHeader returns where a segment of a large file belongs, if the
+// header is for a segment
+func segmentFromHeader(header *tar.Header) (int64, int64, bool, error) {
+	o, ok := header.PAXRecords[tar.SegmentOffsetPAXRecord]
+	if !ok {
+		return 0, 0, false, nil
+	}
+	offset, err := strconv.ParseInt(o, 10, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid segment offset for %v: %w", header.Name, err)
+	}
+	totalSize, err := strconv.ParseInt(header.PAXRecords[tar.SegmentTotalSizePAXRecord], 10, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("invalid segment total size for %v: %w", header.Name, err)
+	}
+	return offset, totalSize, true, nil
+}
+
+// placeSegment sizes f to match the whole file, dropping anything left over
+// from an earlier restore, and seeks to where the segment goes
+func placeSegment(f *os.File, offset, totalSize int64) error {
+	if err := f.Truncate(totalSize); err != nil {
+		return err
+	}
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
+
+// restoreMetadata reapplies the ownership, mode, extended attributes and
+// timestamps recorded in header. Ownership can only be given away by a
+// privileged user, and not every filesystem supports xattrs, so failures
+// there are logged instead of returned
+func restoreMetadata(target string, header *tar.Header) error {
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+		slog.Debug("could not restore ownership", "file", target, "uid", header.Uid, "gid", header.Gid, "error", err)
+	}
+	// Chown can clear setuid and friends, so mode comes after
+	if err := os.Chmod(target, header.FileInfo().Mode()); err != nil {
+		return err
+	}
+	for k, v := range header.PAXRecords {
+		name, ok := strings.CutPrefix(k, tar.XattrPAXPrefix)
+		if !ok {
+			continue
+		}
+		if err := xattr.LSet(target, name, []byte(v)); err != nil {
+			slog.Warn("could not restore xattr", "file", target, "xattr", name, "error", err)
+		}
+	}
+	atime := header.AccessTime
+	if atime.IsZero() {
+		atime = header.ModTime
+	}
+	return os.Chtimes(target, atime, header.ModTime)
+}
+
+// RestoreSegmentedMetadata applies the ownership, extended attributes, mode
+// and timestamps of a file put back together from segments. Unpack leaves
+// these off while segments are written, so call this once the file is whole.
+// Files from inventories without a segment mode keep the owner write bit
+func RestoreSegmentedMetadata(target string, f *inventory.File) error {
+	var mode os.FileMode
+	if f.Segment != nil {
+		mode = f.Segment.Mode
+	}
+	atime := f.ModTime
+	if f.Posix != nil {
+		if err := os.Lchown(target, f.Posix.UID, f.Posix.GID); err != nil {
+			slog.Debug("could not restore ownership", "file", target, "uid", f.Posix.UID, "gid", f.Posix.GID, "error", err)
+		}
+		for name, v := range f.Posix.Xattrs {
+			if err := xattr.LSet(target, name, v); err != nil {
+				slog.Warn("could not restore xattr", "file", target, "xattr", name, "error", err)
+			}
+		}
+		if mode == 0 {
+			mode = f.Posix.Mode
+		}
+		if !f.Posix.AccessTime.IsZero() {
+			atime = f.Posix.AccessTime
+		}
+	}
+	// Chown can clear setuid and friends, so mode comes after
+	if mode != 0 {
+		if err := os.Chmod(target, mode); err != nil {
+			return err
+		}
+	}
+	if f.ModTime.IsZero() {
+		return nil
+	}
+	return os.Chtimes(target, atime, f.ModTime)
+}
+
+// safeJoin joins name on to dest, refusing anything that would land outside of
+// dest. That includes going through a directory that is really a symlink, since
+// one restored earlier in the same suitcase could point anywhere
+func safeJoin(dest, name string) (string, error) {
+	target := filepath.Join(dest, filepath.FromSlash(name))
+	rel, err := filepath.Rel(dest, target)
+	if err != nil {
+		return "", err
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("refusing to restore %v outside of %v", name, dest)
+	}
+	dir := dest
+	for _, part := range strings.Split(filepath.Dir(rel), string(filepath.Separator)) {
+		if part == "." {
+			continue
+		}
+		dir = filepath.Join(dir, part)
+		info, err := os.Lstat(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to restore %v through symlink %v", name, dir)
+		}
+	}
+	return target, nil
+}
+
+func dclose(c io.Closer) {
+	if err := c.Close(); err != nil {
+		slog.Warn("error closing file", "error", err)
 	}
-	return nil, fmt.Errorf("invalid archive format: %s", opts.Format)
 }
 
 // validateSuitcase checks a suitcase file against an inventory, and ensures it is up to date
@@ -164,27 +593,6 @@ func inProcessName(s string) string {
 	return path.Join(path.Dir(s), fmt.Sprintf(".__creating-%v", path.Base(s)))
 }
 
-// nonEmptyKeys returns the non-empty keys of a map in an array
-func nonEmptyKeys[V any](m map[string]V) []string {
-	var ret []string
-	for k := range m {
-		if k != "" {
-			ret = append(ret, k)
-		}
-	}
-	sort.Strings(ret)
-	return ret
-}
-
-// reverseMap takes a map[k]v and returns a map[v]k
-func reverseMap[K string, V string | Format](m map[K]V) map[V]K {
-	ret := make(map[V]K, len(m))
-	for k, v := range m {
-		ret[v] = k
-	}
-	return ret
-}
-
 func mustHexToBin(s string) string {
 	got, err := hexToBin(s)
 	if err != nil {
@@ -201,6 +609,11 @@ func hexToBin(s string) (string, error) {
 	return base64.StdEncoding.EncodeToString(data), nil
 }
 
+// HashAlgorithms returns the algorithms used for inner hashes with opts
+func HashAlgorithms(opts *config.SuitCaseOpts) ([]inventory.HashAlgorithm, error) {
+	return tar.HashAlgorithms(opts)
+}
+
 // WriteHashFileBin  writes out the hashset array to an io.Writer
 func WriteHashFileBin(hs []config.HashSet, o io.Writer) error {
 	w := bufio.NewWriter(o)
@@ -1,11 +1,15 @@
 package suitcase
 
 import (
+	"archive/tar"
 	"bytes"
 	"io"
 	"os"
 	"path"
+	"path/filepath"
+	"syscall"
 	"testing"
+	"time"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/spf13/cobra"
@@ -86,7 +90,7 @@ func TestNewGPGSuitcase(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	for _, format := range []string{"tar.gpg", "tar.gz.gpg"} {
+	for _, format := range []string{"tar.gpg", "tar.gz.gpg", "tar.zst.gpg"} {
 		t.Run(format, func(t *testing.T) {
 			archive, err := New(io.Discard, &config.SuitCaseOpts{
 				Format:    format,
@@ -232,6 +236,52 @@ func TestFormatComplete(t *testing.T) {
 	require.NotContains(t, got, "tar.gz")
 }
 
+// Every format that can be picked should write suitcases that read back out
+func TestRegisteredFormats(t *testing.T) {
+	got, _ := FormatCompletion(&cobra.Command{}, []string{}, "")
+	require.Equal(t, []string{
+		"aes.zip", "tar", "tar.bz2", "tar.gpg", "tar.gz", "tar.gz.gpg", "tar.lz4", "tar.lz4.gpg",
+		"tar.s2", "tar.s2.gpg", "tar.xz", "tar.xz.gpg", "tar.zst", "tar.zst.gpg", "zip",
+	}, got)
+
+	pubKey, err := gpg.ReadEntity("../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	for _, format := range got {
+		require.NoError(t, ValidateFormat(format))
+		var f Format
+		require.NoError(t, f.Set(format))
+		require.Equal(t, format, f.String())
+
+		var buf bytes.Buffer
+		archive, err := New(&buf, &config.SuitCaseOpts{
+			Format:    format,
+			EncryptTo: &openpgp.EntityList{pubKey},
+			Password:  "s3cret",
+		})
+		require.NoError(t, err, format)
+		_, err = archive.Add(inventory.File{
+			Path:        "../testdata/name.txt",
+			Destination: "some/dir/name.txt",
+		})
+		require.NoError(t, err, format)
+		require.NoError(t, archive.Close(), format)
+
+		r, err := NewReader(&buf, &config.SuitCaseOpts{
+			Format:      format,
+			DecryptWith: privKeys,
+			Password:    "s3cret",
+		})
+		require.NoError(t, err, format)
+		header, _, err := r.Next()
+		require.NoError(t, err, format)
+		require.Equal(t, "some/dir/name.txt", header.Name, format)
+		require.NoError(t, r.Close(), format)
+	}
+	require.EqualError(t, ValidateFormat("tar.7z"), "invalid archive format: tar.7z")
+}
+
 func TestWriteHashfileBin(t *testing.T) {
 	buf := bytes.Buffer{}
 	err := WriteHashFileBin([]config.HashSet{
@@ -272,7 +322,7 @@ func TestFormatStrings(t *testing.T) {
 	require.Equal(
 		t,
 		"tar",
-		formatMap["tar"].String(),
+		TarFormat.String(),
 	)
 }
 
@@ -296,6 +346,40 @@ func TestValidateSuitcaseInvalid(t *testing.T) {
 	require.False(t, validateSuitcase("../testdata/validations/incomplete/suitcase-joebob-01-of-01.tar.zst", i, 1))
 }
 
+func TestValidateSuitcaseZip(t *testing.T) {
+	i := inventory.Inventory{
+		Files: []*inventory.File{
+			{Path: "../testdata/name.txt", Destination: "some/dir/name.txt", SuitcaseIndex: 1, Type: inventory.RegularEntry},
+			{Path: "../testdata/name.txt", Destination: "other/name.txt", SuitcaseIndex: 1, Type: inventory.RegularEntry},
+			{Path: "../testdata/name.txt", Destination: "elsewhere.txt", SuitcaseIndex: 2, Type: inventory.RegularEntry},
+		},
+	}
+	for _, format := range []string{"zip", "aes.zip"} {
+		fn := filepath.Join(t.TempDir(), "suitcase-joebob-01-of-02."+format)
+		f, err := os.Create(fn) // nolint:gosec
+		require.NoError(t, err)
+		archive, err := New(f, &config.SuitCaseOpts{Format: format, Password: "s3cret"})
+		require.NoError(t, err)
+		_, err = archive.Add(*i.Files[0])
+		require.NoError(t, err)
+		require.NoError(t, archive.Close())
+		require.NoError(t, f.Close())
+		require.False(t, validateSuitcase(fn, i, 1), format)
+
+		f, err = os.Create(fn) // nolint:gosec
+		require.NoError(t, err)
+		archive, err = New(f, &config.SuitCaseOpts{Format: format, Password: "s3cret"})
+		require.NoError(t, err)
+		for _, item := range i.Files[:2] {
+			_, err = archive.Add(*item)
+			require.NoError(t, err)
+		}
+		require.NoError(t, archive.Close())
+		require.NoError(t, f.Close())
+		require.True(t, validateSuitcase(fn, i, 1), format)
+	}
+}
+
 func TestInProcessName(t *testing.T) {
 	require.Equal(
 		t,
@@ -323,6 +407,12 @@ func TestFormatSet(t *testing.T) {
 		{"valid tar.gpg", "tar.gpg", TarGpgFormat, false},
 		{"valid tar.gz.gpg", "tar.gz.gpg", TarGzGpgFormat, false},
 		{"valid tar.zst.gpg", "tar.zst.gpg", TarZstGpgFormat, false},
+		{"valid tar.bz2", "tar.bz2", TarBz2Format, false},
+		{"valid zip", "zip", ZipFormat, false},
+		{"valid aes.zip", "aes.zip", ZipAESFormat, false},
+		{"valid tar.lz4", "tar.lz4", TarLz4Format, false},
+		{"valid tar.s2.gpg", "tar.s2.gpg", TarS2GpgFormat, false},
+		{"valid tar.xz", "tar.xz", TarXzFormat, false},
 		{"valid empty", "", NullFormat, false},
 		{"invalid value", "invalid", NullFormat, true},
 		{"case sensitive", "TAR", NullFormat, true},
@@ -357,6 +447,7 @@ func TestFormatMarshalJSON(t *testing.T) {
 		{"TarGpgFormat", TarGpgFormat, `"tar.gpg"`},
 		{"TarGzGpgFormat", TarGzGpgFormat, `"tar.gz.gpg"`},
 		{"TarZstGpgFormat", TarZstGpgFormat, `"tar.zst.gpg"`},
+		{"TarBz2Format", TarBz2Format, `"tar.bz2"`},
 		{"NullFormat", NullFormat, `""`},
 	}
 	
@@ -376,3 +467,190 @@ func TestFormatStringPanic(t *testing.T) {
 		_ = invalidFormat.String()
 	})
 }
+
+func TestNewReaderUnpack(t *testing.T) {
+	for _, format := range []string{"tar", "tar.gz", "tar.zst", "tar.bz2"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			archive, err := New(&buf, &config.SuitCaseOpts{
+				Format: format,
+			})
+			require.NoError(t, err)
+			_, err = archive.Add(inventory.File{
+				Path:        "../testdata/name.txt",
+				Destination: "some/dir/name.txt",
+			})
+			require.NoError(t, err)
+			require.NoError(t, archive.Close())
+
+			r, err := NewReader(&buf, &config.SuitCaseOpts{
+				Format: format,
+			})
+			require.NoError(t, err)
+			dest := t.TempDir()
+			got, err := Unpack(r, dest)
+			require.NoError(t, err)
+			require.NoError(t, r.Close())
+			require.Equal(t, []string{"some/dir/name.txt"}, got)
+			require.FileExists(t, path.Join(dest, "some/dir/name.txt"))
+		})
+	}
+
+	_, err := NewReader(bytes.NewReader(nil), &config.SuitCaseOpts{Format: "7z"})
+	require.EqualError(t, err, "invalid archive format: 7z")
+	_, err = NewReader(bytes.NewReader(nil), &config.SuitCaseOpts{Format: "tar.gpg"})
+	require.EqualError(t, err, "cannot decrypt without DecryptWith")
+}
+
+func TestSafeJoin(t *testing.T) {
+	got, err := safeJoin("/restore", "foo/bar.txt")
+	require.NoError(t, err)
+	require.Equal(t, "/restore/foo/bar.txt", got)
+
+	_, err = safeJoin("/restore", "../../etc/passwd")
+	require.EqualError(t, err, "refusing to restore ../../etc/passwd outside of /restore")
+}
+
+func TestUnpackRefusesSymlinkEscape(t *testing.T) {
+	outside := t.TempDir()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a", Typeflag: tar.TypeSymlink, Linkname: outside, Mode: 0o777}))
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "a/passwd", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4}))
+	_, err := tw.Write([]byte("evil"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	r, err := NewReader(&buf, &config.SuitCaseOpts{Format: "tar"})
+	require.NoError(t, err)
+	dest := t.TempDir()
+	_, err = Unpack(r, dest)
+	require.EqualError(t, err, "refusing to restore a/passwd through symlink "+path.Join(dest, "a"))
+	require.NoFileExists(t, path.Join(outside, "passwd"))
+
+	// A symlink already sitting where a file goes is replaced, not written through
+	target := path.Join(outside, "target.txt")
+	require.NoError(t, os.WriteFile(target, []byte("keep"), 0o644))
+	require.NoError(t, os.Symlink(target, path.Join(dest, "name.txt")))
+	require.NoError(t, unpackEntry(&tar.Header{Name: "name.txt", Typeflag: tar.TypeReg, Mode: 0o644, Size: 4}, bytes.NewReader([]byte("evil")), dest))
+	got, err := os.ReadFile(target)
+	require.NoError(t, err)
+	require.Equal(t, "keep", string(got))
+	got, err = os.ReadFile(path.Join(dest, "name.txt"))
+	require.NoError(t, err)
+	require.Equal(t, "evil", string(got))
+}
+
+func TestUnpackNames(t *testing.T) {
+	var buf bytes.Buffer
+	archive, err := New(&buf, &config.SuitCaseOpts{Format: "tar.gz"})
+	require.NoError(t, err)
+	for _, dest := range []string{"a/name.txt", "b/name.txt", "c/name.txt"} {
+		_, err = archive.Add(inventory.File{
+			Path:        "../testdata/name.txt",
+			Destination: dest,
+		})
+		require.NoError(t, err)
+	}
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, &config.SuitCaseOpts{Format: "tar.gz"})
+	require.NoError(t, err)
+	dest := t.TempDir()
+	got, err := UnpackNames(r, dest, []string{"b/name.txt", "missing.txt"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b/name.txt"}, got)
+	require.FileExists(t, path.Join(dest, "b/name.txt"))
+	require.NoFileExists(t, path.Join(dest, "a/name.txt"))
+	require.NoFileExists(t, path.Join(dest, "c/name.txt"))
+}
+
+func TestUnpackRestoresMetadata(t *testing.T) {
+	src := path.Join(t.TempDir(), "script.sh")
+	require.NoError(t, os.WriteFile(src, []byte("#!/bin/sh\n"), 0o751))
+	mtime := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+	atime := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(src, atime, mtime))
+
+	var buf bytes.Buffer
+	archive, err := New(&buf, &config.SuitCaseOpts{Format: "tar"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        src,
+		Destination: "bin/script.sh",
+		Posix:       &inventory.PosixMetadata{AccessTime: atime},
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, &config.SuitCaseOpts{Format: "tar"})
+	require.NoError(t, err)
+	dest := t.TempDir()
+	_, err = Unpack(r, dest)
+	require.NoError(t, err)
+
+	st, err := os.Stat(path.Join(dest, "bin/script.sh"))
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o751), st.Mode().Perm())
+	require.True(t, mtime.Equal(st.ModTime()))
+}
+
+func TestPreservedEntriesRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(path.Join(src, "empty"), 0o755))
+	require.NoError(t, os.WriteFile(path.Join(src, "data.txt"), []byte("some data"), 0o644))
+	require.NoError(t, os.Link(path.Join(src, "data.txt"), path.Join(src, "again.txt")))
+	require.NoError(t, os.Symlink("data.txt", path.Join(src, "link.txt")))
+	require.NoError(t, syscall.Mkfifo(path.Join(src, "pipe"), 0o600))
+
+	files := []inventory.File{
+		{Path: path.Join(src, "data.txt"), Destination: "data.txt", Size: 9},
+		{Path: path.Join(src, "again.txt"), Destination: "again.txt", Type: inventory.HardlinkEntry, LinkTarget: "data.txt"},
+		{Path: path.Join(src, "link.txt"), Destination: "link.txt", Type: inventory.SymlinkEntry, LinkTarget: "data.txt"},
+		{Path: path.Join(src, "empty"), Destination: "empty/", Type: inventory.DirectoryEntry},
+		{Path: path.Join(src, "pipe"), Destination: "pipe", Type: inventory.FIFOEntry},
+	}
+	for _, encryptInner := range []bool{false, true} {
+		var buf bytes.Buffer
+		archive, err := New(&buf, &config.SuitCaseOpts{Format: "tar"})
+		require.NoError(t, err)
+		for _, f := range files[1:] {
+			// Links, directories and special files skip encryption
+			if encryptInner {
+				require.NoError(t, archive.AddEncrypt(f))
+				continue
+			}
+			_, err = archive.Add(f)
+			require.NoError(t, err)
+		}
+		// The file being linked to comes last, so the hardlink is left for LinkHardlinks
+		_, err = archive.Add(files[0])
+		require.NoError(t, err)
+		require.NoError(t, archive.Close())
+
+		r, err := NewReader(&buf, &config.SuitCaseOpts{Format: "tar"})
+		require.NoError(t, err)
+		dest := t.TempDir()
+		got, err := Unpack(r, dest)
+		require.NoError(t, err)
+		require.Equal(t, []string{"again.txt", "link.txt", "empty/", "pipe", "data.txt"}, got)
+		require.NoFileExists(t, path.Join(dest, "again.txt"))
+		require.NoError(t, LinkHardlinks([]*inventory.File{&files[0], &files[1]}, dest))
+
+		data, err := os.Stat(path.Join(dest, "data.txt"))
+		require.NoError(t, err)
+		again, err := os.Stat(path.Join(dest, "again.txt"))
+		require.NoError(t, err)
+		require.True(t, os.SameFile(data, again))
+
+		link, err := os.Readlink(path.Join(dest, "link.txt"))
+		require.NoError(t, err)
+		require.Equal(t, "data.txt", link)
+
+		require.DirExists(t, path.Join(dest, "empty"))
+
+		pipe, err := os.Lstat(path.Join(dest, "pipe"))
+		require.NoError(t, err)
+		require.NotZero(t, pipe.Mode()&os.ModeNamedPipe)
+	}
+}
@@ -6,16 +6,19 @@ package tar
 import (
 	"archive/tar"
 	"bytes"
-	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/scttfrdmn/cargoship/pkg/config"
 	"github.com/scttfrdmn/cargoship/pkg/gpg"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 )
 
 // Suitcase as tar.
@@ -24,6 +27,19 @@ type Suitcase struct {
 	opts *config.SuitCaseOpts
 }
 
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.TarFormat,
+		Name:   "tar",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			return New(w, opts), nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			return NewReader(r, opts), nil
+		},
+	})
+}
+
 // New tar archive.
 func New(target io.Writer, opts *config.SuitCaseOpts) *Suitcase {
 	return &Suitcase{
@@ -61,47 +77,61 @@ func (a Suitcase) Add(f inventory.File) (*config.HashSet, error) {
 		return nil, err
 	}
 	header.Name = f.Destination
+	if err := preserveMetadata(header, info, link, f); err != nil {
+		return nil, err
+	}
+	if f.Type == inventory.HardlinkEntry {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = f.LinkTarget
+		header.Size = 0
+	}
+	if f.DuplicateOf != "" {
+		header.Size = 0
+		addDuplicateRecord(header, f.DuplicateOf)
+	}
+	if f.Segment != nil {
+		header.Size = f.Size
+		addSegmentRecords(header, f.Segment)
+	}
+	var h *inventory.MultiHasher
+	if a.opts.HashInner && f.HasContent() {
+		// Before the header, so a bad algorithm doesn't leave a header with
+		// no content behind it
+		if h, err = NewHasher(a.opts); err != nil {
+			return nil, err
+		}
+	}
 	if err = a.tw.WriteHeader(header); err != nil {
 		return nil, err
 	}
+	if !f.HasContent() {
+		// Links, directories, special files and duplicates are all header
+		return nil, nil
+	}
 	file, err := os.Open(f.Path) // #nosec
 	if err != nil {
 		return nil, err
 	}
 
 	defer dclose(file)
-	var hs *config.HashSet
-	if a.opts.HashInner {
-		absPath, ferr := filepath.Abs(f.Path)
-		if ferr != nil {
-			return nil, ferr
-		}
-
-		// Get the contents in a temp buffer that we can calculate the hash on
-		buf := bytes.NewBuffer(nil)
-		_, cerr := io.Copy(buf, file)
-		if cerr != nil {
-			return nil, cerr
-		}
-
-		// Calculate and return the hash
-		h := sha256.Sum256(buf.Bytes())
-		hs = &config.HashSet{
-			Filename: absPath,
-			Hash:     fmt.Sprintf("%x", h),
-		}
-		// Reset the cursor so it can go back in the archive
-		_, serr := file.Seek(0, 0)
-		if serr != nil {
-			return nil, serr
-		}
+	content := fileContent(file, f)
+	if h == nil {
+		return nil, CopyContent(a.tw, content, header.Size, f.Path)
 	}
-	_, err = io.Copy(a.tw, file)
-	return hs, err
+	// Hash on the way through, so the file is only read once
+	if err := CopyContent(a.tw, io.TeeReader(content, h), header.Size, f.Path); err != nil {
+		return nil, err
+	}
+	return NewHashSet(f.Path, h)
 }
 
-// AddEncrypt adds and encrypts file to the archive.
+// AddEncrypt adds and encrypts file to the archive. Entries without any
+// content, such as links, are added as is
 func (a Suitcase) AddEncrypt(f inventory.File) error {
+	if !f.HasContent() {
+		_, err := a.Add(f)
+		return err
+	}
 	info, err := os.Lstat(f.Path) // #nosec
 	if err != nil {
 		return err
@@ -115,7 +145,12 @@ func (a Suitcase) AddEncrypt(f inventory.File) error {
 	}
 	dest := fmt.Sprintf("%v.gpg", f.Destination)
 
-	unencryptedData, err := os.ReadFile(f.Path)
+	file, err := os.Open(f.Path) // #nosec
+	if err != nil {
+		return err
+	}
+	defer dclose(file)
+	unencryptedData, err := io.ReadAll(fileContent(file, f))
 	if err != nil {
 		return err
 	}
@@ -137,11 +172,12 @@ func (a Suitcase) AddEncrypt(f inventory.File) error {
 		return err
 	}
 	header.Name = dest
-	/*
-		if !f.ModTime.IsZero() {
-			header.ModTime = f.ModTime
-		}
-	*/
+	if err := preserveMetadata(header, info, link, f); err != nil {
+		return err
+	}
+	if f.Segment != nil {
+		addSegmentRecords(header, f.Segment)
+	}
 	if err = a.tw.WriteHeader(header); err != nil {
 		return err
 	}
@@ -149,6 +185,196 @@ func (a Suitcase) AddEncrypt(f inventory.File) error {
 	return err
 }
 
+// XattrPAXPrefix is the PAX record prefix used to store extended attributes
+const XattrPAXPrefix = "SCHILY.xattr."
+
+const (
+	// SegmentOffsetPAXRecord holds where a segment goes in the whole file
+	SegmentOffsetPAXRecord = "CARGOSHIP.segment.offset"
+	// SegmentTotalSizePAXRecord holds the size of the whole file a segment belongs to
+	SegmentTotalSizePAXRecord = "CARGOSHIP.segment.total_size"
+	// DuplicateOfPAXRecord holds the destination of the file a duplicate has
+	// the same content as
+	DuplicateOfPAXRecord = "CARGOSHIP.duplicate_of"
+)
+
+// DefaultHashAlgorithm is used for HashInner when HashAlgorithm isn't set
+const DefaultHashAlgorithm = inventory.SHA256Hash
+
+// ErrSizeChanged is returned when a file is not the size it was when its
+// header was written, usually because something wrote to it in the meantime
+var ErrSizeChanged = errors.New("file changed size while being added")
+
+// HashAlgorithms returns the algorithms HashInner uses with opts. This is the
+// comma separated list in HashAlgorithm, or DefaultHashAlgorithm when empty
+func HashAlgorithms(opts *config.SuitCaseOpts) ([]inventory.HashAlgorithm, error) {
+	algs, err := inventory.ParseHashAlgorithms(opts.HashAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	if len(algs) == 0 {
+		return []inventory.HashAlgorithm{DefaultHashAlgorithm}, nil
+	}
+	return algs, nil
+}
+
+// NewHasher returns a hasher computing each of the HashAlgorithms for opts
+func NewHasher(opts *config.SuitCaseOpts) (*inventory.MultiHasher, error) {
+	algs, err := HashAlgorithms(opts)
+	if err != nil {
+		return nil, err
+	}
+	return inventory.NewMultiHasher(algs...)
+}
+
+// NewHashSet returns the hashes h computed for the file at path. Hash holds
+// the first algorithm, and Hashes has all of them
+func NewHashSet(path string, h *inventory.MultiHasher) (*config.HashSet, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	sums := h.Sums()
+	return &config.HashSet{
+		Filename: absPath,
+		Hash:     sums[h.Algorithms()[0].String()],
+		Hashes:   sums,
+	}, nil
+}
+
+// CopyContent copies the size bytes of content promised in a header to w,
+// returning ErrSizeChanged if content turns out to be shorter or longer
+func CopyContent(w io.Writer, content io.Reader, size int64, name string) error {
+	n, err := io.CopyN(w, content, size)
+	if err == io.EOF {
+		return fmt.Errorf("%w: %v shrank from %v to %v bytes", ErrSizeChanged, name, size, n)
+	}
+	if err != nil {
+		return err
+	}
+	extra, err := io.CopyN(io.Discard, content, 1)
+	if extra > 0 {
+		return fmt.Errorf("%w: %v grew past %v bytes", ErrSizeChanged, name, size)
+	}
+	if err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// fileContent returns the part of file that belongs in the suitcase, which is
+// only a section of it for segments of a large file
+func fileContent(file *os.File, f inventory.File) io.Reader {
+	if f.Segment == nil {
+		return file
+	}
+	return io.NewSectionReader(file, f.Segment.Offset, f.Size)
+}
+
+// addSegmentRecords records where a segment belongs, so it can be put back in
+// place on restore
+func addSegmentRecords(header *tar.Header, s *inventory.Segment) {
+	header.Format = tar.FormatPAX
+	if header.PAXRecords == nil {
+		header.PAXRecords = map[string]string{}
+	}
+	header.PAXRecords[SegmentOffsetPAXRecord] = strconv.FormatInt(s.Offset, 10)
+	header.PAXRecords[SegmentTotalSizePAXRecord] = strconv.FormatInt(s.TotalSize, 10)
+}
+
+// addDuplicateRecord records which file holds the content of a duplicate
+func addDuplicateRecord(header *tar.Header, canonical string) {
+	header.Format = tar.FormatPAX
+	if header.PAXRecords == nil {
+		header.PAXRecords = map[string]string{}
+	}
+	header.PAXRecords[DuplicateOfPAXRecord] = canonical
+}
+
+// preserveMetadata carries the ownership, timestamps and extended attributes of
+// the original file over in to header. PAX is used so that sub-second times,
+// access and change times, and xattrs all survive the trip
+func preserveMetadata(header *tar.Header, info os.FileInfo, link string, f inventory.File) error {
+	orig, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	header.Format = tar.FormatPAX
+	header.Uid, header.Gid = orig.Uid, orig.Gid
+	header.Uname, header.Gname = orig.Uname, orig.Gname
+	header.AccessTime, header.ChangeTime = orig.AccessTime, orig.ChangeTime
+	if f.Posix == nil {
+		return nil
+	}
+	if !f.Posix.AccessTime.IsZero() {
+		header.AccessTime = f.Posix.AccessTime
+	}
+	for k, v := range f.Posix.Xattrs {
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords[XattrPAXPrefix+k] = string(v)
+	}
+	return nil
+}
+
+// Header is the header for a single file inside of a suitcase
+type Header = tar.Header
+
+// Entry types found in Header.Typeflag, for anything other than regular files
+const (
+	TypeLink    = tar.TypeLink
+	TypeSymlink = tar.TypeSymlink
+	TypeChar    = tar.TypeChar
+	TypeBlock   = tar.TypeBlock
+	TypeDir     = tar.TypeDir
+	TypeFifo    = tar.TypeFifo
+)
+
+// Reader reads files back out of a tar suitcase
+type Reader struct {
+	tr   *tar.Reader
+	opts *config.SuitCaseOpts
+}
+
+// NewReader returns a new tar suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) *Reader {
+	return &Reader{
+		tr:   tar.NewReader(source),
+		opts: opts,
+	}
+}
+
+// Config is the configuration for a suitcase
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.opts
+}
+
+// Close all closeables.
+func (r Reader) Close() error {
+	return nil
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents. When EncryptInner is set, files added with
+// AddEncrypt are decrypted on the fly and have their .gpg suffix removed. The
+// Size in the header is always the size as stored in the archive.
+func (r Reader) Next() (*Header, io.Reader, error) {
+	header, err := r.tr.Next()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !r.opts.EncryptInner || !strings.HasSuffix(header.Name, ".gpg") {
+		return header, r.tr, nil
+	}
+	dr, err := gpg.NewDecryptReader(r.tr, r.opts.DecryptWith, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decrypt %v: %w", header.Name, err)
+	}
+	header.Name = strings.TrimSuffix(header.Name, ".gpg")
+	return header, dr, nil
+}
+
 func dclose(c io.Closer) {
 	err := c.Close()
 	if err != nil {
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 	"bytes"
 
 	"github.com/stretchr/testify/require"
@@ -87,6 +88,55 @@ func TestTarFileAddHash(t *testing.T) {
 	require.NoError(t, archive.Close())
 }
 
+func TestTarFileAddHashAlgorithms(t *testing.T) {
+	var buf bytes.Buffer
+	archive := New(&buf, &config.SuitCaseOpts{
+		Format:        "tar",
+		HashInner:     true,
+		HashAlgorithm: "md5,sha256",
+	})
+	hs, err := archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "1bb3f2a51adb819141a519739be20507", hs.Hash)
+	require.Equal(t, map[string]string{
+		"md5":    "1bb3f2a51adb819141a519739be20507",
+		"sha256": "68e6c64a20407c35ebc20d905c941e03c63b3bfe3c853a708a93ec5a95532fbd",
+	}, hs.Hashes)
+	require.NoError(t, archive.Close())
+
+	// The content still makes it in to the archive
+	r := tar.NewReader(&buf)
+	_, err = r.Next()
+	require.NoError(t, err)
+	got, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+
+	// An unknown algorithm fails before anything is written
+	buf.Reset()
+	archive = New(&buf, &config.SuitCaseOpts{HashInner: true, HashAlgorithm: "crc32"})
+	_, err = archive.Add(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt"})
+	require.Error(t, err)
+	require.Equal(t, 0, buf.Len())
+}
+
+func TestCopyContent(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, CopyContent(&buf, strings.NewReader("hello"), 5, "hello.txt"))
+	require.Equal(t, "hello", buf.String())
+
+	err := CopyContent(io.Discard, strings.NewReader("hel"), 5, "hello.txt")
+	require.ErrorIs(t, err, ErrSizeChanged)
+	require.EqualError(t, err, "file changed size while being added: hello.txt shrank from 5 to 3 bytes")
+
+	err = CopyContent(io.Discard, strings.NewReader("hello world"), 5, "hello.txt")
+	require.ErrorIs(t, err, ErrSizeChanged)
+	require.EqualError(t, err, "file changed size while being added: hello.txt grew past 5 bytes")
+}
+
 func TestConfig(t *testing.T) {
 	// Test that Config() returns the correct configuration
 	opts := &config.SuitCaseOpts{
@@ -539,3 +589,98 @@ func TestWriteHeaderError(t *testing.T) {
 	})
 	require.Error(t, err) // Should fail because file is closed
 }
+
+func TestReader(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+
+	for desc, encrypt := range map[string]bool{"plain": false, "encrypt-inner": true} {
+		t.Run(desc, func(t *testing.T) {
+			opts := &config.SuitCaseOpts{
+				Format:       "tar",
+				EncryptInner: encrypt,
+				EncryptTo:    &openpgp.EntityList{pubKey},
+				DecryptWith:  privKeys,
+			}
+			var buf bytes.Buffer
+			archive := New(&buf, opts)
+			f := inventory.File{
+				Path:        "../../testdata/name.txt",
+				Destination: "name.txt",
+			}
+			if encrypt {
+				require.NoError(t, archive.AddEncrypt(f))
+			} else {
+				_, err := archive.Add(f)
+				require.NoError(t, err)
+			}
+			require.NoError(t, archive.Close())
+
+			r := NewReader(&buf, opts)
+			require.Equal(t, opts, r.Config())
+			header, content, err := r.Next()
+			require.NoError(t, err)
+			require.Equal(t, "name.txt", header.Name)
+			got, err := io.ReadAll(content)
+			require.NoError(t, err)
+			require.Equal(t, "Joe the user\n", string(got))
+
+			_, _, err = r.Next()
+			require.Equal(t, io.EOF, err)
+			require.NoError(t, r.Close())
+		})
+	}
+}
+
+func TestReaderMissingKeys(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	opts := &config.SuitCaseOpts{
+		Format:       "tar",
+		EncryptInner: true,
+		EncryptTo:    &openpgp.EntityList{pubKey},
+	}
+	var buf bytes.Buffer
+	archive := New(&buf, opts)
+	require.NoError(t, archive.AddEncrypt(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	}))
+	require.NoError(t, archive.Close())
+
+	_, _, err = NewReader(&buf, opts).Next()
+	require.EqualError(t, err, "could not decrypt name.txt.gpg: no decryption keys given")
+}
+
+func TestTarFilePreservesMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	archive := New(&buf, &config.SuitCaseOpts{
+		Format: "tar",
+	})
+	atime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	_, err := archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+		Posix: &inventory.PosixMetadata{
+			AccessTime: atime,
+			Xattrs:     map[string][]byte{"user.project": []byte("cargoship")},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	st, err := os.Stat("../../testdata/name.txt")
+	require.NoError(t, err)
+	orig, err := tar.FileInfoHeader(st, "")
+	require.NoError(t, err)
+
+	next, err := tar.NewReader(&buf).Next()
+	require.NoError(t, err)
+	require.Equal(t, tar.FormatPAX, next.Format)
+	require.Equal(t, orig.Uid, next.Uid)
+	require.Equal(t, orig.Gid, next.Gid)
+	require.Equal(t, atime, next.AccessTime.UTC())
+	require.Equal(t, "cargoship", next.PAXRecords[XattrPAXPrefix+"user.project"])
+}
@@ -1,8 +1,8 @@
 /*
 Package tarbz2 creates tar.bz2 files
 
-Unsure if this should stay, so not putting it in the CLI quite yet. All tests
-point to zst files being much more efficient
+All tests point to zst files being much more efficient, but bzip2 is still
+around in plenty of places
 */
 package tarbz2
 
@@ -13,6 +13,7 @@ import (
 
 	"github.com/scttfrdmn/cargoship/pkg/config"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
 )
 
@@ -24,17 +25,43 @@ type Suitcase struct {
 	hashes []config.HashSet
 }
 
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.TarBz2Format,
+		Name:   "tar.bz2",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := New(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+}
+
 // New tar archive.
-func New(target io.Writer, opts *config.SuitCaseOpts) Suitcase {
-	gw, err := bzip2.NewWriter(target, nil)
+func New(target io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
+	// bzip2 only runs on a single core, and its block size comes from the
+	// level, so the level is all there is to set
+	opts.WarnUnsupportedCompression("bzip2", true, false, false)
+	gw, err := bzip2.NewWriter(target, &bzip2.WriterConfig{
+		Level: opts.CompressionLevelOr(bzip2.DefaultCompression),
+	})
 	if err != nil {
-		panic("UGH NO BZIP2 WRITER!!")
+		return Suitcase{}, err
 	}
 	return Suitcase{
 		gw:   gw,
 		tw:   tar.New(gw, opts),
 		opts: opts,
-	}
+	}, nil
 }
 
 // Close all closeables.
@@ -65,3 +92,37 @@ func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
 func (s Suitcase) AddEncrypt(f inventory.File) error {
 	return s.tw.AddEncrypt(f)
 }
+
+// Reader reads tar.bz2 suitcases
+type Reader struct {
+	tr *tar.Reader
+	gr *bzip2.Reader
+}
+
+// NewReader returns a new tar.bz2 suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) (*Reader, error) {
+	gr, err := bzip2.NewReader(source, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		gr: gr,
+		tr: tar.NewReader(gr, opts),
+	}, nil
+}
+
+// Config returns the config options
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.tr.Config()
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents
+func (r Reader) Next() (*tar.Header, io.Reader, error) {
+	return r.tr.Next()
+}
+
+// Close all closeables.
+func (r Reader) Close() error {
+	return r.gr.Close()
+}
@@ -2,6 +2,7 @@ package tarbz2
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/bzip2"
 	"io"
 	"os"
@@ -22,9 +23,10 @@ func TestTarGzFile(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format: "tar.zst",
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -80,7 +82,8 @@ func TestConfig(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test that Config() returns the same options we passed in
@@ -103,7 +106,8 @@ func TestGetHashes(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Initially should be empty
@@ -154,11 +158,12 @@ func TestAddEncrypt(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.bz2",
 		EncryptInner: true,
 		EncryptTo:    encryptTo,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test AddEncrypt with valid file
@@ -183,11 +188,12 @@ func TestAddEncrypt_InvalidEncryption(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.bz2",
 		EncryptInner: true,
 		EncryptTo:    &openpgp.EntityList{}, // Empty entity list
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	err = archive.AddEncrypt(inventory.File{
@@ -209,7 +215,8 @@ func TestNew(t *testing.T) {
 		HashInner: true,
 	}
 	
-	suitcase := New(f, opts)
+	suitcase, err := New(f, opts)
+	require.NoError(t, err)
 	require.NotNil(t, suitcase.tw)
 	require.NotNil(t, suitcase.gw)
 	require.Equal(t, opts, suitcase.Config())
@@ -227,7 +234,8 @@ func TestClose(t *testing.T) {
 		Format: "tar.bz2",
 	}
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	
 	// Add some content
 	_, err = archive.Add(inventory.File{
@@ -248,10 +256,11 @@ func TestTarBz2WithHashing(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.bz2",
 		HashInner: true,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 
 	hs, err := archive.Add(inventory.File{
@@ -264,3 +273,31 @@ func TestTarBz2WithHashing(t *testing.T) {
 
 	require.NoError(t, archive.Close())
 }
+
+func TestReader(t *testing.T) {
+	opts := &config.SuitCaseOpts{
+		Format: "tar.bz2",
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
@@ -0,0 +1,197 @@
+/*
+Package tarcompress creates tar suitcases compressed by the compression
+package: tar.lz4, tar.s2 and tar.xz, along with gpg encrypted versions of
+each. Pick between them with the benchmark command, lz4 and s2 are the fast
+ones, while xz squeezes the hardest
+*/
+package tarcompress
+
+import (
+	"errors"
+	"io"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+
+	"github.com/scttfrdmn/cargoship/pkg/compression"
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
+)
+
+// formats are every suitcase format this package provides
+var formats = []struct {
+	format    registry.Format
+	name      string
+	algorithm compression.Algorithm
+	encrypted bool
+}{
+	{registry.TarLz4Format, "tar.lz4", compression.AlgorithmLZ4, false},
+	{registry.TarLz4GpgFormat, "tar.lz4.gpg", compression.AlgorithmLZ4, true},
+	{registry.TarS2Format, "tar.s2", compression.AlgorithmS2, false},
+	{registry.TarS2GpgFormat, "tar.s2.gpg", compression.AlgorithmS2, true},
+	{registry.TarXzFormat, "tar.xz", compression.AlgorithmXZ, false},
+	{registry.TarXzGpgFormat, "tar.xz.gpg", compression.AlgorithmXZ, true},
+}
+
+func init() {
+	for _, f := range formats {
+		f := f
+		registry.Register(registry.Entry{
+			Format: f.format,
+			Name:   f.name,
+			NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+				newWriter := New
+				if f.encrypted {
+					newWriter = NewEncrypted
+				}
+				s, err := newWriter(w, opts, f.algorithm)
+				if err != nil {
+					return nil, err
+				}
+				return s, nil
+			},
+			NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+				newReader := NewReader
+				if f.encrypted {
+					newReader = NewDecryptReader
+				}
+				rd, err := newReader(r, opts, f.algorithm)
+				if err != nil {
+					return nil, err
+				}
+				return rd, nil
+			},
+		})
+	}
+}
+
+// Suitcase is a tar suitcase compressed with one of the compression
+// algorithms, and optionally encrypted as a whole
+type Suitcase struct {
+	tw   *tar.Suitcase
+	cw   io.WriteCloser
+	ew   io.WriteCloser
+	opts *config.SuitCaseOpts
+}
+
+// New compressed tar archive
+func New(target io.Writer, opts *config.SuitCaseOpts, algorithm compression.Algorithm) (*Suitcase, error) {
+	c, err := opts.Compressor(algorithm, compression.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+	cw, err := c.NewWriter(target)
+	if err != nil {
+		return nil, err
+	}
+	return &Suitcase{
+		tw:   tar.New(cw, opts),
+		cw:   cw,
+		opts: opts,
+	}, nil
+}
+
+// NewEncrypted creates a compressed tar archive that is gpg encrypted as a
+// whole
+func NewEncrypted(target io.Writer, opts *config.SuitCaseOpts, algorithm compression.Algorithm) (*Suitcase, error) {
+	if opts.EncryptTo == nil {
+		return nil, errors.New("cannot encrypt without EncryptTo")
+	}
+	ew, err := openpgp.Encrypt(target, *opts.EncryptTo, nil, &openpgp.FileHints{
+		IsBinary: true,
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	s, err := New(ew, opts, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	s.ew = ew
+	return s, nil
+}
+
+// Config returns configuration options
+func (s Suitcase) Config() *config.SuitCaseOpts {
+	return s.opts
+}
+
+// Close all closeables, from tar, through compression, to the cipher
+func (s Suitcase) Close() error {
+	if err := s.tw.Close(); err != nil {
+		return err
+	}
+	if err := s.cw.Close(); err != nil {
+		return err
+	}
+	if s.ew != nil {
+		return s.ew.Close()
+	}
+	return nil
+}
+
+// Add file to the archive
+func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
+	return s.tw.Add(f)
+}
+
+// AddEncrypt adds and encrypts a file to the archive
+func (s Suitcase) AddEncrypt(f inventory.File) error {
+	if s.ew != nil {
+		return errors.New("file encryption not supported on already encrypted archives")
+	}
+	return s.tw.AddEncrypt(f)
+}
+
+// Reader reads compressed tar suitcases
+type Reader struct {
+	tr *tar.Reader
+	cr io.ReadCloser
+}
+
+// NewReader returns a new compressed tar suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts, algorithm compression.Algorithm) (*Reader, error) {
+	c, err := compression.NewCompressor(algorithm, compression.LevelDefault)
+	if err != nil {
+		return nil, err
+	}
+	cr, err := c.NewReader(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		cr: cr,
+		tr: tar.NewReader(cr, opts),
+	}, nil
+}
+
+// NewDecryptReader returns a reader for compressed tar suitcases that were
+// gpg encrypted as a whole
+func NewDecryptReader(source io.Reader, opts *config.SuitCaseOpts, algorithm compression.Algorithm) (*Reader, error) {
+	if opts.DecryptWith == nil {
+		return nil, errors.New("cannot decrypt without DecryptWith")
+	}
+	dr, err := gpg.NewDecryptReader(source, opts.DecryptWith, false)
+	if err != nil {
+		return nil, err
+	}
+	return NewReader(dr, opts, algorithm)
+}
+
+// Config returns the config options
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.tr.Config()
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents
+func (r Reader) Next() (*tar.Header, io.Reader, error) {
+	return r.tr.Next()
+}
+
+// Close all closeables
+func (r Reader) Close() error {
+	return r.cr.Close()
+}
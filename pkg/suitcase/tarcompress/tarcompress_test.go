@@ -0,0 +1,103 @@
+package tarcompress
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/scttfrdmn/cargoship/pkg/compression"
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+)
+
+func TestRoundTrip(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+
+	for _, f := range formats {
+		opts := &config.SuitCaseOpts{
+			Format:      f.name,
+			EncryptTo:   &openpgp.EntityList{pubKey},
+			DecryptWith: privKeys,
+		}
+		var buf bytes.Buffer
+		var archive *Suitcase
+		if f.encrypted {
+			archive, err = NewEncrypted(&buf, opts, f.algorithm)
+		} else {
+			archive, err = New(&buf, opts, f.algorithm)
+		}
+		require.NoError(t, err, f.name)
+		_, err = archive.Add(inventory.File{
+			Path:        "../../testdata/name.txt",
+			Destination: "name.txt",
+		})
+		require.NoError(t, err, f.name)
+		if f.encrypted {
+			require.EqualError(t, archive.AddEncrypt(inventory.File{}), "file encryption not supported on already encrypted archives")
+		}
+		require.NoError(t, archive.Close(), f.name)
+		if f.encrypted {
+			require.NotContains(t, buf.String(), "Joe the user", f.name)
+		}
+
+		var r *Reader
+		if f.encrypted {
+			r, err = NewDecryptReader(&buf, opts, f.algorithm)
+		} else {
+			r, err = NewReader(&buf, opts, f.algorithm)
+		}
+		require.NoError(t, err, f.name)
+		header, content, err := r.Next()
+		require.NoError(t, err, f.name)
+		require.Equal(t, "name.txt", header.Name, f.name)
+		got, err := io.ReadAll(content)
+		require.NoError(t, err, f.name)
+		require.Equal(t, "Joe the user\n", string(got), f.name)
+		_, _, err = r.Next()
+		require.Equal(t, io.EOF, err, f.name)
+		require.NoError(t, r.Close(), f.name)
+	}
+}
+
+func TestEncryptedWithoutKeys(t *testing.T) {
+	_, err := NewEncrypted(io.Discard, &config.SuitCaseOpts{}, compression.AlgorithmXZ)
+	require.EqualError(t, err, "cannot encrypt without EncryptTo")
+	_, err = NewDecryptReader(&bytes.Buffer{}, &config.SuitCaseOpts{}, compression.AlgorithmXZ)
+	require.EqualError(t, err, "cannot decrypt without DecryptWith")
+}
+
+func TestCompressionOptions(t *testing.T) {
+	_, err := New(io.Discard, &config.SuitCaseOpts{CompressionLevel: 1}, compression.Algorithm("nope"))
+	require.Error(t, err)
+
+	for _, level := range []int{1, 9} {
+		opts := &config.SuitCaseOpts{
+			Format:                 "tar.s2",
+			CompressionLevel:       level,
+			CompressionConcurrency: 2,
+			CompressionWindow:      64 << 10,
+		}
+		var buf bytes.Buffer
+		archive, err := New(&buf, opts, compression.AlgorithmS2)
+		require.NoError(t, err)
+		_, err = archive.Add(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt"})
+		require.NoError(t, err)
+		require.NoError(t, archive.Close())
+
+		r, err := NewReader(&buf, opts, compression.AlgorithmS2)
+		require.NoError(t, err)
+		_, content, err := r.Next()
+		require.NoError(t, err)
+		got, err := io.ReadAll(content)
+		require.NoError(t, err)
+		require.Equal(t, "Joe the user\n", string(got))
+		require.NoError(t, r.Close())
+	}
+}
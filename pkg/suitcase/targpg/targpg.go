@@ -9,7 +9,9 @@ import (
 
 	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
 )
 
@@ -21,20 +23,44 @@ type Suitcase struct {
 	hashes []config.HashSet
 }
 
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.TarGpgFormat,
+		Name:   "tar.gpg",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := New(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+}
+
 // New tar archive.
-func New(target io.Writer, opts *config.SuitCaseOpts) Suitcase {
+func New(target io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
 	if opts.EncryptTo == nil {
-		panic("NEED ENCRYPT TO")
+		return Suitcase{}, errors.New("cannot encrypt without EncryptTo")
 	}
-	cw, _ := openpgp.Encrypt(target, *opts.EncryptTo, nil, &openpgp.FileHints{
+	cw, err := openpgp.Encrypt(target, *opts.EncryptTo, nil, &openpgp.FileHints{
 		IsBinary: true,
 	}, nil)
+	if err != nil {
+		return Suitcase{}, err
+	}
 	tw := tar.New(cw, opts)
 	return Suitcase{
 		cw:   &cw,
 		tw:   tw,
 		opts: opts,
-	}
+	}, nil
 }
 
 // Config is the configuration for a suitcase
@@ -49,12 +75,13 @@ func (s Suitcase) GetHashes() []config.HashSet {
 
 // Close all closeables.
 func (s Suitcase) Close() error {
-	// Cipher Writer Close
-	item := *s.cw
-	if err := item.Close(); err != nil {
+	// Close tar writer first, so the trailer makes it in to the cipher
+	if err := s.tw.Close(); err != nil {
 		return err
 	}
-	return s.tw.Close()
+	// Cipher Writer Close
+	item := *s.cw
+	return item.Close()
 }
 
 // Add file to the archive.
@@ -66,3 +93,38 @@ func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
 func (s Suitcase) AddEncrypt(_ inventory.File) error {
 	return errors.New("file encryption not supported on already encrypted archives")
 }
+
+// Reader reads tar.gpg suitcases
+type Reader struct {
+	tr *tar.Reader
+}
+
+// NewReader returns a new tar.gpg suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) (*Reader, error) {
+	if opts.DecryptWith == nil {
+		return nil, errors.New("cannot decrypt without DecryptWith")
+	}
+	cr, err := gpg.NewDecryptReader(source, opts.DecryptWith, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		tr: tar.NewReader(cr, opts),
+	}, nil
+}
+
+// Config returns the config options
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.tr.Config()
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents
+func (r Reader) Next() (*tar.Header, io.Reader, error) {
+	return r.tr.Next()
+}
+
+// Close all closeables.
+func (r Reader) Close() error {
+	return nil
+}
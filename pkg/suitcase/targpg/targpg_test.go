@@ -2,6 +2,7 @@ package targpg
 
 import (
 	"archive/tar"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -22,9 +23,10 @@ func TestTarGPGFileCorrupt(t *testing.T) {
 
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -68,9 +70,10 @@ func TestTarGPGFileWithTar(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -113,10 +116,11 @@ func TestTarGPGFile(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -178,7 +182,8 @@ func TestConfig(t *testing.T) {
 		EncryptTo: &openpgp.EntityList{pubKey},
 	}
 
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test Config method
@@ -197,10 +202,11 @@ func TestGetHashes(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test GetHashes method (should return empty slice initially)
@@ -218,10 +224,11 @@ func TestAddEncrypt(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test AddEncrypt method (should return error for already encrypted archives)
@@ -232,3 +239,40 @@ func TestAddEncrypt(t *testing.T) {
 	require.Error(t, err)
 	require.EqualError(t, err, "file encryption not supported on already encrypted archives")
 }
+
+func TestReader(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	opts := &config.SuitCaseOpts{
+		Format:    "tar.gpg",
+		EncryptTo: &openpgp.EntityList{pubKey},
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	_, err = NewReader(bytes.NewReader(buf.Bytes()), opts)
+	require.EqualError(t, err, "cannot decrypt without DecryptWith")
+
+	opts.DecryptWith = privKeys
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
@@ -8,30 +8,57 @@ import (
 
 	gzip "github.com/klauspost/pgzip"
 
+	"github.com/scttfrdmn/cargoship/pkg/compression"
 	"github.com/scttfrdmn/cargoship/pkg/config"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
 )
 
 // Suitcase represents everything needef for a tar.gz suitcase
 type Suitcase struct {
 	tw     *tar.Suitcase
-	gw     *gzip.Writer
+	gw     io.WriteCloser
 	opts   *config.SuitCaseOpts
 	hashes []config.HashSet
 }
 
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.TarGzFormat,
+		Name:   "tar.gz",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := New(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+}
+
 // New tar archive.
-func New(target io.Writer, opts *config.SuitCaseOpts) Suitcase {
-	gw, err := gzip.NewWriterLevel(target, gzip.BestCompression)
+func New(target io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
+	c, err := opts.Compressor(compression.AlgorithmGzip, compression.LevelBest)
 	if err != nil {
-		panic("UGH NO GZIP WRITER!!")
+		return Suitcase{}, err
+	}
+	gw, err := c.NewWriter(target)
+	if err != nil {
+		return Suitcase{}, err
 	}
 	return Suitcase{
 		gw:   gw,
 		tw:   tar.New(gw, opts),
 		opts: opts,
-	}
+	}, nil
 }
 
 // Close all closeables.
@@ -62,3 +89,37 @@ func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
 func (s Suitcase) AddEncrypt(f inventory.File) error {
 	return s.tw.AddEncrypt(f)
 }
+
+// Reader reads tar.gz suitcases
+type Reader struct {
+	tr *tar.Reader
+	gr *gzip.Reader
+}
+
+// NewReader returns a new tar.gz suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) (*Reader, error) {
+	gr, err := gzip.NewReader(source)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		gr: gr,
+		tr: tar.NewReader(gr, opts),
+	}, nil
+}
+
+// Config returns the config options
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.tr.Config()
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents
+func (r Reader) Next() (*tar.Header, io.Reader, error) {
+	return r.tr.Next()
+}
+
+// Close all closeables.
+func (r Reader) Close() error {
+	return r.gr.Close()
+}
@@ -2,6 +2,7 @@ package targz
 
 import (
 	"archive/tar"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -23,9 +24,10 @@ func TestTarGzFile(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format: "tar.gz",
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -82,7 +84,8 @@ func TestConfig(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test that Config() returns the same options we passed in
@@ -105,7 +108,8 @@ func TestGetHashes(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Initially should be empty
@@ -156,11 +160,12 @@ func TestAddEncrypt(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.gz",
 		EncryptInner: true,
 		EncryptTo:    encryptTo,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test AddEncrypt with valid file
@@ -185,11 +190,12 @@ func TestAddEncrypt_InvalidEncryption(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.gz",
 		EncryptInner: true,
 		EncryptTo:    &openpgp.EntityList{}, // Empty entity list
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	err = archive.AddEncrypt(inventory.File{
@@ -211,13 +217,23 @@ func TestNew(t *testing.T) {
 		HashInner: true,
 	}
 	
-	suitcase := New(f, opts)
+	suitcase, err := New(f, opts)
+	require.NoError(t, err)
 	require.NotNil(t, suitcase.tw)
 	require.NotNil(t, suitcase.gw)
 	require.Equal(t, opts, suitcase.Config())
 	defer func() { _ = suitcase.Close() }()
 }
 
+func TestNewInvalidLevel(t *testing.T) {
+	var buf bytes.Buffer
+	_, err := New(&buf, &config.SuitCaseOpts{
+		Format:           "tar.gz",
+		CompressionLevel: 42,
+	})
+	require.Error(t, err)
+}
+
 func TestClose(t *testing.T) {
 	// Test Close functionality
 	tmp := t.TempDir()
@@ -229,7 +245,8 @@ func TestClose(t *testing.T) {
 		Format: "tar.gz",
 	}
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	
 	// Add some content
 	_, err = archive.Add(inventory.File{
@@ -250,10 +267,11 @@ func TestTarGzWithHashing(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gz",
 		HashInner: true,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 
 	hs, err := archive.Add(inventory.File{
@@ -266,3 +284,31 @@ func TestTarGzWithHashing(t *testing.T) {
 
 	require.NoError(t, archive.Close())
 }
+
+func TestReader(t *testing.T) {
+	opts := &config.SuitCaseOpts{
+		Format: "tar.gz",
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
@@ -10,8 +10,11 @@ import (
 	"github.com/klauspost/pgzip"
 
 	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/scttfrdmn/cargoship/pkg/compression"
 	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
 	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
 	"github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
 )
 
@@ -19,27 +22,58 @@ import (
 type Suitcase struct {
 	tw     *tar.Suitcase
 	cw     *io.WriteCloser
-	gw     *pgzip.Writer
+	gw     io.WriteCloser
 	opts   *config.SuitCaseOpts
 	hashes []config.HashSet
 }
 
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.TarGzGpgFormat,
+		Name:   "tar.gz.gpg",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := New(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+}
+
 // New tar archive.
-func New(target io.Writer, opts *config.SuitCaseOpts) Suitcase {
+func New(target io.Writer, opts *config.SuitCaseOpts) (Suitcase, error) {
 	if opts.EncryptTo == nil {
-		panic("NEED ENCRYPT TO")
+		return Suitcase{}, errors.New("cannot encrypt without EncryptTo")
 	}
-	cw, _ := openpgp.Encrypt(target, *opts.EncryptTo, nil, &openpgp.FileHints{
+	cw, err := openpgp.Encrypt(target, *opts.EncryptTo, nil, &openpgp.FileHints{
 		IsBinary: true,
 	}, nil)
-	gw, _ := pgzip.NewWriterLevel(cw, pgzip.BestCompression)
+	if err != nil {
+		return Suitcase{}, err
+	}
+	c, err := opts.Compressor(compression.AlgorithmGzip, compression.LevelBest)
+	if err != nil {
+		return Suitcase{}, err
+	}
+	gw, err := c.NewWriter(cw)
+	if err != nil {
+		return Suitcase{}, err
+	}
 	tw := tar.New(gw, opts)
 	return Suitcase{
 		cw:   &cw,
 		tw:   tw,
 		gw:   gw,
 		opts: opts,
-	}
+	}, nil
 }
 
 // Config returns configuration options
@@ -85,3 +119,44 @@ func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
 func (s Suitcase) AddEncrypt(_ inventory.File) error {
 	return errors.New("file encryption not supported on already encrypted archives")
 }
+
+// Reader reads tar.gz.gpg suitcases
+type Reader struct {
+	tr *tar.Reader
+	gr *pgzip.Reader
+}
+
+// NewReader returns a new tar.gz.gpg suitcase reader
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) (*Reader, error) {
+	if opts.DecryptWith == nil {
+		return nil, errors.New("cannot decrypt without DecryptWith")
+	}
+	cr, err := gpg.NewDecryptReader(source, opts.DecryptWith, false)
+	if err != nil {
+		return nil, err
+	}
+	gr, err := pgzip.NewReader(cr)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{
+		gr: gr,
+		tr: tar.NewReader(gr, opts),
+	}, nil
+}
+
+// Config returns the config options
+func (r Reader) Config() *config.SuitCaseOpts {
+	return r.tr.Config()
+}
+
+// Next advances to the next file in the archive, returning the header and a
+// reader for the file contents
+func (r Reader) Next() (*tar.Header, io.Reader, error) {
+	return r.tr.Next()
+}
+
+// Close all closeables.
+func (r Reader) Close() error {
+	return r.gr.Close()
+}
@@ -2,6 +2,7 @@ package targzgpg
 
 import (
 	"archive/tar"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -24,9 +25,10 @@ func TestTarGPGFileCorrupt(t *testing.T) {
 
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	/*
@@ -71,9 +73,10 @@ func TestTarGPGFileWithTar(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -116,10 +119,11 @@ func TestTarGZGPGFile(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gz.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -183,7 +187,8 @@ func TestConfig(t *testing.T) {
 		EncryptTo: &openpgp.EntityList{pubKey},
 	}
 
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test Config method
@@ -202,10 +207,11 @@ func TestGetHashes(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gz.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test GetHashes method (should return empty slice initially)
@@ -223,10 +229,11 @@ func TestAddEncrypt(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gz.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test AddEncrypt method (should return error for already encrypted archives)
@@ -237,3 +244,40 @@ func TestAddEncrypt(t *testing.T) {
 	require.Error(t, err)
 	require.EqualError(t, err, "file encryption not supported on already encrypted archives")
 }
+
+func TestReader(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	opts := &config.SuitCaseOpts{
+		Format:    "tar.gz.gpg",
+		EncryptTo: &openpgp.EntityList{pubKey},
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	_, err = NewReader(bytes.NewReader(buf.Bytes()), opts)
+	require.EqualError(t, err, "cannot decrypt without DecryptWith")
+
+	opts.DecryptWith = privKeys
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
@@ -2,6 +2,7 @@ package tarzstd
 
 import (
 	"archive/tar"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -22,9 +23,10 @@ func TestTarZstFile(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format: "tar.zst",
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -79,7 +81,8 @@ func TestConfig(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test that Config() returns the same options we passed in
@@ -102,7 +105,8 @@ func TestGetHashes(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Initially should be empty
@@ -153,11 +157,12 @@ func TestAddEncrypt(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.zst",
 		EncryptInner: true,
 		EncryptTo:    encryptTo,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	// Test AddEncrypt with valid file
@@ -182,11 +187,12 @@ func TestAddEncrypt_InvalidEncryption(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 	
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:       "tar.zst",
 		EncryptInner: true,
 		EncryptTo:    &openpgp.EntityList{}, // Empty entity list
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 	
 	err = archive.AddEncrypt(inventory.File{
@@ -208,7 +214,8 @@ func TestNew(t *testing.T) {
 		HashInner: true,
 	}
 	
-	suitcase := New(f, opts)
+	suitcase, err := New(f, opts)
+	require.NoError(t, err)
 	require.NotNil(t, suitcase.tw)
 	require.NotNil(t, suitcase.gw)
 	require.Equal(t, opts, suitcase.Config())
@@ -226,7 +233,8 @@ func TestClose(t *testing.T) {
 		Format: "tar.zst",
 	}
 	
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	
 	// Add some content
 	_, err = archive.Add(inventory.File{
@@ -247,10 +255,11 @@ func TestTarZstdWithHashing(t *testing.T) {
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.zst",
 		HashInner: true,
 	})
+	require.NoError(t, err)
 	defer func() { _ = archive.Close() }()
 
 	hs, err := archive.Add(inventory.File{
@@ -263,3 +272,31 @@ func TestTarZstdWithHashing(t *testing.T) {
 
 	require.NoError(t, archive.Close())
 }
+
+func TestReader(t *testing.T) {
+	opts := &config.SuitCaseOpts{
+		Format: "tar.zst",
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
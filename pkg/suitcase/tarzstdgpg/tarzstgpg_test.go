@@ -2,7 +2,7 @@ package tarzstgpg
 
 import (
 	"archive/tar"
-	"fmt"
+	"bytes"
 	"io"
 	"os"
 	"path/filepath"
@@ -24,9 +24,10 @@ func TestTarGPGFileCorrupt(t *testing.T) {
 
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	/*
@@ -71,9 +72,10 @@ func TestTarGPGFileWithTar(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -116,10 +118,11 @@ func TestTarGZGPGFile(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.gz.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	_, err = archive.Add(inventory.File{
@@ -183,7 +186,8 @@ func TestConfig(t *testing.T) {
 		EncryptTo: &openpgp.EntityList{pubKey},
 	}
 
-	archive := New(f, opts)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test Config method
@@ -202,10 +206,11 @@ func TestGetHashes(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.zst.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test GetHashes method (should return empty slice initially)
@@ -223,10 +228,11 @@ func TestAddEncrypt(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		Format:    "tar.zst.gpg",
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 	defer archive.Close() // nolint: errcheck
 
 	// Test AddEncrypt method (should return error for already encrypted archives)
@@ -238,25 +244,17 @@ func TestAddEncrypt(t *testing.T) {
 	require.EqualError(t, err, "file encryption not supported on already encrypted archives")
 }
 
-// Test panic condition when EncryptTo is nil (covers missing New function coverage)
+// Test error when EncryptTo is nil
 func TestNewWithNilEncryptTo(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-			require.Contains(t, fmt.Sprint(r), "NEED ENCRYPT TO")
-		} else {
-			t.Error("Expected panic when EncryptTo is nil")
-		}
-	}()
-
 	tmp := t.TempDir()
 	f, err := os.Create(filepath.Join(tmp, "test.tar"))
 	require.NoError(t, err)
 	defer func() { _ = f.Close() }()
 
-	// This should panic
-	_ = New(f, &config.SuitCaseOpts{
-		EncryptTo: nil, // This will trigger panic
+	_, err = New(f, &config.SuitCaseOpts{
+		EncryptTo: nil,
 	})
+	require.EqualError(t, err, "cannot encrypt without EncryptTo")
 }
 
 // Test error paths in Close function by closing underlying resources
@@ -268,9 +266,10 @@ func TestCloseWithErrors(t *testing.T) {
 	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
 	require.NoError(t, err)
 
-	archive := New(f, &config.SuitCaseOpts{
+	archive, err := New(f, &config.SuitCaseOpts{
 		EncryptTo: &openpgp.EntityList{pubKey},
 	})
+	require.NoError(t, err)
 
 	// Add a file first to make the archive valid
 	_, err = archive.Add(inventory.File{
@@ -286,3 +285,40 @@ func TestCloseWithErrors(t *testing.T) {
 	// but it exercises the error paths in Close()
 	_ = archive.Close()
 }
+
+func TestReader(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	opts := &config.SuitCaseOpts{
+		Format:    "tar.zst.gpg",
+		EncryptTo: &openpgp.EntityList{pubKey},
+	}
+	var buf bytes.Buffer
+	archive, err := New(&buf, opts)
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	_, err = NewReader(bytes.NewReader(buf.Bytes()), opts)
+	require.EqualError(t, err, "cannot decrypt without DecryptWith")
+
+	opts.DecryptWith = privKeys
+	r, err := NewReader(&buf, opts)
+	require.NoError(t, err)
+	require.Equal(t, opts, r.Config())
+	header, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", header.Name)
+	got, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(got))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	require.NoError(t, r.Close())
+}
@@ -0,0 +1,598 @@
+/*
+Package zip provides zip suitcases, for anyone who would rather not deal with
+tar tooling. Members larger than 4GiB, or suitcases with more than 65535
+members, are written using ZIP64. The aes.zip format encrypts every member
+with WinZip compatible AES-256 using a password. archive/zip can't encrypt,
+so aes.zip suitcases are written and read with a fork of it that can, and
+everything else sticks with the standard library
+
+Members are deflated one at a time at the compression level, so the
+concurrency and window options don't apply to zip suitcases. The fork used
+for aes.zip suitcases always deflates at its default level
+*/
+package zip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	aeszip "github.com/alexmullins/zip"
+
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	"github.com/scttfrdmn/cargoship/pkg/suitcase/registry"
+	ctar "github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
+)
+
+// Suitcase is a zip suitcase. Only one of zw, or aw for aes.zip suitcases, is
+// set
+type Suitcase struct {
+	zw       *zip.Writer
+	aw       *aeszip.Writer
+	opts     *config.SuitCaseOpts
+	password string
+}
+
+func init() {
+	registry.Register(registry.Entry{
+		Format: registry.ZipFormat,
+		Name:   "zip",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := New(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+	registry.Register(registry.Entry{
+		Format: registry.ZipAESFormat,
+		Name:   "aes.zip",
+		NewWriter: func(w io.Writer, opts *config.SuitCaseOpts) (registry.Writer, error) {
+			s, err := NewAES(w, opts)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		NewReader: func(r io.Reader, opts *config.SuitCaseOpts) (registry.Reader, error) {
+			if opts.Password == "" {
+				return nil, errors.New("cannot read aes.zip suitcases without a password")
+			}
+			rd, err := NewReader(r, opts)
+			if err != nil {
+				return nil, err
+			}
+			return rd, nil
+		},
+	})
+}
+
+// New zip archive
+func New(target io.Writer, opts *config.SuitCaseOpts) (*Suitcase, error) {
+	opts.WarnUnsupportedCompression("zip", true, false, false)
+	level := opts.CompressionLevelOr(flate.DefaultCompression)
+	// Catch a bad level here, instead of on the first member
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		return nil, err
+	}
+	zw := zip.NewWriter(target)
+	zw.RegisterCompressor(zip.Deflate, func(w io.Writer) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})
+	return &Suitcase{
+		zw:   zw,
+		opts: opts,
+	}, nil
+}
+
+// NewAES creates a zip archive with every member encrypted using the password
+// in the options
+func NewAES(target io.Writer, opts *config.SuitCaseOpts) (*Suitcase, error) {
+	if opts.Password == "" {
+		return nil, errors.New("cannot write aes.zip suitcases without a password")
+	}
+	opts.WarnUnsupportedCompression("aes.zip", false, false, false)
+	return &Suitcase{
+		aw:       aeszip.NewWriter(target),
+		opts:     opts,
+		password: opts.Password,
+	}, nil
+}
+
+// Config returns configuration options
+func (s Suitcase) Config() *config.SuitCaseOpts {
+	return s.opts
+}
+
+// Close finishes off the central directory
+func (s Suitcase) Close() error {
+	if s.aw != nil {
+		return s.aw.Close()
+	}
+	return s.zw.Close()
+}
+
+// create starts a new member, encrypting it for aes.zip suitcases
+func (s Suitcase) create(header *zip.FileHeader) (io.Writer, error) {
+	if s.aw == nil {
+		return s.zw.CreateHeader(header)
+	}
+	ah := &aeszip.FileHeader{
+		Name:               header.Name,
+		CreatorVersion:     header.CreatorVersion,
+		Method:             header.Method,
+		UncompressedSize64: header.UncompressedSize64,
+		// archive/zip adds the extended timestamp itself, the fork doesn't
+		Extra:         append(header.Extra, extendedTime(header.Modified)...),
+		ExternalAttrs: header.ExternalAttrs,
+		Comment:       header.Comment,
+	}
+	ah.SetModTime(header.Modified)
+	ah.SetPassword(s.password)
+	return s.aw.CreateHeader(ah)
+}
+
+// Add a file to the archive
+func (s Suitcase) Add(f inventory.File) (*config.HashSet, error) {
+	info, err := os.Lstat(f.Path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	header, err := s.header(info, f, f.Destination)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case info.IsDir():
+		header.Name = strings.TrimSuffix(header.Name, "/") + "/"
+		_, err := s.create(header)
+		return nil, err
+	case info.Mode()&os.ModeSymlink != 0:
+		// Symlinks are stored with their target as the content, like Info-ZIP does
+		link, err := os.Readlink(f.Path) // #nosec
+		if err != nil {
+			return nil, err
+		}
+		header.Method = zip.Store
+		w, err := s.create(header)
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.WriteString(w, link)
+		return nil, err
+	case !f.HasContent():
+		// Hardlinks and duplicates are only a record in the comment
+		header.Method = zip.Store
+		_, err := s.create(header)
+		return nil, err
+	}
+
+	file, err := os.Open(f.Path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	defer dclose(file)
+	content := fileContent(file, f)
+	if header.Method, err = pickMethod(content, f.Destination); err != nil {
+		return nil, err
+	}
+	var h *inventory.MultiHasher
+	if s.opts.HashInner {
+		// Before the header, so a bad algorithm doesn't leave an empty entry behind
+		if h, err = ctar.NewHasher(s.opts); err != nil {
+			return nil, err
+		}
+	}
+	w, err := s.create(header)
+	if err != nil {
+		return nil, err
+	}
+	size := info.Size()
+	if f.Segment != nil {
+		size = f.Size
+	}
+	if h == nil {
+		return nil, ctar.CopyContent(w, content, size, f.Path)
+	}
+	if err := ctar.CopyContent(w, io.TeeReader(content, h), size, f.Path); err != nil {
+		return nil, err
+	}
+	return ctar.NewHashSet(f.Path, h)
+}
+
+// AddEncrypt adds and gpg encrypts a file to the archive. Entries without
+// any content, such as links, are added as is
+func (s Suitcase) AddEncrypt(f inventory.File) error {
+	if !f.HasContent() {
+		_, err := s.Add(f)
+		return err
+	}
+	info, err := os.Lstat(f.Path) // #nosec
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(f.Path) // #nosec
+	if err != nil {
+		return err
+	}
+	defer dclose(file)
+	unencryptedData, err := io.ReadAll(fileContent(file, f))
+	if err != nil {
+		return err
+	}
+	encryptedD, err := gpg.Encrypt(unencryptedData, s.opts.EncryptTo, true)
+	if err != nil {
+		return err
+	}
+
+	header, err := s.header(info, f, f.Destination+".gpg")
+	if err != nil {
+		return err
+	}
+	// Encrypted data won't get any smaller
+	header.Method = zip.Store
+	w, err := s.create(header)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encryptedD)
+	return err
+}
+
+// header builds the zip header for a file. Inventories for zip suitcases
+// leave out the sorts of files zip can't hold, so finding one here is an error
+func (s Suitcase) header(info os.FileInfo, f inventory.File, name string) (*zip.FileHeader, error) {
+	if info.Mode()&(os.ModeNamedPipe|os.ModeDevice|os.ModeCharDevice|os.ModeSocket) != 0 {
+		return nil, fmt.Errorf("zip suitcases can not hold special files: %v", f.Path)
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return nil, err
+	}
+	header.Name = name
+	header.Comment = recordsComment(f)
+	return header, nil
+}
+
+// extTimeExtraID is the Info-ZIP extended timestamp extra field, which holds
+// the modification time to the second. The MS-DOS time in the header only
+// goes to every other second, and has no time zone
+const extTimeExtraID = 0x5455
+
+func extendedTime(t time.Time) []byte {
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint16(b[0:], extTimeExtraID)
+	binary.LittleEndian.PutUint16(b[2:], 5)
+	// Only the modification time is included
+	b[4] = 1
+	binary.LittleEndian.PutUint32(b[5:], uint32(t.Unix())) // nolint:gosec
+	return b
+}
+
+func parseExtendedTime(extra []byte) (time.Time, bool) {
+	for len(extra) >= 4 {
+		id := binary.LittleEndian.Uint16(extra[0:])
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if len(extra) < 4+size {
+			break
+		}
+		field := extra[4 : 4+size]
+		extra = extra[4+size:]
+		if id != extTimeExtraID || len(field) < 5 || field[0]&1 == 0 {
+			continue
+		}
+		return time.Unix(int64(binary.LittleEndian.Uint32(field[1:])), 0), true
+	}
+	return time.Time{}, false
+}
+
+// HardlinkRecord holds the destination of the file a hardlink points to, since
+// zip has no hardlinks of its own
+const HardlinkRecord = "CARGOSHIP.hardlink"
+
+// recordsComment keeps the same records a tar suitcase keeps in PAX headers,
+// for segments, duplicates and hardlinks, in the member comment
+func recordsComment(f inventory.File) string {
+	records := map[string]string{}
+	if f.Type == inventory.HardlinkEntry {
+		records[HardlinkRecord] = f.LinkTarget
+	}
+	if f.Segment != nil {
+		records[ctar.SegmentOffsetPAXRecord] = fmt.Sprint(f.Segment.Offset)
+		records[ctar.SegmentTotalSizePAXRecord] = fmt.Sprint(f.Segment.TotalSize)
+	}
+	if f.DuplicateOf != "" {
+		records[ctar.DuplicateOfPAXRecord] = f.DuplicateOf
+	}
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%v=%v\n", k, records[k])
+	}
+	return b.String()
+}
+
+func parseRecordsComment(c string) map[string]string {
+	if c == "" {
+		return nil
+	}
+	ret := map[string]string{}
+	for _, line := range strings.Split(c, "\n") {
+		if k, v, ok := strings.Cut(line, "="); ok {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// storedExts are for files that are already compressed, where deflate would
+// only waste time
+var storedExts = map[string]bool{
+	".7z": true, ".br": true, ".bz2": true, ".gif": true, ".gpg": true,
+	".gz": true, ".jpeg": true, ".jpg": true, ".lz4": true, ".mkv": true,
+	".mov": true, ".mp3": true, ".mp4": true, ".png": true, ".rar": true,
+	".sz": true, ".tgz": true, ".webp": true, ".xz": true, ".zip": true,
+	".zst": true,
+}
+
+// sampleSize is how much of a file is test compressed, to see if it is
+// worth deflating
+const sampleSize = 64 * 1024
+
+// pickMethod decides whether a member should be deflated or just stored,
+// using the extension, or compressing a sample from the start of the content
+// when the extension doesn't say. content is left where it started
+func pickMethod(content io.ReadSeeker, name string) (uint16, error) {
+	if storedExts[strings.ToLower(filepath.Ext(name))] {
+		return zip.Store, nil
+	}
+	sample := make([]byte, sampleSize)
+	n, err := io.ReadFull(content, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return zip.Store, nil
+	}
+	var buf bytes.Buffer
+	fw, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := fw.Write(sample[:n]); err != nil {
+		return 0, err
+	}
+	if err := fw.Close(); err != nil {
+		return 0, err
+	}
+	// Less than 10% smaller isn't worth the trouble
+	if buf.Len() >= n*9/10 {
+		return zip.Store, nil
+	}
+	return zip.Deflate, nil
+}
+
+// fileContent returns the part of file that belongs in the suitcase, which is
+// only a section of it for segments of a large file
+func fileContent(file *os.File, f inventory.File) io.ReadSeeker {
+	if f.Segment == nil {
+		return file
+	}
+	return io.NewSectionReader(file, f.Segment.Offset, f.Size)
+}
+
+// Reader reads the members of a zip suitcase back out
+type Reader struct {
+	members []member
+	opts    *config.SuitCaseOpts
+	idx     int
+	cur     io.ReadCloser
+	tmp     *os.File
+}
+
+// member is a single member of a zip suitcase, from whichever zip package
+// read it
+type member struct {
+	name    string
+	comment string
+	info    os.FileInfo
+	modTime time.Time
+	open    func() (io.ReadCloser, error)
+}
+
+// NewReader opens a zip suitcase for reading. Zip keeps its directory at the
+// end, so anything other than a file is copied to a temporary file first. With
+// a password, members are read with the fork of archive/zip that can decrypt
+// them
+func NewReader(source io.Reader, opts *config.SuitCaseOpts) (*Reader, error) {
+	r := &Reader{opts: opts}
+	f, ok := source.(*os.File)
+	if !ok {
+		tmp, err := os.CreateTemp("", "cargoship-zip")
+		if err != nil {
+			return nil, err
+		}
+		r.tmp = tmp
+		if _, err := io.Copy(tmp, source); err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		f = tmp
+	}
+	st, err := f.Stat()
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	if opts.Password != "" {
+		err = r.readAESMembers(f, st.Size())
+	} else {
+		err = r.readMembers(f, st.Size())
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reader) readMembers(f io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		r.members = append(r.members, member{
+			name:    zf.Name,
+			comment: zf.Comment,
+			info:    zf.FileInfo(),
+			modTime: zf.Modified,
+			open:    zf.Open,
+		})
+	}
+	return nil
+}
+
+func (r *Reader) readAESMembers(f io.ReaderAt, size int64) error {
+	zr, err := aeszip.NewReader(f, size)
+	if err != nil {
+		return err
+	}
+	for _, zf := range zr.File {
+		if zf.IsEncrypted() {
+			zf.SetPassword(r.opts.Password)
+		}
+		modTime := zf.ModTime()
+		if mtime, ok := parseExtendedTime(zf.Extra); ok {
+			modTime = mtime
+		}
+		r.members = append(r.members, member{
+			name:    zf.Name,
+			comment: zf.Comment,
+			info:    zf.FileInfo(),
+			modTime: modTime,
+			open:    zf.Open,
+		})
+	}
+	return nil
+}
+
+// Config returns configuration options
+func (r *Reader) Config() *config.SuitCaseOpts {
+	return r.opts
+}
+
+// Next returns the header and content of the next member in the suitcase,
+// or io.EOF once every member has been read. When EncryptInner is set, members
+// added with AddEncrypt are decrypted on the fly and have their .gpg suffix
+// removed
+func (r *Reader) Next() (*tar.Header, io.Reader, error) {
+	if err := r.closeCurrent(); err != nil {
+		return nil, nil, err
+	}
+	if r.idx >= len(r.members) {
+		return nil, nil, io.EOF
+	}
+	m := r.members[r.idx]
+	r.idx++
+
+	var link string
+	if m.info.Mode()&os.ModeSymlink != 0 {
+		rc, err := m.open()
+		if err != nil {
+			return nil, nil, err
+		}
+		b, err := io.ReadAll(rc)
+		dclose(rc)
+		if err != nil {
+			return nil, nil, err
+		}
+		link = string(b)
+	}
+	header, err := tar.FileInfoHeader(m.info, link)
+	if err != nil {
+		return nil, nil, err
+	}
+	header.Name = m.name
+	header.ModTime = m.modTime
+	// Zip doesn't keep ownership, so files belong to whoever restores them
+	header.Uid, header.Gid = os.Getuid(), os.Getgid()
+	header.PAXRecords = parseRecordsComment(m.comment)
+	if target, ok := header.PAXRecords[HardlinkRecord]; ok {
+		header.Typeflag = tar.TypeLink
+		header.Linkname = target
+		delete(header.PAXRecords, HardlinkRecord)
+	}
+	if header.Typeflag != tar.TypeReg {
+		return header, bytes.NewReader(nil), nil
+	}
+	if r.cur, err = m.open(); err != nil {
+		return nil, nil, err
+	}
+	if !r.opts.EncryptInner || !strings.HasSuffix(header.Name, ".gpg") {
+		return header, r.cur, nil
+	}
+	dr, err := gpg.NewDecryptReader(r.cur, r.opts.DecryptWith, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not decrypt %v: %w", header.Name, err)
+	}
+	header.Name = strings.TrimSuffix(header.Name, ".gpg")
+	return header, dr, nil
+}
+
+func (r *Reader) closeCurrent() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// Close closes the member being read, and cleans up any temporary copy
+func (r *Reader) Close() error {
+	err := r.closeCurrent()
+	if r.tmp != nil {
+		dclose(r.tmp)
+		if rerr := os.Remove(r.tmp.Name()); rerr != nil && err == nil {
+			err = rerr
+		}
+		r.tmp = nil
+	}
+	return err
+}
+
+func dclose(c io.Closer) {
+	if err := c.Close(); err != nil {
+		slog.Warn("error closing file", "error", err)
+	}
+}
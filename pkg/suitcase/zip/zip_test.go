@@ -0,0 +1,299 @@
+package zip
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/scttfrdmn/cargoship/pkg/config"
+	"github.com/scttfrdmn/cargoship/pkg/gpg"
+	"github.com/scttfrdmn/cargoship/pkg/inventory"
+	ctar "github.com/scttfrdmn/cargoship/pkg/suitcase/tar"
+)
+
+// readAll reads every member of a zip suitcase, keyed by name
+func readAll(t *testing.T, fn string, opts *config.SuitCaseOpts) (map[string]*tar.Header, map[string]string) {
+	f, err := os.Open(fn) // nolint:gosec
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	r, err := NewReader(f, opts)
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	headers := map[string]*tar.Header{}
+	contents := map[string]string{}
+	for {
+		h, content, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		b, err := io.ReadAll(content)
+		require.NoError(t, err)
+		headers[h.Name] = h
+		contents[h.Name] = string(b)
+	}
+	return headers, contents
+}
+
+func TestZipFile(t *testing.T) {
+	tmp := t.TempDir()
+	mtime := time.Date(2023, 2, 14, 14, 1, 13, 0, time.UTC)
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "name.txt"), []byte("Joe the user\n"), 0o640))
+	require.NoError(t, os.Chtimes(filepath.Join(tmp, "name.txt"), mtime, mtime))
+	require.NoError(t, os.Symlink("name.txt", filepath.Join(tmp, "link")))
+
+	fn := filepath.Join(tmp, "test.zip")
+	f, err := os.Create(fn) // nolint:gosec
+	require.NoError(t, err)
+	archive, err := New(f, &config.SuitCaseOpts{Format: "zip"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "never-exist.txt"), Destination: "never-exist.txt"})
+	require.Error(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "name.txt"), Destination: "data/name.txt", Type: inventory.RegularEntry})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "link"), Destination: "data/link", Type: inventory.SymlinkEntry})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "name.txt"), Destination: "data/hard", Type: inventory.HardlinkEntry, LinkTarget: "data/name.txt"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "name.txt"), Destination: "data/dup.txt", Type: inventory.RegularEntry, DuplicateOf: "data/name.txt"})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	require.NoError(t, f.Close())
+
+	headers, contents := readAll(t, fn, &config.SuitCaseOpts{Format: "zip"})
+	require.Equal(t, "Joe the user\n", contents["data/name.txt"])
+	require.Equal(t, byte(tar.TypeReg), headers["data/name.txt"].Typeflag)
+	require.Equal(t, mtime, headers["data/name.txt"].ModTime.UTC())
+	require.Equal(t, os.FileMode(0o640), headers["data/name.txt"].FileInfo().Mode().Perm())
+
+	require.Equal(t, byte(tar.TypeSymlink), headers["data/link"].Typeflag)
+	require.Equal(t, "name.txt", headers["data/link"].Linkname)
+
+	require.Equal(t, byte(tar.TypeLink), headers["data/hard"].Typeflag)
+	require.Equal(t, "data/name.txt", headers["data/hard"].Linkname)
+
+	require.Equal(t, "data/name.txt", headers["data/dup.txt"].PAXRecords[ctar.DuplicateOfPAXRecord])
+	require.Equal(t, "", contents["data/dup.txt"])
+}
+
+func TestZipCompressionLevel(t *testing.T) {
+	src := filepath.Join(t.TempDir(), "words.txt")
+	var words strings.Builder
+	for i := range 50_000 {
+		fmt.Fprintf(&words, "word%v ", i*7919%10007)
+	}
+	require.NoError(t, os.WriteFile(src, []byte(words.String()), 0o600))
+
+	sizes := map[int]int{}
+	for _, level := range []int{1, 9} {
+		var buf bytes.Buffer
+		archive, err := New(&buf, &config.SuitCaseOpts{Format: "zip", CompressionLevel: level})
+		require.NoError(t, err)
+		_, err = archive.Add(inventory.File{Path: src, Destination: "words.txt", Type: inventory.RegularEntry})
+		require.NoError(t, err)
+		require.NoError(t, archive.Close())
+		sizes[level] = buf.Len()
+	}
+	require.Less(t, sizes[9], sizes[1])
+
+	_, err := New(io.Discard, &config.SuitCaseOpts{Format: "zip", CompressionLevel: 42})
+	require.Error(t, err)
+}
+
+func TestZipSpecialFile(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, syscall.Mkfifo(filepath.Join(tmp, "pipe"), 0o600))
+	archive, err := New(io.Discard, &config.SuitCaseOpts{Format: "zip"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: filepath.Join(tmp, "pipe"), Destination: "pipe", Type: inventory.FIFOEntry})
+	require.EqualError(t, err, "zip suitcases can not hold special files: "+filepath.Join(tmp, "pipe"))
+}
+
+func TestZipFileAddHash(t *testing.T) {
+	fn := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(fn) // nolint:gosec
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+
+	archive, err := New(f, &config.SuitCaseOpts{Format: "zip", HashInner: true})
+	require.NoError(t, err)
+	hs, err := archive.Add(inventory.File{
+		Path:        "../../testdata/name.txt",
+		Destination: "name.txt",
+		Type:        inventory.RegularEntry,
+	})
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(hs.Filename, "name.txt"))
+	require.Equal(t, "68e6c64a20407c35ebc20d905c941e03c63b3bfe3c853a708a93ec5a95532fbd", hs.Hash)
+	require.NoError(t, archive.Close())
+
+	// An unknown algorithm fails before anything is written
+	var buf bytes.Buffer
+	archive, err = New(&buf, &config.SuitCaseOpts{Format: "zip", HashInner: true, HashAlgorithm: "crc32"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt", Type: inventory.RegularEntry})
+	require.Error(t, err)
+	require.NoError(t, archive.Close())
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	require.Empty(t, zr.File)
+}
+
+func TestZipSegment(t *testing.T) {
+	tmp := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "big.dat"), []byte("0123456789"), 0o600))
+	fn := filepath.Join(tmp, "test.zip")
+	f, err := os.Create(fn) // nolint:gosec
+	require.NoError(t, err)
+	archive, err := New(f, &config.SuitCaseOpts{Format: "zip"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{
+		Path:        filepath.Join(tmp, "big.dat"),
+		Destination: "big.dat",
+		Type:        inventory.RegularEntry,
+		Size:        4,
+		Segment:     &inventory.Segment{Offset: 3, TotalSize: 10},
+	})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	require.NoError(t, f.Close())
+
+	headers, contents := readAll(t, fn, &config.SuitCaseOpts{Format: "zip"})
+	require.Equal(t, "3456", contents["big.dat"])
+	require.Equal(t, map[string]string{
+		ctar.SegmentOffsetPAXRecord:    "3",
+		ctar.SegmentTotalSizePAXRecord: "10",
+	}, headers["big.dat"].PAXRecords)
+}
+
+func TestZipAES(t *testing.T) {
+	_, err := NewAES(io.Discard, &config.SuitCaseOpts{Format: "aes.zip"})
+	require.EqualError(t, err, "cannot write aes.zip suitcases without a password")
+
+	fn := filepath.Join(t.TempDir(), "test.aes.zip")
+	f, err := os.Create(fn) // nolint:gosec
+	require.NoError(t, err)
+	archive, err := NewAES(f, &config.SuitCaseOpts{Format: "aes.zip", Password: "s3cret", HashInner: true})
+	require.NoError(t, err)
+	hs, err := archive.Add(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt", Type: inventory.RegularEntry})
+	require.NoError(t, err)
+	require.Equal(t, "68e6c64a20407c35ebc20d905c941e03c63b3bfe3c853a708a93ec5a95532fbd", hs.Hash)
+	require.NoError(t, archive.Close())
+	require.NoError(t, f.Close())
+
+	// The content must not be sitting in the file in the clear
+	raw, err := os.ReadFile(fn) // nolint:gosec
+	require.NoError(t, err)
+	require.NotContains(t, string(raw), "Joe the user")
+
+	_, contents := readAll(t, fn, &config.SuitCaseOpts{Format: "aes.zip", Password: "s3cret"})
+	require.Equal(t, "Joe the user\n", contents["name.txt"])
+
+	f, err = os.Open(fn) // nolint:gosec
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	r, err := NewReader(f, &config.SuitCaseOpts{Format: "aes.zip", Password: "wrong"})
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	_, _, err = r.Next()
+	require.Error(t, err)
+}
+
+func TestZipEncryptInner(t *testing.T) {
+	pubKey, err := gpg.ReadEntity("../../testdata/fakey-public.key")
+	require.NoError(t, err)
+	privKeys, err := gpg.ReadPrivateKeys([]string{"../../testdata/fakey-private.key"}, nil)
+	require.NoError(t, err)
+	opts := &config.SuitCaseOpts{
+		Format:       "zip",
+		EncryptInner: true,
+		EncryptTo:    &openpgp.EntityList{pubKey},
+		DecryptWith:  privKeys,
+	}
+
+	fn := filepath.Join(t.TempDir(), "test.zip")
+	f, err := os.Create(fn) // nolint:gosec
+	require.NoError(t, err)
+	archive, err := New(f, opts)
+	require.NoError(t, err)
+	require.NoError(t, archive.AddEncrypt(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt", Type: inventory.RegularEntry}))
+	require.NoError(t, archive.Close())
+	require.NoError(t, f.Close())
+
+	headers, contents := readAll(t, fn, opts)
+	require.Contains(t, headers, "name.txt")
+	require.Equal(t, "Joe the user\n", contents["name.txt"])
+
+	// Without keys, the member can't be read
+	f, err = os.Open(fn) // nolint:gosec
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	r, err := NewReader(f, &config.SuitCaseOpts{Format: "zip", EncryptInner: true})
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+	_, _, err = r.Next()
+	require.EqualError(t, err, "could not decrypt name.txt.gpg: no decryption keys given")
+}
+
+func TestPickMethod(t *testing.T) {
+	got, err := pickMethod(bytes.NewReader(bytes.Repeat([]byte("compress me "), 10000)), "notes.txt")
+	require.NoError(t, err)
+	require.Equal(t, zip.Deflate, got)
+
+	// Already compressed, by extension
+	got, err = pickMethod(bytes.NewReader(bytes.Repeat([]byte("compress me "), 10000)), "notes.TXT.gz")
+	require.NoError(t, err)
+	require.Equal(t, zip.Store, got)
+
+	// Already compressed, by looking at it
+	random := make([]byte, 100_000)
+	_, err = rand.Read(random)
+	require.NoError(t, err)
+	r := bytes.NewReader(random)
+	got, err = pickMethod(r, "random.dat")
+	require.NoError(t, err)
+	require.Equal(t, zip.Store, got)
+	pos, err := r.Seek(0, io.SeekCurrent)
+	require.NoError(t, err)
+	require.Equal(t, int64(0), pos)
+
+	got, err = pickMethod(bytes.NewReader(nil), "empty.txt")
+	require.NoError(t, err)
+	require.Equal(t, zip.Store, got)
+}
+
+func TestReaderNotAFile(t *testing.T) {
+	var buf bytes.Buffer
+	archive, err := New(&buf, &config.SuitCaseOpts{Format: "zip"})
+	require.NoError(t, err)
+	_, err = archive.Add(inventory.File{Path: "../../testdata/name.txt", Destination: "name.txt", Type: inventory.RegularEntry})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	r, err := NewReader(&buf, &config.SuitCaseOpts{Format: "zip"})
+	require.NoError(t, err)
+	h, content, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "name.txt", h.Name)
+	b, err := io.ReadAll(content)
+	require.NoError(t, err)
+	require.Equal(t, "Joe the user\n", string(b))
+	_, _, err = r.Next()
+	require.Equal(t, io.EOF, err)
+	tmp := r.tmp.Name()
+	require.NoError(t, r.Close())
+	require.NoFileExists(t, tmp)
+}
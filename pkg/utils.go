@@ -87,16 +87,28 @@ func fileExists(filename string) bool {
 	return !info.IsDir()
 }
 
-func hashInner(targetFn string, ha inventory.HashAlgorithm, hashes []config.HashSet) error {
-	hashF, err := os.Create(fmt.Sprintf("%v.%v", targetFn, ha)) // nolint:gosec
+// hashInner writes out a hash file next to the suitcase for each algorithm,
+// named after the algorithm
+func hashInner(targetFn string, algs []inventory.HashAlgorithm, hashes []config.HashSet) error {
+	for _, ha := range algs {
+		if err := writeHashFile(fmt.Sprintf("%v.%v", targetFn, ha), ha, hashes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeHashFile(fn string, ha inventory.HashAlgorithm, hashes []config.HashSet) error {
+	hashF, err := os.Create(fn) // nolint:gosec
 	if err != nil {
 		return err
 	}
 	defer dclose(hashF)
-	if err := suitcase.WriteHashFile(hashes, hashF); err != nil {
-		return err
+	set := make([]config.HashSet, len(hashes))
+	for i, hs := range hashes {
+		set[i] = config.HashSet{Filename: hs.Filename, Hash: hs.Hashes[ha.String()]}
 	}
-	return nil
+	return suitcase.WriteHashFile(set, hashF)
 }
 
 func int64ToUint64(i int64) uint64 {
@@ -13,5 +13,16 @@ import (
 func TestHashInner(t *testing.T) {
 	fn := path.Join(t.TempDir(), "test.txt")
 	require.NoError(t, os.WriteFile(fn, []byte("Testing"), 0o600))
-	require.NoError(t, hashInner(fn, inventory.MD5Hash, []config.HashSet{}))
+	require.NoError(t, hashInner(fn, []inventory.HashAlgorithm{inventory.MD5Hash}, []config.HashSet{}))
+
+	// One file for each algorithm
+	require.NoError(t, hashInner(fn, []inventory.HashAlgorithm{inventory.MD5Hash, inventory.SHA1Hash}, []config.HashSet{
+		{Filename: "/data/name.txt", Hash: "a", Hashes: map[string]string{"md5": "a", "sha1": "b"}},
+	}))
+	got, err := os.ReadFile(fn + ".md5") // nolint:gosec
+	require.NoError(t, err)
+	require.Equal(t, "a\t/data/name.txt\n", string(got))
+	got, err = os.ReadFile(fn + ".sha1") // nolint:gosec
+	require.NoError(t, err)
+	require.Equal(t, "b\t/data/name.txt\n", string(got))
 }